@@ -17,6 +17,7 @@ package cmd
 
 import (
 	"errors"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 
@@ -25,25 +26,60 @@ import (
 )
 
 func init() {
+	buildCommand.PersistentFlags().IntVar(&parallel, "parallel", 1, "Maximum number of modules to build in parallel")
+	buildCommand.PersistentFlags().BoolVar(&cache, "cache", false, "Skip the modules with a successful build of the same version recorded in the build cache")
+	buildCommand.PersistentFlags().StringVar(&cacheDir, "cache-dir", "", "Path to build cache directory (implies --cache)")
+	buildCommand.PersistentFlags().StringVar(&cacheURL, "cache-url", "", "Url of a remote http build cache (implies --cache)")
+	buildCommand.PersistentFlags().BoolVar(&logPrefix, "log-prefix", false, "Prefix each line of the command output with the module name")
+	buildCommand.PersistentFlags().BoolVar(&logColor, "log-color", false, "Colour the module name prefixes (implies --log-prefix)")
+	buildCommand.PersistentFlags().StringVar(&logDir, "log-dir", "", "Directory to write the command output of each module (<log-dir>/<module>.log)")
+	buildCommand.PersistentFlags().BoolVar(&isolated, "isolated", false, "Run in a temporary copy of the target commit instead of checking it out in the workspace")
+	buildCommand.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Print the execution plan without checking out or running anything")
+	buildCommand.PersistentFlags().StringVar(&planFormat, "plan-format", "text", "Format of the execution plan printed by --dry-run (text or json)")
+	buildCommand.PersistentFlags().StringArrayVar(&reports, "report", []string{}, "Write a report of the results to a file (<format>=<path>, format is junit or json). Can be specified multiple times.")
+	buildCommand.PersistentFlags().StringVar(&events, "events", "", "Write progress events as newline delimited json to a file (- for stdout)")
+
 	buildPr.Flags().StringVar(&src, "src", "", "Source branch")
 	buildPr.Flags().StringVar(&dst, "dst", "", "Destination branch")
+	buildPr.Flags().StringVarP(&name, "name", "n", "", "Build modules with a name that matches this value. Multiple names can be specified as a comma separated string.")
+	buildPr.Flags().BoolVarP(&fuzzy, "fuzzy", "f", false, "Use fuzzy match when filtering")
+	buildPr.Flags().StringVar(&filter, "filter", "", "Filter expression (e.g. 'path=services/** and properties.team=payments')")
+	buildPr.Flags().StringVar(&moduleKind, "module-kind", "", "Build modules of this kind. Multiple kinds can be specified as a comma separated string.")
+	buildPr.Flags().BoolVar(&dependents, "dependents", false, "Include the modules depending on the filtered modules")
 
-	buildDiff.Flags().StringVar(&from, "from", "", "From commit")
+	buildDiff.Flags().StringVar(&from, "from", "", "From commit or a revision range (<from>..<to> or <from>...<to>) when --to is omitted")
 	buildDiff.Flags().StringVar(&to, "to", "", "To commit")
+	buildDiff.Flags().StringVarP(&name, "name", "n", "", "Build modules with a name that matches this value. Multiple names can be specified as a comma separated string.")
+	buildDiff.Flags().BoolVarP(&fuzzy, "fuzzy", "f", false, "Use fuzzy match when filtering")
+	buildDiff.Flags().StringVar(&filter, "filter", "", "Filter expression (e.g. 'path=services/** and properties.team=payments')")
+	buildDiff.Flags().StringVar(&moduleKind, "module-kind", "", "Build modules of this kind. Multiple kinds can be specified as a comma separated string.")
+	buildDiff.Flags().BoolVar(&dependents, "dependents", false, "Include the modules depending on the filtered modules")
 
 	buildLocal.Flags().BoolVarP(&all, "all", "a", false, "All modules")
 	buildLocal.Flags().StringVarP(&name, "name", "n", "", "Build modules with a name that matches this value. Multiple names can be specified as a comma separated string.")
 	buildLocal.Flags().BoolVarP(&fuzzy, "fuzzy", "f", false, "Use fuzzy match when filtering")
+	buildLocal.Flags().StringVar(&filter, "filter", "", "Filter expression (e.g. 'path=services/** and properties.team=payments')")
+	buildLocal.Flags().StringVar(&moduleKind, "module-kind", "", "Build modules of this kind. Multiple kinds can be specified as a comma separated string.")
+	buildLocal.Flags().BoolVar(&dependents, "dependents", false, "Include the modules depending on the filtered modules")
 
 	buildCommit.Flags().BoolVarP(&content, "content", "c", false, "Build the modules impacted by the content of the commit")
 	buildCommit.Flags().StringVarP(&name, "name", "n", "", "Build modules with a name that matches this value. Multiple names can be specified as a comma separated string.")
 	buildCommit.Flags().BoolVarP(&fuzzy, "fuzzy", "f", false, "Use fuzzy match when filtering")
+	buildCommit.Flags().StringVar(&filter, "filter", "", "Filter expression (e.g. 'path=services/** and properties.team=payments')")
+	buildCommit.Flags().StringVar(&moduleKind, "module-kind", "", "Build modules of this kind. Multiple kinds can be specified as a comma separated string.")
+	buildCommit.Flags().BoolVar(&dependents, "dependents", false, "Include the modules depending on the filtered modules")
 
 	buildBranch.Flags().StringVarP(&name, "name", "n", "", "Build modules with a name that matches this value. Multiple names can be specified as a comma separated string.")
 	buildBranch.Flags().BoolVarP(&fuzzy, "fuzzy", "f", false, "Use fuzzy match when filtering")
+	buildBranch.Flags().StringVar(&filter, "filter", "", "Filter expression (e.g. 'path=services/** and properties.team=payments')")
+	buildBranch.Flags().StringVar(&moduleKind, "module-kind", "", "Build modules of this kind. Multiple kinds can be specified as a comma separated string.")
+	buildBranch.Flags().BoolVar(&dependents, "dependents", false, "Include the modules depending on the filtered modules")
 
 	buildHead.Flags().StringVarP(&name, "name", "n", "", "Build modules with a name that matches this value. Multiple names can be specified as a comma separated string.")
 	buildHead.Flags().BoolVarP(&fuzzy, "fuzzy", "f", false, "Use fuzzy match when filtering")
+	buildHead.Flags().StringVar(&filter, "filter", "", "Filter expression (e.g. 'path=services/** and properties.team=payments')")
+	buildHead.Flags().StringVar(&moduleKind, "module-kind", "", "Build modules of this kind. Multiple kinds can be specified as a comma separated string.")
+	buildHead.Flags().BoolVar(&dependents, "dependents", false, "Include the modules depending on the filtered modules")
 
 	buildCommand.AddCommand(buildBranch)
 	buildCommand.AddCommand(buildPr)
@@ -51,31 +87,47 @@ func init() {
 	buildCommand.AddCommand(buildHead)
 	buildCommand.AddCommand(buildCommit)
 	buildCommand.AddCommand(buildLocal)
+	buildCommand.AddCommand(buildManifest)
 	RootCmd.AddCommand(buildCommand)
 }
 
 var buildHead = &cobra.Command{
 	Use: "head",
 	RunE: buildHandler(func(cmd *cobra.Command, args []string) error {
-		return summarise(system.BuildCurrentBranch(&lib.FilterOptions{Name: name, Fuzzy: fuzzy}, lib.CmdOptionsWithStdIO(buildStageCB)))
+		options, err := buildCmdOptions()
+		if err != nil {
+			return err
+		}
+
+		return summarise(system.BuildCurrentBranch(&lib.FilterOptions{Name: name, Fuzzy: fuzzy, Kind: moduleKind, Expression: filter, Dependents: dependents}, options))
 	}),
 }
 
 var buildBranch = &cobra.Command{
 	Use: "branch <branch>",
 	RunE: buildHandler(func(cmd *cobra.Command, args []string) error {
+		options, err := buildCmdOptions()
+		if err != nil {
+			return err
+		}
+
 		branch := "master"
 		if len(args) > 0 {
 			branch = args[0]
 		}
 
-		return summarise(system.BuildBranch(branch, &lib.FilterOptions{Name: name, Fuzzy: fuzzy}, lib.CmdOptionsWithStdIO(buildStageCB)))
+		return summarise(system.BuildBranch(branch, &lib.FilterOptions{Name: name, Fuzzy: fuzzy, Kind: moduleKind, Expression: filter, Dependents: dependents}, options))
 	}),
 }
 
 var buildPr = &cobra.Command{
 	Use: "pr --src <branch> --dst <branch>",
 	RunE: buildHandler(func(cmd *cobra.Command, args []string) error {
+		options, err := buildCmdOptions()
+		if err != nil {
+			return err
+		}
+
 		if src == "" {
 			return errors.New("requires source")
 		}
@@ -84,28 +136,38 @@ var buildPr = &cobra.Command{
 			return errors.New("requires dest")
 		}
 
-		return summarise(system.BuildPr(src, dst, lib.CmdOptionsWithStdIO(buildStageCB)))
+		return summarise(system.BuildPr(src, dst, &lib.FilterOptions{Name: name, Fuzzy: fuzzy, Kind: moduleKind, Expression: filter, Dependents: dependents}, options))
 	}),
 }
 
 var buildDiff = &cobra.Command{
 	Use: "diff --from <sha> --to <sha>",
 	RunE: buildHandler(func(cmd *cobra.Command, args []string) error {
+		options, err := buildCmdOptions()
+		if err != nil {
+			return err
+		}
+
 		if from == "" {
 			return errors.New("requires from commit")
 		}
 
-		if to == "" {
+		if to == "" && !strings.Contains(from, "..") {
 			return errors.New("requires to commit")
 		}
 
-		return summarise(system.BuildDiff(from, to, lib.CmdOptionsWithStdIO(buildStageCB)))
+		return summarise(system.BuildDiff(from, to, &lib.FilterOptions{Name: name, Fuzzy: fuzzy, Kind: moduleKind, Expression: filter, Dependents: dependents}, options))
 	}),
 }
 
 var buildCommit = &cobra.Command{
 	Use: "commit <sha>",
 	RunE: buildHandler(func(cmd *cobra.Command, args []string) error {
+		options, err := buildCmdOptions()
+		if err != nil {
+			return err
+		}
+
 		if len(args) == 0 {
 			return errors.New("requires the commit sha")
 		}
@@ -113,20 +175,41 @@ var buildCommit = &cobra.Command{
 		commit := args[0]
 
 		if content {
-			return summarise(system.BuildCommitContent(commit, lib.CmdOptionsWithStdIO(buildStageCB)))
+			return summarise(system.BuildCommitContent(commit, &lib.FilterOptions{Name: name, Fuzzy: fuzzy, Kind: moduleKind, Expression: filter, Dependents: dependents}, options))
 		}
-		return summarise(system.BuildCommit(commit, &lib.FilterOptions{Name: name, Fuzzy: fuzzy}, lib.CmdOptionsWithStdIO(buildStageCB)))
+		return summarise(system.BuildCommit(commit, &lib.FilterOptions{Name: name, Fuzzy: fuzzy, Kind: moduleKind, Expression: filter, Dependents: dependents}, options))
 	}),
 }
 
 var buildLocal = &cobra.Command{
 	Use: "local [--all]",
 	RunE: buildHandler(func(cmd *cobra.Command, args []string) error {
-		if all || name != "" {
-			return summarise(system.BuildWorkspace(&lib.FilterOptions{Name: name, Fuzzy: fuzzy}, lib.CmdOptionsWithStdIO(buildStageCB)))
+		options, err := buildCmdOptions()
+		if err != nil {
+			return err
+		}
+
+		if all || name != "" || filter != "" || moduleKind != "" {
+			return summarise(system.BuildWorkspace(&lib.FilterOptions{Name: name, Fuzzy: fuzzy, Kind: moduleKind, Expression: filter, Dependents: dependents}, options))
+		}
+
+		return summarise(system.BuildWorkspaceChanges(&lib.FilterOptions{Name: name, Fuzzy: fuzzy, Kind: moduleKind, Expression: filter, Dependents: dependents}, options))
+	}),
+}
+
+var buildManifest = &cobra.Command{
+	Use: "manifest <file>",
+	RunE: buildHandler(func(cmd *cobra.Command, args []string) error {
+		options, err := buildCmdOptions()
+		if err != nil {
+			return err
+		}
+
+		if len(args) == 0 {
+			return errors.New("requires the manifest file")
 		}
 
-		return summarise(system.BuildWorkspaceChanges(lib.CmdOptionsWithStdIO(buildStageCB)))
+		return summarise(system.BuildManifestFile(args[0], options))
 	}),
 }
 
@@ -136,21 +219,85 @@ func buildStageCB(a *lib.Module, s lib.CmdStage, err error) {
 		logrus.Infof("BUILD %s in %s for %s", a.Name(), a.Path(), a.Version())
 	case lib.CmdStageSkipBuild:
 		logrus.Infof("SKIP %s in %s for %s", a.Name(), a.Path(), a.Version())
+	case lib.CmdStageFailedBuild:
+		logrus.Infof("FAILED %s in %s for %s: %v", a.Name(), a.Path(), a.Version(), err)
+	case lib.CmdStageCachedBuild:
+		logrus.Infof("CACHED %s in %s for %s", a.Name(), a.Path(), a.Version())
 	}
 }
 
 func summarise(summary *lib.BuildSummary, err error) error {
-	if err == nil {
-		logrus.Infof("Modules: %v Built: %v Skipped: %v",
+	if err == nil && summary.Plan != nil {
+		return writePlan(summary.Plan)
+	}
+
+	if summary != nil {
+		logrus.Infof("Modules: %v Built: %v Skipped: %v Cached: %v Failed: %v Cancelled: %v",
 			len(summary.Manifest.Modules),
 			len(summary.Completed),
-			len(summary.Skipped))
+			len(summary.Skipped),
+			len(summary.Cached),
+			len(summary.Failures),
+			len(summary.Cancelled))
 
+		for _, a := range summary.Cancelled {
+			logrus.Infof("CANCELLED %s in %s for %s", a.Name(), a.Path(), a.Version())
+		}
+
+		rerr := writeReports("build", summary.Manifest, summary.Results)
+		if err == nil {
+			err = rerr
+		}
+	}
+
+	if err == nil {
 		logrus.Infof("Build finished for commit %v", summary.Manifest.Sha)
 	}
 	return err
 }
 
+func buildCmdOptions() (*lib.CmdOptions, error) {
+	options := lib.CmdOptionsWithStdIO(buildStageCB)
+	options.Concurrency = parallel
+	options.Context = ctx
+	options.Isolated = isolated
+
+	if cacheURL != "" {
+		if cacheDir != "" {
+			return nil, errors.New("--cache-dir and --cache-url cannot be used together")
+		}
+		options.Cache = lib.NewHTTPCache(cacheURL)
+	} else if cache || cacheDir != "" {
+		dir := cacheDir
+		if dir == "" {
+			var err error
+			dir, err = lib.DefaultCacheDir()
+			if err != nil {
+				return nil, err
+			}
+		}
+		options.Cache = lib.NewFileCache(dir)
+	}
+
+	applyOutputOptions(options)
+	err := applyPlanOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	err = applyReportOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	err = applyEventsOption(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return options, nil
+}
+
 var buildCommand = &cobra.Command{
 	Use:   "build",
 	Short: docText("build-summary"),
@@ -20,16 +20,21 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"text/tabwriter"
 
+	"github.com/mbtproject/mbt/e"
 	"github.com/mbtproject/mbt/lib"
 	"github.com/spf13/cobra"
 )
 
 var (
-	toJSON     bool
-	toGraph    bool
-	dependents bool
+	toJSON      bool
+	toGraph     bool
+	dependents  bool
+	manifestOut string
+	moduleKind  string
+	groupByKind bool
 )
 
 func init() {
@@ -40,19 +45,31 @@ func init() {
 	describeIntersectionCmd.Flags().StringVar(&first, "first", "", "First item")
 	describeIntersectionCmd.Flags().StringVar(&second, "second", "", "Second item")
 
-	describeDiffCmd.Flags().StringVar(&from, "from", "", "From commit")
+	describeDiffCmd.Flags().StringVar(&from, "from", "", "From commit or a revision range (<from>..<to> or <from>...<to>) when --to is omitted")
 	describeDiffCmd.Flags().StringVar(&to, "to", "", "To commit")
 
 	describeLocalCmd.Flags().BoolVarP(&all, "all", "a", false, "Describe all")
 
 	describeCommitCmd.Flags().BoolVarP(&content, "content", "c", false, "Describe the modules impacted by the changes in commit")
 
+	describeCompareCmd.Flags().StringVar(&from, "from", "", "From commit")
+	describeCompareCmd.Flags().StringVar(&to, "to", "", "To commit")
+
+	describeWhyCmd.Flags().StringVar(&from, "from", "", "From commit or a revision range (<from>..<to> or <from>...<to>) when --to is omitted")
+	describeWhyCmd.Flags().StringVar(&to, "to", "", "To commit")
+	describeWhyCmd.Flags().StringVar(&src, "src", "", "Source branch")
+	describeWhyCmd.Flags().StringVar(&dst, "dst", "", "Destination branch")
+
 	describeCmd.PersistentFlags().BoolVarP(&fuzzy, "fuzzy", "f", false, "Use fuzzy match when filtering")
 	describeCmd.PersistentFlags().StringVarP(&name, "name", "n", "", "Describe modules with a name that matches this value. Multiple names can be specified as a comma separated string.")
+	describeCmd.PersistentFlags().StringVar(&filter, "filter", "", "Describe modules matching this filter expression (e.g. 'path=services/** and properties.team=payments')")
+	describeCmd.PersistentFlags().StringVar(&moduleKind, "module-kind", "", "Describe modules of this kind. Multiple kinds can be specified as a comma separated string.")
+	describeCmd.PersistentFlags().BoolVar(&groupByKind, "group-by-kind", false, "Group the modules by kind")
 
 	describeCmd.PersistentFlags().BoolVar(&toJSON, "json", false, "Format output as json")
 	describeCmd.PersistentFlags().BoolVar(&toGraph, "graph", false, "Format output as dot graph")
 	describeCmd.PersistentFlags().BoolVar(&dependents, "dependents", false, "Output dependents on potential change")
+	describeCmd.PersistentFlags().StringVar(&manifestOut, "manifest-out", "", "Write the manifest as a json document to a file (see build manifest and run-in manifest)")
 
 	describeCmd.AddCommand(describeCommitCmd)
 	describeCmd.AddCommand(describeBranchCmd)
@@ -61,6 +78,8 @@ func init() {
 	describeCmd.AddCommand(describePrCmd)
 	describeCmd.AddCommand(describeIntersectionCmd)
 	describeCmd.AddCommand(describeDiffCmd)
+	describeCmd.AddCommand(describeWhyCmd)
+	describeCmd.AddCommand(describeCompareCmd)
 
 	RootCmd.AddCommand(describeCmd)
 }
@@ -83,13 +102,13 @@ var describeBranchCmd = &cobra.Command{
 			return err
 		}
 
-		m, err = m.ApplyFilters(&lib.FilterOptions{Name: name, Fuzzy: fuzzy, Dependents: dependents})
+		m, err = m.ApplyFilters(&lib.FilterOptions{Name: name, Fuzzy: fuzzy, Kind: moduleKind, Expression: filter, Dependents: dependents})
 
 		if err != nil {
 			return err
 		}
 
-		return output(m.Modules)
+		return outputManifest(m)
 	}),
 }
 
@@ -101,13 +120,13 @@ var describeHeadCmd = &cobra.Command{
 			return err
 		}
 
-		m, err = m.ApplyFilters(&lib.FilterOptions{Name: name, Fuzzy: fuzzy, Dependents: dependents})
+		m, err = m.ApplyFilters(&lib.FilterOptions{Name: name, Fuzzy: fuzzy, Kind: moduleKind, Expression: filter, Dependents: dependents})
 
 		if err != nil {
 			return err
 		}
 
-		return output(m.Modules)
+		return outputManifest(m)
 	}),
 }
 
@@ -121,12 +140,6 @@ var describeLocalCmd = &cobra.Command{
 
 		if all {
 			m, err = system.ManifestByWorkspace()
-
-			if err != nil {
-				return err
-			}
-
-			m, err = m.ApplyFilters(&lib.FilterOptions{Name: name, Fuzzy: fuzzy, Dependents: dependents})
 		} else {
 			m, err = system.ManifestByWorkspaceChanges()
 		}
@@ -135,7 +148,12 @@ var describeLocalCmd = &cobra.Command{
 			return err
 		}
 
-		return output(m.Modules)
+		m, err = m.ApplyFilters(&lib.FilterOptions{Name: name, Fuzzy: fuzzy, Kind: moduleKind, Expression: filter, Dependents: dependents})
+		if err != nil {
+			return err
+		}
+
+		return outputManifest(m)
 	}),
 }
 
@@ -155,13 +173,13 @@ var describePrCmd = &cobra.Command{
 			return err
 		}
 
-		m, err = m.ApplyFilters(&lib.FilterOptions{Name: name, Fuzzy: fuzzy, Dependents: dependents})
+		m, err = m.ApplyFilters(&lib.FilterOptions{Name: name, Fuzzy: fuzzy, Kind: moduleKind, Expression: filter, Dependents: dependents})
 
 		if err != nil {
 			return err
 		}
 
-		return output(m.Modules)
+		return outputManifest(m)
 	}),
 }
 
@@ -189,13 +207,13 @@ var describeCommitCmd = &cobra.Command{
 			return err
 		}
 
-		m, err = m.ApplyFilters(&lib.FilterOptions{Name: name, Fuzzy: fuzzy, Dependents: dependents})
+		m, err = m.ApplyFilters(&lib.FilterOptions{Name: name, Fuzzy: fuzzy, Kind: moduleKind, Expression: filter, Dependents: dependents})
 
 		if err != nil {
 			return err
 		}
 
-		return output(m.Modules)
+		return outputManifest(m)
 	}),
 }
 
@@ -214,6 +232,10 @@ var describeIntersectionCmd = &cobra.Command{
 			return errors.New("requires the second argument")
 		}
 
+		if manifestOut != "" {
+			return errors.New("--manifest-out is not supported for intersections")
+		}
+
 		var mods lib.Modules
 		var err error
 
@@ -241,7 +263,7 @@ var describeDiffCmd = &cobra.Command{
 			return errors.New("requires from commit")
 		}
 
-		if to == "" {
+		if to == "" && !strings.Contains(from, "..") {
 			return errors.New("requires to commit")
 		}
 
@@ -250,28 +272,266 @@ var describeDiffCmd = &cobra.Command{
 			return err
 		}
 
-		m, err = m.ApplyFilters(&lib.FilterOptions{Name: name, Fuzzy: fuzzy, Dependents: dependents})
+		m, err = m.ApplyFilters(&lib.FilterOptions{Name: name, Fuzzy: fuzzy, Kind: moduleKind, Expression: filter, Dependents: dependents})
+
+		if err != nil {
+			return err
+		}
+
+		return outputManifest(m)
+	}),
+}
+
+var describeCompareCmd = &cobra.Command{
+	Use: "compare --from <commit> --to <commit>",
+	RunE: buildHandler(func(cmd *cobra.Command, args []string) error {
+		if from == "" {
+			return errors.New("requires from commit")
+		}
+
+		if to == "" {
+			return errors.New("requires to commit")
+		}
+
+		if manifestOut != "" {
+			return errors.New("--manifest-out is not supported for comparisons")
+		}
+
+		c, err := system.CompareCommits(from, to)
+		if err != nil {
+			return err
+		}
+
+		return outputComparison(c)
+	}),
+}
+
+var describeWhyCmd = &cobra.Command{
+	Use: "why <module> [--from <commit> [--to <commit>] | --src <branch> --dst <branch>]",
+	RunE: buildHandler(func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return errors.New("requires the module name")
+		}
+
+		var (
+			m   *lib.Manifest
+			err error
+		)
+
+		switch {
+		case src != "" || dst != "":
+			if src == "" || dst == "" {
+				return errors.New("requires both source and dest")
+			}
+			m, err = system.ManifestByPr(src, dst)
+		case from != "":
+			if to == "" && !strings.Contains(from, "..") {
+				return errors.New("requires to commit")
+			}
+			m, err = system.ManifestByDiff(from, to)
+		default:
+			m, err = system.ManifestByWorkspaceChanges()
+		}
 
 		if err != nil {
 			return err
 		}
 
-		return output(m.Modules)
+		if manifestOut != "" {
+			err = writeManifestFile(m)
+			if err != nil {
+				return err
+			}
+		}
+
+		return outputWhy(args[0], m)
 	}),
 }
 
+// outputWhy explains why the named module is included in the manifest.
+func outputWhy(name string, m *lib.Manifest) error {
+	var (
+		mod     *lib.Module
+		deleted bool
+	)
+
+	for _, a := range m.Modules {
+		if a.Name() == name {
+			mod = a
+		}
+	}
+
+	for _, a := range m.Deleted {
+		if a.Name() == name {
+			deleted = true
+		}
+	}
+
+	if toJSON {
+		v := make(map[string]interface{})
+		v["Name"] = name
+		v["Impacted"] = mod != nil
+		v["Deleted"] = deleted
+		if mod != nil && mod.Reason() != nil {
+			v["Reason"] = mod.Reason()
+		}
+		buff, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(buff))
+		return nil
+	}
+
+	switch {
+	case deleted:
+		fmt.Printf("%s is deleted\n", name)
+	case mod == nil:
+		fmt.Printf("%s is not impacted\n", name)
+	case mod.Reason() == nil:
+		fmt.Printf("%s is included\n", name)
+	default:
+		reason := mod.Reason()
+		switch reason.Kind {
+		case lib.ReasonContent:
+			fmt.Printf("%s is impacted by the changes to these files:\n", name)
+		case lib.ReasonFileDependency:
+			fmt.Printf("%s is impacted by the changes to these file dependencies:\n", name)
+		case lib.ReasonDefaults:
+			fmt.Printf("%s is impacted by the changes to repository defaults:\n", name)
+		case lib.ReasonDependency:
+			fmt.Printf("%s is impacted by a change in its dependency chain:\n", name)
+			fmt.Printf("  %s\n", strings.Join(reason.Chain, " -> "))
+		}
+		for _, f := range reason.Files {
+			fmt.Printf("  %s\n", f)
+		}
+	}
+
+	return nil
+}
+
+// outputComparison writes the modules that are different between
+// two manifests.
+func outputComparison(c *lib.Comparison) error {
+	if toJSON {
+		m := make(map[string]map[string]interface{})
+		side := func(a *lib.Module) map[string]interface{} {
+			if a == nil {
+				return nil
+			}
+			return map[string]interface{}{"Path": a.Path(), "Version": a.Version()}
+		}
+		for _, a := range c.Modules {
+			m[a.Name] = map[string]interface{}{
+				"Name":    a.Name,
+				"Changes": a.Changes,
+				"From":    side(a.From),
+				"To":      side(a.To),
+			}
+		}
+		buff, err := json.MarshalIndent(m, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(buff))
+	} else if toGraph {
+		fmt.Println(c.SerializeAsDot())
+	} else {
+		column := func(a *lib.Module, f func(*lib.Module) string) string {
+			if a == nil {
+				return "-"
+			}
+			return f(a)
+		}
+		path := (*lib.Module).Path
+		version := (*lib.Module).Version
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 4, ' ', 0)
+		fmt.Fprintf(w, "Name\tCHANGES\tFROM PATH\tTO PATH\tFROM VERSION\tTO VERSION\n")
+		for _, a := range c.Modules {
+			changes := make([]string, 0, len(a.Changes))
+			for _, change := range a.Changes {
+				changes = append(changes, string(change))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				a.Name,
+				strings.Join(changes, ","),
+				column(a.From, path),
+				column(a.To, path),
+				column(a.From, version),
+				column(a.To, version))
+		}
+
+		if err := w.Flush(); err != nil {
+			panic(err)
+		}
+	}
+
+	return nil
+}
+
 const columnWidth = 30
 
 func output(mods lib.Modules) error {
+	return outputModules(mods, nil)
+}
+
+// outputManifest writes the modules in a manifest along with the
+// modules deleted in it.
+// Manifest is also written to the file specified in --manifest-out.
+func outputManifest(m *lib.Manifest) error {
+	if manifestOut != "" {
+		err := writeManifestFile(m)
+		if err != nil {
+			return err
+		}
+	}
+
+	return outputModules(m.Modules, m.Deleted)
+}
+
+func writeManifestFile(m *lib.Manifest) error {
+	f, err := os.Create(manifestOut)
+	if err != nil {
+		return e.Wrap(lib.ErrClassUser, err)
+	}
+
+	err = lib.WriteManifest(f, m)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return e.Wrap(lib.ErrClassUser, err)
+	}
+
+	return nil
+}
+
+func outputModules(mods lib.Modules, deleted lib.Modules) error {
 	if toJSON {
 		m := make(map[string]map[string]interface{})
-		for _, a := range mods {
+		add := func(a *lib.Module) map[string]interface{} {
 			v := make(map[string]interface{})
 			v["Name"] = a.Name()
 			v["Path"] = a.Path()
 			v["Version"] = a.Version()
 			v["Properties"] = a.Properties()
+			if a.Kind() != "" {
+				v["Kind"] = a.Kind()
+			}
+			if a.Reason() != nil {
+				v["Reason"] = a.Reason()
+			}
 			m[a.Name()] = v
+			return v
+		}
+		for _, a := range mods {
+			add(a)
+		}
+		for _, a := range deleted {
+			add(a)["Deleted"] = true
 		}
 		buff, err := json.MarshalIndent(m, "", "  ")
 		if err != nil {
@@ -286,9 +546,34 @@ func output(mods lib.Modules) error {
 		}
 	} else {
 		w := tabwriter.NewWriter(os.Stdout, 0, 4, 4, ' ', 0)
-		fmt.Fprintf(w, "Name\tPATH\tVERSION\n")
-		for _, a := range mods {
-			fmt.Fprintf(w, "%s\t%s\t%s\n", a.Name(), a.Path(), a.Version())
+		if groupByKind {
+			for i, g := range mods.GroupByKind() {
+				if i > 0 {
+					fmt.Fprintf(w, "\n")
+				}
+				kind := g.Kind
+				if kind == "" {
+					kind = "(none)"
+				}
+				fmt.Fprintf(w, "Kind: %s\n", kind)
+				fmt.Fprintf(w, "Name\tPATH\tVERSION\n")
+				for _, a := range g.Modules {
+					fmt.Fprintf(w, "%s\t%s\t%s\n", a.Name(), a.Path(), a.Version())
+				}
+			}
+		} else {
+			fmt.Fprintf(w, "Name\tPATH\tVERSION\n")
+			for _, a := range mods {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", a.Name(), a.Path(), a.Version())
+			}
+		}
+
+		if len(deleted) > 0 {
+			fmt.Fprintf(w, "\nDeleted\n")
+			fmt.Fprintf(w, "Name\tPATH\tVERSION\n")
+			for _, a := range deleted {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", a.Name(), a.Path(), a.Version())
+			}
 		}
 
 		if err := w.Flush(); err != nil {
@@ -38,19 +38,32 @@ build: Dictionary of build commands specific to a platform (optional)
   default: (optional)
     cmd: Default command to run when os specific command is not found (required)
     args: Array of arguments to default build command (optional)
+    timeout: Maximum duration of the command e.g. 10m (optional)
+    retries: Number of times to retry the command if it fails (optional)
   linux|darwin|windows:
     cmd: Operating system specific command name (required)
     args: Array of arguments (optional)
+    timeout: Maximum duration of the command e.g. 10m (optional)
+    retries: Number of times to retry the command if it fails (optional)
 dependencies: An array of modules that this module's build depend on (optional)
-fileDependencies: An array of file names that this module's build depend on (optional)
+fileDependencies: An array of file names, directories or glob patterns that this module's build depend on (optional)
+artifacts: An array of glob patterns matching the build outputs to store in build cache (optional)
+ignore: An array of gitignore style patterns matching the files that do not impact the module (optional)
 commands: Optional dictionary of custom commands (optional)
   name:
     cmd: Command name (required)
     args: Array of arguments (optional)
     os: Array of os identifiers where this command should run (optional)
+    timeout: Maximum duration of the command e.g. 10m (optional)
+    retries: Number of times to retry the command if it fails (optional)
 properties: Custom dictionary to hold any module specific information (optional)
 {{c ""}}
 
+Spec files are parsed strictly, unknown keys (e.g. a misspelled {{c "dependencies"}})
+are reported as errors along with their line and column.
+A JSON Schema of the spec is printed by {{c "mbt lint schema"}}. Use {{c "mbt lint"}}
+to check all specs in a repository at once.
+
 {{h2 "Build Command"}}
 Build command is operating system specific. When executing {{c "mbt build xxx" }}
 commands, it skips the modules that do not specify a build command for the operating 
@@ -90,14 +103,92 @@ a build script that is used to build multiple modules could define a file
 dependency in order to trigger the build whenever there's a change in build.
 
 File dependencies should specify the path of the file relative to the root
-of the repository.
+of the repository. A directory includes all files underneath it.
+
+Glob patterns can be used to depend on a slice of a shared directory.
+{{c "*"}} and {{c "?"}} do not match {{c "/"}} while {{c "**"}} matches any
+number of directories. Patterns prefixed with {{c "!"}} exclude the files
+matched by other patterns. Paths are not affected by the patterns in the same
+list. Like paths, patterns are case sensitive.
+
+{{c ""}}
+fileDependencies:
+  - shared/proto/**/*.proto
+  - "!**/*_test.proto"
+{{c ""}}
+
+Unlike paths, patterns that do not match any file are not treated as an error.
+
+{{h2 "Ignored Files"}}
+Changes to some files in a module directory (e.g. documentation) should not
+trigger a build. Such files can be listed in {{c "ignore"}} using the
+gitignore syntax. Patterns are relative to the module directory.
+
+{{c ""}}
+ignore:
+  - "*.md"
+  - docs/
+{{c ""}}
+
+Ignored files are excluded both when detecting the impacted modules and
+when calculating the module version.
+
+{{h2 "Repository Defaults"}}
+Configuration shared by all modules can be specified in {{c ".mbt-defaults.yml"}}
+at the root of the repository. It may contain {{c "build"}}, {{c "commands"}}
+and {{c "properties"}} sections which are inherited by every module.
+
+{{c ""}}
+build:
+  default:
+    cmd: make
+    args: [build]
+properties:
+  docker:
+    registry: registry.example.com
+{{c ""}}
+
+Entries in {{c "build"}} and {{c "commands"}} of a module override the
+entries with the same name in defaults. Properties are merged recursively,
+values specified in the module take precedence.
+
+The configuration a module inherits from defaults (and its kind) is part of
+its version. Therefore, a change to {{c ".mbt-defaults.yml"}} impacts only the
+modules that inherit the changed configuration.
+
+{{h2 "Module Kinds"}}
+Modules built the same way (e.g. Go services, npm packages) can share a named
+kind defined in {{c "kinds"}} section of {{c ".mbt-defaults.yml"}}. In addition to
+{{c "build"}}, {{c "commands"}} and {{c "properties"}}, a kind may specify
+{{c "fileDependencies"}}, {{c "artifacts"}} and {{c "ignore"}} lists.
+
+{{c ""}}
+kinds:
+  go-service:
+    build:
+      default:
+        cmd: go
+        args: [build, ./...]
+    fileDependencies: [go.mod, go.sum]
+{{c ""}}
+
+Modules refer to a kind with the {{c "kind"}} key.
+
+{{c ""}}
+name: billing
+kind: go-service
+{{c ""}}
+
+Values specified in the module take precedence over the kind and the kind
+takes precedence over the rest of the defaults. Lists in the kind are combined
+with the lists in the module. Referring to a kind that is not defined is an error.
 
 {{h2 "Module Version"}}
 For each module stored within a repository, {{c "mbt"}} generates a unique
 stable version string. It is calculated based on three source attributes in
 module.
 
-- Content stored within the module directory
+- Content stored within the module directory (except ignored files)
 - Versions of dependent modules
 - Content of file dependencies
 
@@ -105,6 +196,36 @@ As a result, version of a module is changed only when any of those attributes
 are changed making it a safe attribute to use for tagging the 
 build artifacts (i.e. tar balls, container images).
 
+Modules in the local workspace (e.g. {{c "mbt build local"}}) are versioned
+using the content on disk, including untracked files that are not ignored by
+git. Therefore, a module that is not modified in the workspace has the same
+version as in the current commit and modified modules get a new version.
+
+{{h2 "Revisions"}}
+Commands accepting a commit (e.g. {{c "--from"}}, {{c "--to"}}, {{c "--src"}}, {{c "--dst"}}
+and {{c "<commit>"}} arguments) accept any git revision expression including full or
+abbreviated commit shas, branches, tags, remote tracking branches (e.g. {{c "origin/master"}})
+and relative forms such as {{c "HEAD~3"}} or {{c "master@{upstream}"}}.
+
+{{h2 "Filter Expressions"}}
+Commands accepting {{c "--filter <expression>"}} option consider just the modules
+matching the expression. An expression is made of comparisons in
+{{c "<field><operator><value>"}} form combined with {{c "and"}}, {{c "or"}},
+{{c "not"}} and parentheses.
+
+- {{c "name"}}, {{c "path"}} and {{c "kind"}} of the module
+- {{c "command"}} matches the names of the user defined commands in the module
+- {{c "properties.<name>"}} matches a property, nested properties are separated by dots
+
+Operator {{c "="}} is a case insensitive match. Values may be glob patterns and
+a {{c "path"}} also matches the modules underneath it. {{c "!="}} is the negation
+of {{c "="}} and {{c "~"}} is a fuzzy (subsequence) match.
+Values containing whitespace or special characters can be quoted.
+
+{{c ""}}
+mbt build head --filter 'path=services/** and properties.team=payments and not name~legacy'
+{{c ""}}
+
 {{h2 "Document Generation"}}
 {{ c "mbt" }} has a powerful feature that exposes the module state inferred from
 the repository to a template engine. This could be quite useful for generating
@@ -195,16 +316,19 @@ Default {{c "--name"}} filter is a prefix match. You can change this to a subseq
 match by using {{c "--fuzzy"}} option.
 
 {{c "mbt build commit <commit> [--content] [--name <name>] [--fuzzy]"}}{{br}}
-Build modules in a commit. Full commit sha is required.
+Build modules in a commit. Commit can be any revision expression (see {{c "mbt --help"}}).
 Build just the modules modified in the commit when {{c "--content"}} flag is used.
 Build just the modules matching the {{c "--name"}} filter if specified.
 Default {{c "--name"}} filter is a prefix match. You can change this to a subsequence
 match by using {{c "--fuzzy"}} option.
 
-{{c "mbt build diff --from <commit> --to <commit>"}}{{br}}
+{{c "mbt build diff --from <commit> --to <commit> [--name <name>] [--fuzzy]"}}{{br}}
 Build modules changed between {{c "from"}} and {{c "to"}} commits.
 In this mode, mbt works out the merge base between {{c "from"}} and {{c "to"}} and
 evaluates the modules changed between the merge base and {{c "to"}}.
+A revision range ({{c "<from>..<to>"}} or {{c "<from>...<to>"}}) can be specified in
+{{c "--from"}} instead of using {{c "--to"}}.
+Build just the changed modules matching the {{c "--name"}} filter if specified.
 
 {{c "mbt build head [--content] [--name <name>] [--fuzzy]"}}{{br}}
 Build modules in current head.
@@ -212,10 +336,11 @@ Build just the modules matching the {{c "--name"}} filter if specified.
 Default {{c "--name"}} filter is a prefix match. You can change this to a subsequence
 match by using {{c "--fuzzy"}} option.
 
-{{c "mbt build pr --src <name> --dst <name>"}}{{br}}
+{{c "mbt build pr --src <name> --dst <name> [--name <name>] [--fuzzy]"}}{{br}}
 Build modules changed between {{c "--src"}} and {{c "--dst"}} branches.
 In this mode, mbt works out the merge base between {{c "--src"}} and {{c "--dst"}} and
 evaluates the modules changed between the merge base and {{c "--src"}}.
+Build just the changed modules matching the {{c "--name"}} filter if specified.
 
 {{c "mbt build local [--all] [--content] [--name <name>] [--fuzzy]"}}{{br}}
 Build modules modified in current workspace. All modules in the workspace are
@@ -224,6 +349,117 @@ Build just the modules matching the {{c "--name"}} filter if specified.
 Default {{c "--name"}} filter is a prefix match. You can change this to a subsequence
 match by using {{c "--fuzzy"}} option.
 
+Use {{c "--filter <expression>"}} option with any of the above commands accepting
+{{c "--name"}} to build just the modules matching a filter expression
+(see Filter Expressions in {{c "mbt --help"}}).
+
+Use {{c "--module-kind <kind>"}} option with any of the above commands accepting
+{{c "--name"}} to build just the modules of the specified kind (see Module Kinds
+in {{c "mbt --help"}}). Multiple kinds can be specified as a comma separated string.
+
+Use {{c "--dependents"}} option along with {{c "--name"}}, {{c "--module-kind"}} or
+{{c "--filter"}} to also build the modules depending on the matching modules.
+
+{{c "mbt build manifest <file>"}}{{br}}
+Build the modules in a manifest written by {{c "mbt describe ... --manifest-out <file>"}}.
+Modules are built at the commit recorded in the manifest, in the same order.
+The command fails if a module in the manifest does not exist in that commit or
+its version is different.
+
+{{h2 "Parallel Builds"}}
+By default, modules are built one at a time in topological order.
+Use {{c "--parallel <n>"}} option to build up to {{c "n"}} modules at the same time.
+A module is built as soon as all the modules it depends on are built.
+When a module fails to build, modules depending on it are not started.
+Other modules continue to build and the command fails at the end.
+
+{{h2 "Build Cache"}}
+Use {{c "--cache"}} option to record successful builds in a cache directory
+({{c "mbt"}} directory inside the user cache directory e.g. {{c "~/.cache/mbt"}}).
+Subsequent builds skip the modules with a version that is already recorded in
+the cache. Since module version is derived from the content of the module, its
+file dependencies and dependencies, a cached version does not require a rebuild.
+Builds are recorded per operating system ({{c "<module>/<version>-<os>"}}), so a
+cache can be shared between agents running on different platforms.
+Use {{c "--cache-dir <path>"}} option to specify an alternative cache directory.
+
+Use {{c "--cache-url <url>"}} option to share the cache via a remote http server.
+Cache entries are accessed via {{c "<url>/<module>/<version>-<os>"}} resource.
+Server should respond to {{c "HEAD"}} requests with 200 or 404 status,
+{{c "GET"}} requests with the entry content and accept {{c "PUT"}} requests
+to record new entries.
+
+Modules can list their build outputs in {{c "artifacts"}} section of the spec
+(glob patterns relative to the module directory). Matching files are stored in the
+cache along with the build record and restored into the module directory when
+the build is skipped due to a cache hit.
+
+{{h2 "Output"}}
+By default, output of the build commands is written to stdout and stderr as is.
+Use {{c "--log-prefix"}} option to prefix each line with the name of the module
+that produced it. This is useful to follow the output of parallel builds.
+Use {{c "--log-color"}} option to colour the prefixes.
+Use {{c "--log-dir <dir>"}} option to additionally write the output of each module
+to {{c "<dir>/<module>.log"}}. Output is appended to the log files, each command is
+preceded by a header line with the command and the time it was started.
+
+{{h2 "Isolated Builds"}}
+By default, {{c "mbt"}} checks out the target commit in the workspace and restores
+the previous head once the build is completed. This requires a clean workspace.
+Use {{c "--isolated"}} option to build in a temporary directory containing the
+files of the target commit instead. Workspace and the current head are never
+modified, therefore builds can run while having uncommitted changes.
+Temporary directory does not contain the git repository ({{c ".git"}}) and it is
+removed once the build is completed. {{c "MBT_REPO_PATH"}} points to this directory.
+{{c "--isolated"}} option has no effect on {{c "mbt build local"}}.
+
+{{h2 "Dry Run"}}
+Use {{c "--dry-run"}} option to print the execution plan without checking out the
+commit or running anything. The plan lists the modules in the order they would be
+processed along with the resolved build command for current platform, working
+directory, environment variables set by mbt, and the reason for skipping
+modules. Modules with a successful build recorded in the build cache are listed
+as cached. Use {{c "--plan-format json"}} to print the plan in json format.
+
+{{h2 "Progress Events"}}
+Use {{c "--events <file>"}} option to write the build progress as newline delimited
+json events. Use {{c "-"}} as the file name to write the events to stdout (output
+of the build commands is redirected to stderr in this case). Events cannot be
+written to stdout with {{c "--dry-run"}} because the plan is written there.
+Each event contains {{c "type"}}, {{c "time"}}, {{c "command"}} and {{c "sha"}} of the
+manifest. Module events also contain {{c "module"}}, {{c "path"}} and {{c "version"}}.
+
+- {{c "build_started"}} Before building the modules in the manifest
+- {{c "module_started"}} Before building a module
+- {{c "module_completed"}} After building a module ({{c "durationMs"}}, {{c "exitCode"}})
+- {{c "module_failed"}} After a module build failure ({{c "durationMs"}}, {{c "exitCode"}}, {{c "error"}})
+- {{c "module_skipped"}} Module does not have a build command for current platform
+- {{c "module_cached"}} Module build is found in the build cache
+- {{c "module_cancelled"}} Module is not built due to a failed dependency
+- {{c "build_finished"}} After building all modules ({{c "durationMs"}}, {{c "error"}})
+
+{{h2 "Reports"}}
+Use {{c "--report <format>=<path>"}} option to write a report of the build results.
+Supported formats are {{c "junit"}} (JUnit xml) and {{c "json"}}. The option can be specified
+multiple times to write reports in several formats.
+Each module is reported with its status ({{c "completed"}}, {{c "failed"}}, {{c "skipped"}},
+{{c "cached"}} or {{c "cancelled"}}), duration, the tail of its output and the failure error.
+Skipped modules include the reason ({{c "no_command"}}, {{c "unsupported_os"}}, {{c "fail_fast"}}
+or {{c "cancelled"}}). In JUnit reports, modules are reported as test cases and the modules that
+were not built are reported as skipped test cases.
+
+{{h2 "Timeouts and Retries"}}
+Build commands and user defined commands can specify a {{c "timeout"}}
+(e.g. {{c "30s"}}, {{c "10m"}}). A command running longer than its timeout
+is terminated and reported as a failure. Failed commands are repeated as many
+times as specified in {{c "retries"}}, each attempt with the same timeout.
+
+Commands are executed in their own process group, unless mbt is attached to
+a terminal in which case they stay in the foreground to be able to read from it.
+When mbt receives {{c "SIGINT"}} or {{c "SIGTERM"}}, the signal is forwarded to
+the running command (and its process group) and no further commands are started.
+mbt restores the workspace to the original branch once the command exits.
+
 {{h2 "Build Environment"}}
 
 When executing build, following environment variables are initialised and can be
@@ -247,7 +483,7 @@ Default {{c "--name"}} filter is a prefix match. You can change this to a subseq
 match by using {{c "--fuzzy"}} option.
 
 {{c "mbt describe commit <commit> [--content] [--name <name>] [--fuzzy] [--graph] [--json]"}}{{br}}
-Describe modules in a commit. Full commit sha is required.
+Describe modules in a commit. Commit can be any revision expression (see {{c "mbt --help"}}).
 Describe just the modules modified in the commit when {{c "--content"}} flag is used.
 Describe just the modules matching the {{c "--name"}} filter if specified.
 Default {{c "--name"}} filter is a prefix match. You can change this to a subsequence
@@ -257,6 +493,10 @@ match by using {{c "--fuzzy"}} option.
 Describe modules changed between {{c "from"}} and {{c "to"}} commits.
 In this mode, mbt works out the merge base between {{c "from"}} and {{c "to"}} and
 evaluates the modules changed between the merge base and {{c "to"}}.
+A revision range ({{c "<from>..<to>"}} or {{c "<from>...<to>"}}) can be specified in
+{{c "--from"}} instead of using {{c "--to"}}.
+Modules present in the merge base but removed in {{c "to"}} are listed separately
+as deleted modules (with {{c "Deleted"}} set to true in json output).
 
 {{c "mbt describe head [--content] [--name <name>] [--fuzzy] [--graph] [--json]"}}{{br}}
 Describe modules in current head.
@@ -268,6 +508,26 @@ match by using {{c "--fuzzy"}} option.
 Describe modules changed between {{c "--src"}} and {{c "--dst"}} branches.
 In this mode, mbt works out the merge base between {{c "--src"}} and {{c "--dst"}} and
 evaluates the modules changed between the merge base and {{c "--src"}}.
+Deleted modules are listed separately as in {{c "describe diff"}}.
+
+{{c "mbt describe why <module> [--from <commit> [--to <commit>] | --src <name> --dst <name>] [--json]"}}{{br}}
+Explain why a module is included in the manifest of a diff ({{c "--from"}} and {{c "--to"}}),
+a pull request ({{c "--src"}} and {{c "--dst"}}) or the changes in current workspace
+(when neither is specified). A module is included because files under its path
+changed, because its file dependencies changed or because of a change in its
+dependency chain (e.g. {{c "billing -> common -> proto"}}).
+The reason for each module is also available in the json output of other
+describe commands.
+
+{{c "mbt describe compare --from <commit> --to <commit> [--graph] [--json]"}}{{br}}
+Compare the modules in {{c "from"}} and {{c "to"}} commits. Unlike {{c "describe diff"}},
+modules are compared by their version regardless of how the commits are related
+(e.g. a release tag and a branch containing cherry picked commits).
+Each module is reported as {{c "added"}}, {{c "removed"}}, {{c "pathChanged"}} (moved to
+a different directory) and/or {{c "versionChanged"}}. Unchanged modules are not listed.
+With {{c "--graph"}} option, modules in {{c "to"}} commit are plotted with the changed
+modules highlighted (added in green, removed in grey, version changes in red and
+moved modules in orange).
 
 {{c "mbt describe local [--all] [--content] [--name <name>] [--fuzzy] [--graph] [--json]"}}{{br}}
 Describe modules modified in current workspace. All modules in the workspace are
@@ -276,51 +536,146 @@ Describe just the modules matching the {{c "--name"}} filter if specified.
 Default {{c "--name"}} filter is a prefix match. You can change this to a subsequence
 match by using {{c "--fuzzy"}} option.
 
+Use {{c "--filter <expression>"}} option with any of the above commands accepting
+{{c "--name"}} to describe just the modules matching a filter expression
+(see Filter Expressions in {{c "mbt --help"}}).
+
+Use {{c "--module-kind <kind>"}} option with any of the above commands to describe
+just the modules of the specified kind (see Module Kinds in {{c "mbt --help"}}).
+Multiple kinds can be specified as a comma separated string.
+
 {{h2 "Output Formats"}}
 Use {{c "--graph"}} option to output the manifest in graphviz dot format. This can
 be useful to visualise build dependencies.
 
 Use {{c "--json"}} option to output the manifest in json format.
 
+Use {{c "--group-by-kind"}} option to list the modules of each kind separately.
+
+{{h2 "Manifest Files"}}
+Use {{c "--manifest-out <file>"}} option to additionally write the manifest to a file.
+Unlike {{c "--json"}} output, this is a versioned document ({{c "formatVersion"}}) containing
+the commit {{c "sha"}}, repository {{c "dir"}} and the modules in topological order with
+their {{c "name"}}, {{c "kind"}}, {{c "path"}}, {{c "version"}}, {{c "hash"}}, {{c "requires"}}, {{c "requiredBy"}},
+{{c "properties"}} and {{c "fileDependencyHashes"}}.
+The file can be used with {{c "mbt build manifest"}} and {{c "mbt run-in manifest"}}
+so that a CI stage can plan a build and later stages can execute exactly that plan.
+
+`,
+	"lint-summary": `Check module specs for problems`,
+	"lint": `{{cli "Check module specs for problems \n"}}
+{{c "mbt lint local"}}{{br}}
+Check the specs in current workspace.
+
+{{c "mbt lint commit <commit>"}}{{br}}
+Check the specs in a commit. Commit can be any revision expression (see {{c "mbt --help"}}).
+
+{{c "mbt lint schema"}}{{br}}
+Print the JSON Schema of {{c ".mbt.yml"}}. It can be used with editors supporting
+JSON Schema for yaml documents.
+
+Unlike other commands, which stop at the first invalid spec, all problems are
+reported at once in {{c "<file>:<line>:<column>: <message>"}} form. Following
+problems are reported.
+
+- Spec files that are not valid yaml
+- Unknown or duplicate keys
+- Missing or duplicate module names
+- Dependencies on modules that do not exist and modules depending on themselves
+- File dependencies that do not exist and invalid file dependency patterns
+- Unknown operating system names in {{c "build"}} and {{c "commands"}}
+- Build and user defined commands without a {{c "cmd"}}
+
+The command fails if one or more problems are found.
 `,
 	"run-in-summary": `Run user defined command`,
 	"run-in": `{{cli "Run user defined command \n"}}
-{{c "mbt run-in branch [name] [--content] [--name <name>] [--fuzzy]"}}{{br}}
+{{c "mbt run-in branch [name] [--content] [--name <name>] [--fuzzy] [--with-dependencies]"}}{{br}}
 Run user defined command in modules in a branch. Assume master if branch name is not specified.
 Consider just the modules matching the {{c "--name"}} filter if specified.
 Default {{c "--name"}} filter is a prefix match. You can change this to a subsequence
 match by using {{c "--fuzzy"}} option.
 
-{{c "mbt run-in commit <commit> [--content] [--name <name>] [--fuzzy]"}}{{br}}
-Run user defined command in modules in a commit. Full commit sha is required.
+{{c "mbt run-in commit <commit> [--content] [--name <name>] [--fuzzy] [--with-dependencies]"}}{{br}}
+Run user defined command in modules in a commit. Commit can be any revision expression (see {{c "mbt --help"}}).
 Consider just the modules modified in the commit when {{c "--content"}} flag is used.
 Consider just the modules matching the {{c "--name"}} filter if specified.
 Default {{c "--name"}} filter is a prefix match. You can change this to a subsequence
 match by using {{c "--fuzzy"}} option.
 
-{{c "mbt run-in diff --from <commit> --to <commit>"}}{{br}}
+{{c "mbt run-in diff --from <commit> --to <commit> [--name <name>] [--fuzzy] [--with-dependencies]"}}{{br}}
 Run user defined command in modules changed between {{c "from"}} and {{c "to"}} commits.
 In this mode, mbt works out the merge base between {{c "from"}} and {{c "to"}} and
 evaluates the modules changed between the merge base and {{c "to"}}.
+A revision range ({{c "<from>..<to>"}} or {{c "<from>...<to>"}}) can be specified in
+{{c "--from"}} instead of using {{c "--to"}}.
+Consider just the changed modules matching the {{c "--name"}} filter if specified.
 
-{{c "mbt run-in head [--content] [--name <name>] [--fuzzy]"}}{{br}}
+{{c "mbt run-in head [--content] [--name <name>] [--fuzzy] [--with-dependencies]"}}{{br}}
 Run user defined command in modules in current head.
 Consider just the modules matching the {{c "--name"}} filter if specified.
 Default {{c "--name"}} filter is a prefix match. You can change this to a subsequence
 match by using {{c "--fuzzy"}} option.
 
-{{c "mbt run-in pr --src <name> --dst <name>"}}{{br}}
+{{c "mbt run-in pr --src <name> --dst <name> [--name <name>] [--fuzzy] [--with-dependencies]"}}{{br}}
 Run user defined command in modules changed between {{c "--src"}} and {{c "--dst"}} branches.
 In this mode, mbt works out the merge base between {{c "--src"}} and {{c "--dst"}} and
 evaluates the modules changed between the merge base and {{c "--src"}}.
+Consider just the changed modules matching the {{c "--name"}} filter if specified.
 
-{{c "mbt run-in local [--all] [--content] [--name <name>] [--fuzzy]"}}{{br}}
+{{c "mbt run-in local [--all] [--content] [--name <name>] [--fuzzy] [--with-dependencies]"}}{{br}}
 Run user defined command in modules modified in current workspace. All modules in the workspace are
 considered if {{c "--all"}} option is specified.
 Consider just the modules matching the {{c "--name"}} filter if specified.
 Default {{c "--name"}} filter is a prefix match. You can change this to a subsequence
 match by using {{c "--fuzzy"}} option.
 
+Use {{c "--filter <expression>"}} option with any of the above commands accepting
+{{c "--name"}} to consider just the modules matching a filter expression
+(see Filter Expressions in {{c "mbt --help"}}).
+
+Use {{c "--module-kind <kind>"}} option with any of the above commands accepting
+{{c "--name"}} to consider just the modules of the specified kind (see Module Kinds
+in {{c "mbt --help"}}). Multiple kinds can be specified as a comma separated string.
+
+{{c "mbt run-in manifest <file>"}}{{br}}
+Run user defined command in the modules in a manifest written by
+{{c "mbt describe ... --manifest-out <file>"}} (see {{c "mbt build manifest"}}).
+
+{{h2 "Output"}}
+Use {{c "--log-prefix"}}, {{c "--log-color"}} and {{c "--log-dir <dir>"}} options to
+prefix the output lines with the module name and to write the output of each module to
+{{c "<dir>/<module>.log"}} (see {{c "mbt build --help"}}).
+
+{{h2 "Isolated Runs"}}
+Use {{c "--isolated"}} option to run the command in a temporary directory containing
+the files of the target commit instead of checking it out in the workspace
+(see {{c "mbt build --help"}}).
+
+{{h2 "Dry Run"}}
+Use {{c "--dry-run"}} option to print the execution plan without checking out the
+commit or running the command. Use {{c "--plan-format json"}} to print the plan in
+json format (see {{c "mbt build --help"}}).
+
+{{h2 "Progress Events"}}
+Use {{c "--events <file>"}} option to write the progress as newline delimited json
+events. Events are the same as the ones emitted by {{c "mbt build"}} (see {{c "mbt build --help"}})
+with {{c "command"}} set to the name of the user defined command.
+
+{{h2 "Reports"}}
+Use {{c "--report <format>=<path>"}} option to write a report of the results in
+{{c "junit"}} or {{c "json"}} format (see {{c "mbt build --help"}}).
+
+{{h2 "Dependencies"}}
+Use {{c "--with-dependencies"}} option along with {{c "--name"}}, {{c "--module-kind"}}
+or {{c "--filter"}} to run the command in the matching modules as well as the modules
+they depend on.
+Commands are executed in the dependency order, so the dependencies of a module
+are always processed before the module itself.
+
+Similarly, use {{c "--dependents"}} option to run the command in the modules
+depending on the matching modules as well.
+
 {{h2 "Execution Environment"}}
 
 When executing a command, following environment variables are initialised and can be
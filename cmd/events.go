@@ -0,0 +1,53 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"os"
+
+	"github.com/mbtproject/mbt/e"
+	"github.com/mbtproject/mbt/lib"
+)
+
+// applyEventsOption configures options to emit the progress events
+// to the destination specified in --events flag.
+// When events are written to stdout, output of the commands is
+// redirected to stderr to keep the event stream parsable.
+// For the same reason, events cannot be written to stdout in a dry run
+// because the plan is written there.
+func applyEventsOption(options *lib.CmdOptions) error {
+	switch events {
+	case "":
+		return nil
+	case "-":
+		if dryRun {
+			return errors.New("--events - cannot be used with --dry-run")
+		}
+		options.Events = lib.NewJSONEventSink(os.Stdout)
+		options.Stdout = os.Stderr
+	default:
+		f, err := os.Create(events)
+		if err != nil {
+			return e.Wrap(lib.ErrClassUser, err)
+		}
+		// mbt exits after running a single command, file is
+		// closed by the os.
+		options.Events = lib.NewJSONEventSink(f)
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mbtproject/mbt/e"
+	"github.com/mbtproject/mbt/lib"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	lintCmd.AddCommand(lintLocalCmd)
+	lintCmd.AddCommand(lintCommitCmd)
+	lintCmd.AddCommand(lintSchemaCmd)
+	RootCmd.AddCommand(lintCmd)
+}
+
+var lintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: docText("lint-summary"),
+	Long:  docText("lint"),
+}
+
+var lintLocalCmd = &cobra.Command{
+	Use: "local",
+	RunE: buildHandler(func(cmd *cobra.Command, args []string) error {
+		return outputLintProblems(system.LintWorkspace())
+	}),
+}
+
+var lintCommitCmd = &cobra.Command{
+	Use: "commit <commit>",
+	RunE: buildHandler(func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return errors.New("requires the commit sha")
+		}
+
+		return outputLintProblems(system.LintCommit(args[0]))
+	}),
+}
+
+var lintSchemaCmd = &cobra.Command{
+	Use: "schema",
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Print(lib.SpecSchema)
+	},
+}
+
+func outputLintProblems(problems []*lib.LintProblem, err error) error {
+	if err != nil {
+		return err
+	}
+
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+
+	if len(problems) > 0 {
+		return e.NewErrorf(lib.ErrClassUser, "%v problem(s) found", len(problems))
+	}
+
+	return nil
+}
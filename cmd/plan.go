@@ -0,0 +1,44 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mbtproject/mbt/lib"
+)
+
+// applyPlanOptions configures dry runs based on --dry-run and
+// --plan-format flags.
+func applyPlanOptions(options *lib.CmdOptions) error {
+	if planFormat != "text" && planFormat != "json" {
+		return fmt.Errorf("invalid plan format %s (expected text or json)", planFormat)
+	}
+
+	options.DryRun = dryRun
+	return nil
+}
+
+// writePlan writes the plan of a dry run to stdout in the
+// format specified by --plan-format.
+func writePlan(plan *lib.Plan) error {
+	if planFormat == "json" {
+		return lib.WriteJSONPlan(os.Stdout, plan)
+	}
+
+	return lib.WritePlan(os.Stdout, plan)
+}
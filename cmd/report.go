@@ -0,0 +1,93 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mbtproject/mbt/e"
+	"github.com/mbtproject/mbt/lib"
+)
+
+// reportOutputTail is the number of bytes of the output retained
+// for each module in reports.
+const reportOutputTail = 64 * 1024
+
+type reportWriter func(w io.Writer, command string, m *lib.Manifest, results []*lib.ModuleResult) error
+
+var reportWriters = map[string]reportWriter{
+	"junit": lib.WriteJUnitReport,
+	"json":  lib.WriteJSONReport,
+}
+
+// applyReportOptions validates --report flags and configures
+// options to retain the output required for the reports.
+func applyReportOptions(options *lib.CmdOptions) error {
+	for _, r := range reports {
+		if _, _, err := parseReport(r); err != nil {
+			return err
+		}
+	}
+
+	if len(reports) > 0 {
+		options.OutputTail = reportOutputTail
+	}
+
+	return nil
+}
+
+// writeReports writes the results of a command to the files
+// specified in --report flags.
+func writeReports(command string, m *lib.Manifest, results []*lib.ModuleResult) error {
+	for _, r := range reports {
+		writer, path, err := parseReport(r)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Create(path)
+		if err != nil {
+			return e.Wrap(lib.ErrClassUser, err)
+		}
+
+		err = writer(f, command, m, results)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+
+		if err != nil {
+			return e.Wrap(lib.ErrClassUser, err)
+		}
+	}
+
+	return nil
+}
+
+func parseReport(value string) (reportWriter, string, error) {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, "", e.NewErrorf(lib.ErrClassUser, "invalid report %v, expected <format>=<path>", value)
+	}
+
+	writer, ok := reportWriters[parts[0]]
+	if !ok {
+		return nil, "", e.NewErrorf(lib.ErrClassUser, "unsupported report format %v (supported formats are junit and json)", parts[0])
+	}
+
+	return writer, parts[1], nil
+}
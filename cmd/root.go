@@ -16,7 +16,9 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"os"
+	"syscall"
 
 	"github.com/mbtproject/mbt/e"
 	"github.com/mbtproject/mbt/lib"
@@ -26,22 +28,38 @@ import (
 
 // Flags available to all commands.
 var (
-	in       string
-	src      string
-	dst      string
-	from     string
-	to       string
-	first    string
-	second   string
-	kind     string
-	name     string
-	command  string
-	all      bool
-	debug    bool
-	content  bool
-	fuzzy    bool
-	failFast bool
-	system   lib.System
+	in               string
+	src              string
+	dst              string
+	from             string
+	to               string
+	first            string
+	second           string
+	kind             string
+	name             string
+	filter           string
+	command          string
+	all              bool
+	debug            bool
+	content          bool
+	fuzzy            bool
+	failFast         bool
+	parallel         int
+	cache            bool
+	cacheDir         string
+	cacheURL         string
+	withDependencies bool
+	events           string
+	reports          []string
+	logPrefix        bool
+	logColor         bool
+	logDir           string
+	dryRun           bool
+	isolated         bool
+	planFormat       string
+	system           lib.System
+	ctx              context.Context
+	stopSignals      context.CancelFunc
 )
 
 func init() {
@@ -75,8 +93,10 @@ var RootCmd = &cobra.Command{
 		if parent != nil && parent.Name() == "run-in" && command == "" {
 			return e.NewError(lib.ErrClassUser, "--command (-m) is not specified")
 		}
-		if parent != nil && parent.Name() == "describe" && dependents && name == "" {
-			return e.NewError(lib.ErrClassUser, "--dependents flag can only be specified with the --name (-n) flag")
+		if parent != nil {
+			if err := checkFilterFlags(parent.Name()); err != nil {
+				return err
+			}
 		}
 
 		level := lib.LogLevelNormal
@@ -85,8 +105,35 @@ var RootCmd = &cobra.Command{
 			level = lib.LogLevelDebug
 		}
 
+		// Forward termination signals to the running commands.
+		// Workspace is restored as usual after they exit.
+		ctx, stopSignals = lib.WithSignals(context.Background(), os.Interrupt, syscall.SIGTERM)
+
 		var err error
 		system, err = lib.NewSystem(in, level)
 		return err
 	},
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		if stopSignals != nil {
+			stopSignals()
+		}
+	},
+}
+
+// checkFilterFlags verifies that the flags expanding the filtered
+// modules are only specified along with a filter.
+func checkFilterFlags(parent string) error {
+	if parent != "describe" && parent != "build" && parent != "run-in" {
+		return nil
+	}
+
+	filtered := name != "" || filter != "" || moduleKind != ""
+	if dependents && !filtered {
+		return e.NewError(lib.ErrClassUser, "--dependents flag can only be specified with the --name (-n), --module-kind or --filter flags")
+	}
+	if parent == "run-in" && withDependencies && !filtered {
+		return e.NewError(lib.ErrClassUser, "--with-dependencies flag can only be specified with the --name (-n), --module-kind or --filter flags")
+	}
+
+	return nil
 }
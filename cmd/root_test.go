@@ -0,0 +1,71 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func resetFilterFlags() {
+	name, filter, moduleKind = "", "", ""
+	dependents, withDependencies = false, false
+}
+
+func TestDependentsFlag(t *testing.T) {
+	defer resetFilterFlags()
+
+	for _, parent := range []string{"describe", "build", "run-in"} {
+		resetFilterFlags()
+		dependents = true
+		assert.EqualError(t, checkFilterFlags(parent), "--dependents flag can only be specified with the --name (-n), --module-kind or --filter flags")
+
+		name = "app-a"
+		assert.NoError(t, checkFilterFlags(parent))
+
+		resetFilterFlags()
+		dependents = true
+		filter = "path=app-a"
+		assert.NoError(t, checkFilterFlags(parent))
+
+		resetFilterFlags()
+		dependents = true
+		moduleKind = "go-service"
+		assert.NoError(t, checkFilterFlags(parent))
+	}
+}
+
+func TestWithDependenciesFlag(t *testing.T) {
+	defer resetFilterFlags()
+
+	resetFilterFlags()
+	withDependencies = true
+	assert.EqualError(t, checkFilterFlags("run-in"), "--with-dependencies flag can only be specified with the --name (-n), --module-kind or --filter flags")
+
+	name = "app-a"
+	assert.NoError(t, checkFilterFlags("run-in"))
+
+	resetFilterFlags()
+	withDependencies = true
+	filter = "path=app-a"
+	assert.NoError(t, checkFilterFlags("run-in"))
+
+	resetFilterFlags()
+	withDependencies = true
+	moduleKind = "go-service"
+	assert.NoError(t, checkFilterFlags("run-in"))
+}
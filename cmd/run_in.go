@@ -17,6 +17,7 @@ package cmd
 
 import (
 	"errors"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 
@@ -28,26 +29,62 @@ import (
 func init() {
 	runIn.PersistentFlags().StringVarP(&command, "command", "m", "", "Command to execute")
 	runIn.PersistentFlags().BoolVarP(&failFast, "fail-fast", "", false, "Fail fast on command failure")
+	runIn.PersistentFlags().BoolVar(&logPrefix, "log-prefix", false, "Prefix each line of the command output with the module name")
+	runIn.PersistentFlags().BoolVar(&logColor, "log-color", false, "Colour the module name prefixes (implies --log-prefix)")
+	runIn.PersistentFlags().StringVar(&logDir, "log-dir", "", "Directory to write the command output of each module (<log-dir>/<module>.log)")
+	runIn.PersistentFlags().BoolVar(&isolated, "isolated", false, "Run in a temporary copy of the target commit instead of checking it out in the workspace")
+	runIn.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Print the execution plan without checking out or running anything")
+	runIn.PersistentFlags().StringVar(&planFormat, "plan-format", "text", "Format of the execution plan printed by --dry-run (text or json)")
+	runIn.PersistentFlags().StringArrayVar(&reports, "report", []string{}, "Write a report of the results to a file (<format>=<path>, format is junit or json). Can be specified multiple times.")
+	runIn.PersistentFlags().StringVar(&events, "events", "", "Write progress events as newline delimited json to a file (- for stdout)")
 
 	runInPr.Flags().StringVar(&src, "src", "", "Source branch")
 	runInPr.Flags().StringVar(&dst, "dst", "", "Destination branch")
-
-	runInDiff.Flags().StringVar(&from, "from", "", "From commit")
+	runInPr.Flags().StringVarP(&name, "name", "n", "", "Build modules with a name that matches this value. Multiple names can be specified as a comma separated string.")
+	runInPr.Flags().BoolVarP(&fuzzy, "fuzzy", "f", false, "Use fuzzy match when filtering")
+	runInPr.Flags().StringVar(&filter, "filter", "", "Filter expression (e.g. 'path=services/** and properties.team=payments')")
+	runInPr.Flags().StringVar(&moduleKind, "module-kind", "", "Run in modules of this kind. Multiple kinds can be specified as a comma separated string.")
+	runInPr.Flags().BoolVar(&withDependencies, "with-dependencies", false, "Include the modules required by the filtered modules")
+	runInPr.Flags().BoolVar(&dependents, "dependents", false, "Include the modules depending on the filtered modules")
+
+	runInDiff.Flags().StringVar(&from, "from", "", "From commit or a revision range (<from>..<to> or <from>...<to>) when --to is omitted")
 	runInDiff.Flags().StringVar(&to, "to", "", "To commit")
+	runInDiff.Flags().StringVarP(&name, "name", "n", "", "Build modules with a name that matches this value. Multiple names can be specified as a comma separated string.")
+	runInDiff.Flags().BoolVarP(&fuzzy, "fuzzy", "f", false, "Use fuzzy match when filtering")
+	runInDiff.Flags().StringVar(&filter, "filter", "", "Filter expression (e.g. 'path=services/** and properties.team=payments')")
+	runInDiff.Flags().StringVar(&moduleKind, "module-kind", "", "Run in modules of this kind. Multiple kinds can be specified as a comma separated string.")
+	runInDiff.Flags().BoolVar(&withDependencies, "with-dependencies", false, "Include the modules required by the filtered modules")
+	runInDiff.Flags().BoolVar(&dependents, "dependents", false, "Include the modules depending on the filtered modules")
 
 	runInLocal.Flags().BoolVarP(&all, "all", "a", false, "All modules")
 	runInLocal.Flags().StringVarP(&name, "name", "n", "", "Build modules with a name that matches this value. Multiple names can be specified as a comma separated string.")
 	runInLocal.Flags().BoolVarP(&fuzzy, "fuzzy", "f", false, "Use fuzzy match when filtering")
+	runInLocal.Flags().StringVar(&filter, "filter", "", "Filter expression (e.g. 'path=services/** and properties.team=payments')")
+	runInLocal.Flags().StringVar(&moduleKind, "module-kind", "", "Run in modules of this kind. Multiple kinds can be specified as a comma separated string.")
+	runInLocal.Flags().BoolVar(&withDependencies, "with-dependencies", false, "Include the modules required by the filtered modules")
+	runInLocal.Flags().BoolVar(&dependents, "dependents", false, "Include the modules depending on the filtered modules")
 
 	runInCommit.Flags().BoolVarP(&content, "content", "c", false, "Build the modules impacted by the content of the commit")
 	runInCommit.Flags().StringVarP(&name, "name", "n", "", "Build modules with a name that matches this value. Multiple names can be specified as a comma separated string.")
 	runInCommit.Flags().BoolVarP(&fuzzy, "fuzzy", "f", false, "Use fuzzy match when filtering")
+	runInCommit.Flags().StringVar(&filter, "filter", "", "Filter expression (e.g. 'path=services/** and properties.team=payments')")
+	runInCommit.Flags().StringVar(&moduleKind, "module-kind", "", "Run in modules of this kind. Multiple kinds can be specified as a comma separated string.")
+	runInCommit.Flags().BoolVar(&withDependencies, "with-dependencies", false, "Include the modules required by the filtered modules")
+	runInCommit.Flags().BoolVar(&dependents, "dependents", false, "Include the modules depending on the filtered modules")
 
 	runInBranch.Flags().StringVarP(&name, "name", "n", "", "Build modules with a name that matches this value. Multiple names can be specified as a comma separated string.")
 	runInBranch.Flags().BoolVarP(&fuzzy, "fuzzy", "f", false, "Use fuzzy match when filtering")
+	runInBranch.Flags().StringVar(&filter, "filter", "", "Filter expression (e.g. 'path=services/** and properties.team=payments')")
+	runInBranch.Flags().StringVar(&moduleKind, "module-kind", "", "Run in modules of this kind. Multiple kinds can be specified as a comma separated string.")
+	runInBranch.Flags().BoolVar(&withDependencies, "with-dependencies", false, "Include the modules required by the filtered modules")
+	runInBranch.Flags().BoolVar(&dependents, "dependents", false, "Include the modules depending on the filtered modules")
 
 	runInHead.Flags().StringVarP(&name, "name", "n", "", "Build modules with a name that matches this value. Multiple names can be specified as a comma separated string.")
 	runInHead.Flags().BoolVarP(&fuzzy, "fuzzy", "f", false, "Use fuzzy match when filtering")
+	runInHead.Flags().StringVar(&filter, "filter", "", "Filter expression (e.g. 'path=services/** and properties.team=payments')")
+	runInHead.Flags().StringVar(&moduleKind, "module-kind", "", "Run in modules of this kind. Multiple kinds can be specified as a comma separated string.")
+	runInHead.Flags().BoolVar(&withDependencies, "with-dependencies", false, "Include the modules required by the filtered modules")
+	runInHead.Flags().BoolVar(&dependents, "dependents", false, "Include the modules depending on the filtered modules")
 
 	runIn.AddCommand(runInBranch)
 	runIn.AddCommand(runInPr)
@@ -55,31 +92,47 @@ func init() {
 	runIn.AddCommand(runInHead)
 	runIn.AddCommand(runInCommit)
 	runIn.AddCommand(runInLocal)
+	runIn.AddCommand(runInManifest)
 	RootCmd.AddCommand(runIn)
 }
 
 var runInHead = &cobra.Command{
 	Use: "head",
 	RunE: buildHandler(func(cmd *cobra.Command, args []string) error {
-		return summariseRun(system.RunInCurrentBranch(command, &lib.FilterOptions{Name: name, Fuzzy: fuzzy}, runInCmdOptions()))
+		options, err := runInCmdOptions()
+		if err != nil {
+			return err
+		}
+
+		return summariseRun(system.RunInCurrentBranch(command, &lib.FilterOptions{Name: name, Fuzzy: fuzzy, Kind: moduleKind, Expression: filter, Dependents: dependents, Dependencies: withDependencies}, options))
 	}),
 }
 
 var runInBranch = &cobra.Command{
 	Use: "branch <branch>",
 	RunE: buildHandler(func(cmd *cobra.Command, args []string) error {
+		options, err := runInCmdOptions()
+		if err != nil {
+			return err
+		}
+
 		branch := "master"
 		if len(args) > 0 {
 			branch = args[0]
 		}
 
-		return summariseRun(system.RunInBranch(command, branch, &lib.FilterOptions{Name: name, Fuzzy: fuzzy}, runInCmdOptions()))
+		return summariseRun(system.RunInBranch(command, branch, &lib.FilterOptions{Name: name, Fuzzy: fuzzy, Kind: moduleKind, Expression: filter, Dependents: dependents, Dependencies: withDependencies}, options))
 	}),
 }
 
 var runInPr = &cobra.Command{
 	Use: "pr --src <branch> --dst <branch>",
 	RunE: buildHandler(func(cmd *cobra.Command, args []string) error {
+		options, err := runInCmdOptions()
+		if err != nil {
+			return err
+		}
+
 		if src == "" {
 			return errors.New("requires source")
 		}
@@ -88,28 +141,38 @@ var runInPr = &cobra.Command{
 			return errors.New("requires dest")
 		}
 
-		return summariseRun(system.RunInPr(command, src, dst, runInCmdOptions()))
+		return summariseRun(system.RunInPr(command, src, dst, &lib.FilterOptions{Name: name, Fuzzy: fuzzy, Kind: moduleKind, Expression: filter, Dependents: dependents, Dependencies: withDependencies}, options))
 	}),
 }
 
 var runInDiff = &cobra.Command{
 	Use: "diff --from <sha> --to <sha>",
 	RunE: buildHandler(func(cmd *cobra.Command, args []string) error {
+		options, err := runInCmdOptions()
+		if err != nil {
+			return err
+		}
+
 		if from == "" {
 			return errors.New("requires from commit")
 		}
 
-		if to == "" {
+		if to == "" && !strings.Contains(from, "..") {
 			return errors.New("requires to commit")
 		}
 
-		return summariseRun(system.RunInDiff(command, from, to, runInCmdOptions()))
+		return summariseRun(system.RunInDiff(command, from, to, &lib.FilterOptions{Name: name, Fuzzy: fuzzy, Kind: moduleKind, Expression: filter, Dependents: dependents, Dependencies: withDependencies}, options))
 	}),
 }
 
 var runInCommit = &cobra.Command{
 	Use: "commit <sha>",
 	RunE: buildHandler(func(cmd *cobra.Command, args []string) error {
+		options, err := runInCmdOptions()
+		if err != nil {
+			return err
+		}
+
 		if len(args) == 0 {
 			return errors.New("requires the commit sha")
 		}
@@ -117,20 +180,41 @@ var runInCommit = &cobra.Command{
 		commit := args[0]
 
 		if content {
-			return summariseRun(system.RunInCommitContent(command, commit, runInCmdOptions()))
+			return summariseRun(system.RunInCommitContent(command, commit, &lib.FilterOptions{Name: name, Fuzzy: fuzzy, Kind: moduleKind, Expression: filter, Dependents: dependents, Dependencies: withDependencies}, options))
 		}
-		return summariseRun(system.RunInCommit(command, commit, &lib.FilterOptions{Name: name, Fuzzy: fuzzy}, runInCmdOptions()))
+		return summariseRun(system.RunInCommit(command, commit, &lib.FilterOptions{Name: name, Fuzzy: fuzzy, Kind: moduleKind, Expression: filter, Dependents: dependents, Dependencies: withDependencies}, options))
 	}),
 }
 
 var runInLocal = &cobra.Command{
 	Use: "local [--all]",
 	RunE: buildHandler(func(cmd *cobra.Command, args []string) error {
-		if all || name != "" {
-			return summariseRun(system.RunInWorkspace(command, &lib.FilterOptions{Name: name, Fuzzy: fuzzy}, runInCmdOptions()))
+		options, err := runInCmdOptions()
+		if err != nil {
+			return err
 		}
 
-		return summariseRun(system.RunInWorkspaceChanges(command, runInCmdOptions()))
+		if all || name != "" || filter != "" || moduleKind != "" {
+			return summariseRun(system.RunInWorkspace(command, &lib.FilterOptions{Name: name, Fuzzy: fuzzy, Kind: moduleKind, Expression: filter, Dependents: dependents, Dependencies: withDependencies}, options))
+		}
+
+		return summariseRun(system.RunInWorkspaceChanges(command, &lib.FilterOptions{Name: name, Fuzzy: fuzzy, Kind: moduleKind, Expression: filter, Dependents: dependents, Dependencies: withDependencies}, options))
+	}),
+}
+
+var runInManifest = &cobra.Command{
+	Use: "manifest <file>",
+	RunE: buildHandler(func(cmd *cobra.Command, args []string) error {
+		options, err := runInCmdOptions()
+		if err != nil {
+			return err
+		}
+
+		if len(args) == 0 {
+			return errors.New("requires the manifest file")
+		}
+
+		return summariseRun(system.RunInManifestFile(command, args[0], options))
 	}),
 }
 
@@ -146,13 +230,24 @@ func runCmdStageCB(a *lib.Module, s lib.CmdStage, err error) {
 }
 
 func summariseRun(summary *lib.RunResult, err error) error {
-	if err == nil {
+	if err == nil && summary.Plan != nil {
+		return writePlan(summary.Plan)
+	}
+
+	if summary != nil {
 		logrus.Infof("Modules: %v Success: %v Failed: %v Skipped: %v",
 			len(summary.Manifest.Modules),
 			len(summary.Completed),
 			len(summary.Failures),
 			len(summary.Skipped))
 
+		rerr := writeReports(command, summary.Manifest, summary.Results)
+		if err == nil {
+			err = rerr
+		}
+	}
+
+	if err == nil {
 		logrus.Infof("Build finished for commit %v", summary.Manifest.Sha)
 
 		if len(summary.Failures) > 0 && failFast {
@@ -162,10 +257,28 @@ func summariseRun(summary *lib.RunResult, err error) error {
 	return err
 }
 
-func runInCmdOptions() *lib.CmdOptions {
+func runInCmdOptions() (*lib.CmdOptions, error) {
 	options := lib.CmdOptionsWithStdIO(runCmdStageCB)
 	options.FailFast = failFast
-	return options
+	options.Context = ctx
+	options.Isolated = isolated
+	applyOutputOptions(options)
+	err := applyPlanOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	err = applyReportOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	err = applyEventsOption(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return options, nil
 }
 
 var runIn = &cobra.Command{
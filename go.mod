@@ -5,18 +5,19 @@ go 1.15
 require (
 	github.com/cpuguy83/go-md2man v1.0.7
 	github.com/davecgh/go-spew v1.1.1
+	github.com/go-git/go-git/v5 v5.12.0
 	github.com/go-yaml/yaml v2.1.0+incompatible
 	github.com/inconshreveable/mousetrap v1.0.0
 	github.com/libgit2/git2go/v28 v28.8.6
 	github.com/mattn/goveralls v0.0.7 // indirect
 	github.com/pmezard/go-difflib v1.0.0
 	github.com/russross/blackfriday v0.0.0-20170728175326-4048872b16cc
-	github.com/sirupsen/logrus v1.7.0
+	github.com/sirupsen/logrus v1.9.0
 	github.com/spf13/cobra v1.1.1
 	github.com/spf13/pflag v1.0.5
-	github.com/stretchr/testify v1.7.0
-	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
-	golang.org/x/sys v0.0.0-20210119212857-b64e53b001e4
-	golang.org/x/tools v0.1.0 // indirect
-	gopkg.in/yaml.v2 v2.2.8
+	github.com/stretchr/testify v1.9.0
+	golang.org/x/crypto v0.21.0
+	golang.org/x/sys v0.18.0
+	gopkg.in/yaml.v2 v2.4.0
+	gopkg.in/yaml.v3 v3.0.1
 )
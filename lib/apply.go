@@ -82,7 +82,7 @@ func (s *stdSystem) ApplyBranch(templatePath, branch string, output io.Writer) e
 }
 
 func (s *stdSystem) ApplyCommit(commit string, templatePath string, output io.Writer) error {
-	c, err := s.Repo.GetCommit(commit)
+	c, err := s.Repo.ResolveRevision(commit)
 	if err != nil {
 		return err
 	}
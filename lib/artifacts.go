@@ -0,0 +1,185 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mbtproject/mbt/e"
+)
+
+// archiveArtifacts writes a gzipped tar of the files in dir matching
+// the specified glob patterns to w.
+// Directories matched by a pattern are archived recursively.
+func archiveArtifacts(dir string, patterns []string, w io.Writer) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	err := writeArtifacts(dir, patterns, tw)
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = gw.Close()
+	}
+
+	if err != nil {
+		return e.Wrapf(ErrClassInternal, err, msgFailedArtifactsArchive, dir)
+	}
+
+	return nil
+}
+
+func writeArtifacts(dir string, patterns []string, tw *tar.Writer) error {
+	seen := make(map[string]bool)
+	for _, p := range patterns {
+		matches, err := filepath.Glob(filepath.Join(dir, filepath.FromSlash(p)))
+		if err != nil {
+			return err
+		}
+
+		for _, match := range matches {
+			err = filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+
+				rel, err := filepath.Rel(dir, path)
+				if err != nil {
+					return err
+				}
+
+				name := filepath.ToSlash(rel)
+				if seen[name] {
+					return nil
+				}
+				seen[name] = true
+
+				return writeArtifact(tw, path, name, info)
+			})
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeArtifact(tw *tar.Writer, path, name string, info os.FileInfo) error {
+	if !info.IsDir() && !info.Mode().IsRegular() {
+		// Symlinks and other special files are not supported.
+		return nil
+	}
+
+	h, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+
+	h.Name = name
+	if info.IsDir() {
+		h.Name += "/"
+	}
+
+	err = tw.WriteHeader(h)
+	if err != nil || info.IsDir() {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// restoreArtifacts extracts a gzipped tar created by archiveArtifacts
+// into dir.
+func restoreArtifacts(dir string, r io.Reader) error {
+	err := extractArtifacts(dir, r)
+	if err != nil {
+		return e.Wrapf(ErrClassInternal, err, msgFailedArtifactsRestore, dir)
+	}
+
+	return nil
+}
+
+func extractArtifacts(dir string, r io.Reader) error {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// Reject the entries that would be extracted outside dir.
+		name := filepath.Clean(filepath.FromSlash(h.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return e.NewErrorf(ErrClassInternal, msgInvalidArtifactPath, h.Name)
+		}
+
+		target := filepath.Join(dir, name)
+		switch h.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeReg:
+			err = extractArtifact(tr, target, os.FileMode(h.Mode))
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func extractArtifact(r io.Reader, target string, mode os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode.Perm())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
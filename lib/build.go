@@ -16,16 +16,13 @@ limitations under the License.
 package lib
 
 import (
+	"io"
+	"path/filepath"
 	"runtime"
 
-	git "github.com/libgit2/git2go/v28"
 	"github.com/mbtproject/mbt/e"
 )
 
-var defaultCheckoutOptions = &git.CheckoutOpts{
-	Strategy: git.CheckoutSafe,
-}
-
 func (s *stdSystem) BuildBranch(name string, filterOptions *FilterOptions, options *CmdOptions) (*BuildSummary, error) {
 	m, err := s.ManifestByBranch(name)
 	if err != nil {
@@ -40,21 +37,31 @@ func (s *stdSystem) BuildBranch(name string, filterOptions *FilterOptions, optio
 	return s.checkoutAndBuildManifest(m, options)
 }
 
-func (s *stdSystem) BuildPr(src, dst string, options *CmdOptions) (*BuildSummary, error) {
+func (s *stdSystem) BuildPr(src, dst string, filterOptions *FilterOptions, options *CmdOptions) (*BuildSummary, error) {
 	m, err := s.ManifestByPr(src, dst)
 	if err != nil {
 		return nil, err
 	}
 
+	m, err = m.ApplyFilters(filterOptions)
+	if err != nil {
+		return nil, err
+	}
+
 	return s.checkoutAndBuildManifest(m, options)
 }
 
-func (s *stdSystem) BuildDiff(from, to string, options *CmdOptions) (*BuildSummary, error) {
+func (s *stdSystem) BuildDiff(from, to string, filterOptions *FilterOptions, options *CmdOptions) (*BuildSummary, error) {
 	m, err := s.ManifestByDiff(from, to)
 	if err != nil {
 		return nil, err
 	}
 
+	m, err = m.ApplyFilters(filterOptions)
+	if err != nil {
+		return nil, err
+	}
+
 	return s.checkoutAndBuildManifest(m, options)
 }
 
@@ -86,12 +93,17 @@ func (s *stdSystem) BuildCommit(commit string, filterOptions *FilterOptions, opt
 	return s.checkoutAndBuildManifest(m, options)
 }
 
-func (s *stdSystem) BuildCommitContent(commit string, options *CmdOptions) (*BuildSummary, error) {
+func (s *stdSystem) BuildCommitContent(commit string, filterOptions *FilterOptions, options *CmdOptions) (*BuildSummary, error) {
 	m, err := s.ManifestByCommitContent(commit)
 	if err != nil {
 		return nil, err
 	}
 
+	m, err = m.ApplyFilters(filterOptions)
+	if err != nil {
+		return nil, err
+	}
+
 	return s.checkoutAndBuildManifest(m, options)
 }
 
@@ -109,59 +121,196 @@ func (s *stdSystem) BuildWorkspace(filterOptions *FilterOptions, options *CmdOpt
 	return s.buildManifest(m, options)
 }
 
-func (s *stdSystem) BuildWorkspaceChanges(options *CmdOptions) (*BuildSummary, error) {
+func (s *stdSystem) BuildWorkspaceChanges(filterOptions *FilterOptions, options *CmdOptions) (*BuildSummary, error) {
 	m, err := s.ManifestByWorkspaceChanges()
 	if err != nil {
 		return nil, err
 	}
 
+	m, err = m.ApplyFilters(filterOptions)
+	if err != nil {
+		return nil, err
+	}
+
 	return s.buildManifest(m, options)
 }
 
+func (s *stdSystem) BuildManifestFile(path string, options *CmdOptions) (*BuildSummary, error) {
+	m, err := s.ManifestByFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Sha == WorkspaceSha {
+		return s.buildManifest(m, options)
+	}
+
+	return s.checkoutAndBuildManifest(m, options)
+}
+
 func (s *stdSystem) checkoutAndBuildManifest(m *Manifest, options *CmdOptions) (*BuildSummary, error) {
-	r, err := s.WorkspaceManager.CheckoutAndRun(m.Sha, func() (interface{}, error) {
+	if options.DryRun {
+		// Plans are derived from the manifest, there's no need to checkout.
+		return s.buildManifest(m, options)
+	}
+
+	r, err := s.checkoutAndRun(m, options, func(m *Manifest) (interface{}, error) {
 		return s.buildManifest(m, options)
 	})
 
-	if err != nil {
-		return nil, err
+	// Parallel builds return the summary along with the error
+	// so that callers could find out about the failed and
+	// cancelled modules.
+	summary, _ := r.(*BuildSummary)
+	return summary, err
+}
+
+func (s *stdSystem) buildManifest(m *Manifest, options *CmdOptions) (*BuildSummary, error) {
+	if options.DryRun {
+		return &BuildSummary{Manifest: m, Plan: s.planBuild(m, options)}, nil
 	}
 
-	return r.(*BuildSummary), nil
+	t := s.newStageTracker(buildCommand, m, options)
+	t.begin()
+
+	var summary *BuildSummary
+	var err error
+	if options.Concurrency > 1 {
+		summary, err = s.buildManifestParallel(m, options, t)
+	} else {
+		summary, err = s.buildManifestSerial(m, options, t)
+	}
+
+	summary.Results = t.moduleResults()
+	t.end(err)
+	return summary, err
 }
 
-func (s *stdSystem) buildManifest(m *Manifest, options *CmdOptions) (*BuildSummary, error) {
+// buildManifestSerial builds the modules in a manifest one after the other.
+// Build stops at the first failure and the remaining modules are reported
+// in BuildSummary.Cancelled.
+func (s *stdSystem) buildManifestSerial(m *Manifest, options *CmdOptions, t *stageTracker) (*BuildSummary, error) {
 	completed := make([]*BuildResult, 0)
 	skipped := make([]*Module, 0)
+	cached := make([]*Module, 0)
+	failures := make([]*CmdFailure, 0)
+	cancelled := make([]*Module, 0)
 
+	var err error
 	for _, a := range m.Modules {
+		if err != nil {
+			cancelled = append(cancelled, a)
+			t.cancelled(a)
+			continue
+		}
+
 		cmd, ok := s.canBuildHere(a)
 		if !ok {
 			skipped = append(skipped, a)
-			options.Callback(a, CmdStageSkipBuild, nil)
+			t.skipped(a, buildSkipReason(a))
 			continue
 		}
 
-		options.Callback(a, CmdStageBeforeBuild, nil)
-		err := s.execBuild(cmd, m, a, options)
+		if s.isCached(m, a, options) {
+			cached = append(cached, a)
+			t.notify(a, CmdStageCachedBuild, nil)
+			continue
+		}
+
+		t.notify(a, CmdStageBeforeBuild, nil)
+		err = s.execBuild(cmd, m, a, t.capture(a, options))
 		if err != nil {
-			return nil, err
+			failures = append(failures, &CmdFailure{Module: a, Err: err})
+			t.notify(a, CmdStageFailedBuild, err)
+			continue
 		}
-		options.Callback(a, CmdStageAfterBuild, nil)
+		s.recordBuild(m, a, options)
+		t.notify(a, CmdStageAfterBuild, nil)
 		completed = append(completed, &BuildResult{Module: a})
 	}
 
-	return &BuildSummary{Manifest: m, Completed: completed, Skipped: skipped}, nil
+	summary := &BuildSummary{
+		Manifest:  m,
+		Completed: completed,
+		Skipped:   skipped,
+		Cached:    cached,
+		Failures:  failures,
+		Cancelled: cancelled,
+	}
+
+	return summary, err
 }
 
 func (s *stdSystem) execBuild(buildCmd *Cmd, manifest *Manifest, module *Module, options *CmdOptions) error {
-	err := s.ProcessManager.Exec(manifest, module, options, buildCmd.Cmd, buildCmd.Args...)
+	err := s.execWithRetries(manifest, module, options, buildCmd.Timeout, buildCmd.Retries, buildCmd.Cmd, buildCmd.Args...)
 	if err != nil {
 		return e.Wrapf(ErrClassUser, err, msgFailedBuild, module.Name())
 	}
 	return nil
 }
 
+// cacheVersion returns the version of a module used in the build cache.
+// Build commands are operating system specific, therefore, builds on
+// different platforms are recorded separately.
+func cacheVersion(mod *Module) string {
+	return mod.Version() + "-" + runtime.GOOS
+}
+
+// isCached returns true if the build cache contains a successful
+// build of the module's current version.
+// If the module declares artifacts, they are restored into the module
+// directory.
+// Cache errors are not fatal, we simply fall back to building the module.
+func (s *stdSystem) isCached(m *Manifest, mod *Module, options *CmdOptions) bool {
+	ok := s.hasCachedBuild(mod, options)
+	if !ok || len(mod.Artifacts()) == 0 {
+		return ok
+	}
+
+	r, err := options.Cache.Get(mod.Name(), cacheVersion(mod))
+	if err != nil {
+		s.Log.Warnf(msgCacheLookupFailed, mod.Name(), err)
+		return false
+	}
+	defer r.Close()
+
+	err = restoreArtifacts(filepath.Join(m.Dir, mod.Path()), r)
+	if err != nil {
+		s.Log.Warnf(msgCacheRestoreFailed, mod.Name(), err)
+		return false
+	}
+
+	return true
+}
+
+// recordBuild records a successful build of the module in the build cache
+// along with its artifacts.
+func (s *stdSystem) recordBuild(m *Manifest, mod *Module, options *CmdOptions) {
+	if options.Cache == nil {
+		return
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(archiveArtifacts(filepath.Join(m.Dir, mod.Path()), mod.Artifacts(), pw))
+	}()
+
+	err := options.Cache.Put(mod.Name(), cacheVersion(mod), pr)
+	// Unblock the archiver if the cache stopped reading early.
+	pr.Close()
+	if err != nil {
+		s.Log.Warnf(msgCacheUpdateFailed, mod.Name(), err)
+	}
+}
+
+func buildSkipReason(mod *Module) SkipReason {
+	if len(mod.Build()) == 0 {
+		return SkipReasonNoCommand
+	}
+
+	return SkipReasonUnsupportedOS
+}
+
 func (s *stdSystem) canBuildHere(mod *Module) (*Cmd, bool) {
 	c, ok := mod.Build()[runtime.GOOS]
 
@@ -0,0 +1,209 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"io"
+	"sync"
+
+	"github.com/mbtproject/mbt/e"
+)
+
+// buildJob is a unit of work handed over to a build worker.
+type buildJob struct {
+	module  *Module
+	cmd     *Cmd
+	options *CmdOptions
+	err     error
+}
+
+// syncWriter serialises the writes to an underlying writer.
+// It's used to share the stdout/stderr streams between
+// build commands executed concurrently.
+type syncWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+// buildManifestParallel builds the modules in a manifest with a pool of
+// workers.
+// A module is scheduled as soon as all the modules it requires (within
+// the manifest) are either built, skipped or found in the build cache.
+// When a module fails, the modules depending on it are never started
+// and reported in BuildSummary.Cancelled. Modules that do not depend
+// on the failed module continue to build.
+// When options.Context is done, modules that are not started yet are
+// reported in BuildSummary.Cancelled and the build fails.
+func (s *stdSystem) buildManifestParallel(m *Manifest, options *CmdOptions, t *stageTracker) (*BuildSummary, error) {
+	completed := make([]*BuildResult, 0)
+	skipped := make([]*Module, 0)
+	cached := make([]*Module, 0)
+	failures := make([]*CmdFailure, 0)
+	cancelled := make([]*Module, 0)
+
+	workers := options.Concurrency
+	if workers > len(m.Modules) {
+		workers = len(m.Modules)
+	}
+
+	mu := &sync.Mutex{}
+	workerOptions := *options
+	if options.Stdout != nil {
+		workerOptions.Stdout = &syncWriter{mu: mu, w: options.Stdout}
+	}
+	if options.Stderr != nil {
+		workerOptions.Stderr = &syncWriter{mu: mu, w: options.Stderr}
+	}
+
+	jobs := make(chan *buildJob)
+	results := make(chan *buildJob, workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for j := range jobs {
+				j.err = s.execBuild(j.cmd, m, j.module, j.options)
+				if j.err == nil {
+					// Recorded here rather than in the scheduler so that
+					// slow cache uploads do not delay the other modules.
+					s.recordBuild(m, j.module, options)
+				}
+				results <- j
+			}
+		}()
+	}
+	defer close(jobs)
+
+	// Track the number of unfinished dependencies of each module.
+	// Dependencies that are not part of the manifest (e.g. due to filtering)
+	// are not considered.
+	inManifest := m.Modules.indexByName()
+	pending := make(map[string]int)
+	queue := make(Modules, 0)
+	for _, a := range m.Modules {
+		n := 0
+		for _, r := range a.Requires() {
+			if _, ok := inManifest[r.Name()]; ok {
+				n++
+			}
+		}
+
+		pending[a.Name()] = n
+		if n == 0 {
+			queue = append(queue, a)
+		}
+	}
+
+	release := func(mod *Module) {
+		for _, d := range mod.RequiredBy() {
+			if _, ok := inManifest[d.Name()]; !ok {
+				continue
+			}
+
+			pending[d.Name()]--
+			if pending[d.Name()] == 0 {
+				queue = append(queue, d)
+			}
+		}
+	}
+
+	finished := make(map[string]bool)
+	running := 0
+	for len(queue) > 0 || running > 0 {
+		// Stop scheduling new modules once the build is cancelled.
+		// Modules left in the queue are reported as cancelled.
+		if options.context().Err() != nil {
+			queue = queue[:0]
+		}
+
+		for len(queue) > 0 && running < workers {
+			a := queue[0]
+			queue = queue[1:]
+
+			cmd, ok := s.canBuildHere(a)
+			if !ok {
+				skipped = append(skipped, a)
+				finished[a.Name()] = true
+				t.skipped(a, buildSkipReason(a))
+				release(a)
+				continue
+			}
+
+			if s.isCached(m, a, options) {
+				cached = append(cached, a)
+				finished[a.Name()] = true
+				t.notify(a, CmdStageCachedBuild, nil)
+				release(a)
+				continue
+			}
+
+			t.notify(a, CmdStageBeforeBuild, nil)
+			jobs <- &buildJob{module: a, cmd: cmd, options: t.capture(a, &workerOptions)}
+			running++
+		}
+
+		if running == 0 {
+			continue
+		}
+
+		j := <-results
+		running--
+		finished[j.module.Name()] = true
+
+		if j.err != nil {
+			failures = append(failures, &CmdFailure{Module: j.module, Err: j.err})
+			t.notify(j.module, CmdStageFailedBuild, j.err)
+			continue
+		}
+
+		t.notify(j.module, CmdStageAfterBuild, nil)
+		completed = append(completed, &BuildResult{Module: j.module})
+		release(j.module)
+	}
+
+	// Scheduling only stops due to failures or cancellation. Therefore,
+	// anything left behind is either a dependent of a failed module or
+	// never started due to cancellation.
+	for _, a := range m.Modules {
+		if !finished[a.Name()] {
+			cancelled = append(cancelled, a)
+			t.cancelled(a)
+		}
+	}
+
+	summary := &BuildSummary{
+		Manifest:  m,
+		Completed: completed,
+		Skipped:   skipped,
+		Cached:    cached,
+		Failures:  failures,
+		Cancelled: cancelled,
+	}
+
+	if len(failures) > 0 {
+		return summary, failures[0].Err
+	}
+
+	if err := options.context().Err(); err != nil && len(cancelled) > 0 {
+		return summary, e.Wrapf(ErrClassUser, err, msgBuildCancelled, len(cancelled))
+	}
+
+	return summary, nil
+}
@@ -17,13 +17,18 @@ package lib
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	git "github.com/libgit2/git2go/v28"
 	"github.com/mbtproject/mbt/e"
@@ -107,13 +112,13 @@ func TestBuildSkip(t *testing.T) {
 	case "linux", "darwin":
 		check(t, repo.InitModuleWithOptions("app-a", &Spec{
 			Name:  "app-a",
-			Build: map[string]*Cmd{"windows": {"powershell", []string{"-ExecutionPolicy", "Bypass", "-File", ".\\build.ps1"}}},
+			Build: map[string]*Cmd{"windows": {Cmd: "powershell", Args: []string{"-ExecutionPolicy", "Bypass", "-File", ".\\build.ps1"}}},
 		}))
 		check(t, repo.WritePowershellScript("app-a/build.ps1", "write-host built app-a"))
 	case "windows":
 		check(t, repo.InitModuleWithOptions("app-a", &Spec{
 			Name:  "app-a",
-			Build: map[string]*Cmd{"darwin": {"./build.sh", []string{}}},
+			Build: map[string]*Cmd{"darwin": {Cmd: "./build.sh", Args: []string{}}},
 		}))
 		check(t, repo.WriteShellScript("app-a/build.sh", "echo built app-a"))
 	}
@@ -171,6 +176,70 @@ func TestBuildBranch(t *testing.T) {
 	assert.Equal(t, "built app-a\nbuilt app-b\n", buff.String())
 }
 
+func TestBuildCurrentBranchWithKindFilter(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.WriteContent(defaultsFileName, "kinds:\n  go-service:\n    properties:\n      owner: backend\n"))
+	check(t, repo.InitModule("app-a"))
+	check(t, repo.WriteShellScript("app-a/build.sh", "echo built app-a"))
+	check(t, repo.WritePowershellScript("app-a/build.ps1", "write-host built app-a"))
+
+	check(t, repo.InitModuleWithOptions("app-b", &Spec{
+		Name: "app-b",
+		Kind: "go-service",
+		Build: map[string]*Cmd{
+			"darwin":  {Cmd: "./build.sh", Args: []string{}},
+			"linux":   {Cmd: "./build.sh", Args: []string{}},
+			"windows": {Cmd: "powershell", Args: []string{"-ExecutionPolicy", "Bypass", "-File", ".\\build.ps1"}},
+		},
+	}))
+	check(t, repo.WriteShellScript("app-b/build.sh", "echo built app-b"))
+	check(t, repo.WritePowershellScript("app-b/build.ps1", "write-host built app-b"))
+	check(t, repo.Commit("first"))
+
+	buff := new(bytes.Buffer)
+	_, err := NewWorld(t, ".tmp/repo").System.BuildCurrentBranch(&FilterOptions{Kind: "go-service"}, stdTestCmdOptions(buff))
+	check(t, err)
+
+	assert.Equal(t, "built app-b\n", buff.String())
+}
+
+func TestBuildManifestFile(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.InitModule("app-a"))
+	check(t, repo.WriteShellScript("app-a/build.sh", "echo built app-a"))
+	check(t, repo.WritePowershellScript("app-a/build.ps1", "write-host built app-a"))
+	check(t, repo.InitModule("app-b"))
+	check(t, repo.WriteShellScript("app-b/build.sh", "echo built app-b"))
+	check(t, repo.WritePowershellScript("app-b/build.ps1", "write-host built app-b"))
+	check(t, repo.Commit("first"))
+
+	m, err := NewWorld(t, ".tmp/repo").System.ManifestByCurrentBranch()
+	check(t, err)
+	m, err = m.ApplyFilters(&FilterOptions{Name: "app-b"})
+	check(t, err)
+
+	f, err := os.Create(".tmp/manifest.json")
+	check(t, err)
+	check(t, WriteManifest(f, m))
+	check(t, f.Close())
+
+	check(t, repo.WriteShellScript("app-b/build.sh", "echo built app-b again"))
+	check(t, repo.WritePowershellScript("app-b/build.ps1", "write-host built app-b again"))
+	check(t, repo.Commit("second"))
+
+	buff := new(bytes.Buffer)
+	summary, err := NewWorld(t, ".tmp/repo").System.BuildManifestFile(".tmp/manifest.json", stdTestCmdOptions(buff))
+	check(t, err)
+
+	assert.Equal(t, "built app-b\n", buff.String())
+	assert.Equal(t, m.Sha, summary.Manifest.Sha)
+	assert.Len(t, summary.Completed, 1)
+}
+
 func TestBuildDiff(t *testing.T) {
 	clean()
 	repo := NewTestRepo(t, ".tmp/repo")
@@ -190,18 +259,80 @@ func TestBuildDiff(t *testing.T) {
 	c2 := repo.LastCommit
 
 	buff := new(bytes.Buffer)
-	_, err := NewWorld(t, ".tmp/repo").System.BuildDiff(c1.String(), c2.String(), stdTestCmdOptions(buff))
+	_, err := NewWorld(t, ".tmp/repo").System.BuildDiff(c1.String(), c2.String(), NoFilter, stdTestCmdOptions(buff))
 	check(t, err)
 
 	assert.Equal(t, "built app-b\n", buff.String())
 
 	buff = new(bytes.Buffer)
-	_, err = NewWorld(t, ".tmp/repo").System.BuildDiff(c2.String(), c1.String(), stdTestCmdOptions(buff))
+	_, err = NewWorld(t, ".tmp/repo").System.BuildDiff(c2.String(), c1.String(), NoFilter, stdTestCmdOptions(buff))
 	check(t, err)
 
 	assert.Equal(t, "", buff.String())
 }
 
+func TestBuildDiffWithNameFilter(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.InitModule("app-a"))
+	check(t, repo.WriteShellScript("app-a/build.sh", "echo built app-a"))
+	check(t, repo.WritePowershellScript("app-a/build.ps1", "write-host built app-a"))
+	check(t, repo.Commit("first"))
+	c1 := repo.LastCommit
+
+	check(t, repo.WriteContent("app-a/foo", "bar"))
+	check(t, repo.InitModule("app-b"))
+	check(t, repo.WriteShellScript("app-b/build.sh", "echo built app-b"))
+	check(t, repo.WritePowershellScript("app-b/build.ps1", "write-host built app-b"))
+	check(t, repo.Commit("second"))
+	c2 := repo.LastCommit
+
+	buff := new(bytes.Buffer)
+	_, err := NewWorld(t, ".tmp/repo").System.BuildDiff(c1.String(), c2.String(), ExactMatchFilter("app-a"), stdTestCmdOptions(buff))
+	check(t, err)
+
+	assert.Equal(t, "built app-a\n", buff.String())
+}
+
+func TestBuildDiffWithDependents(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.InitModule("app-a"))
+	check(t, repo.WriteShellScript("app-a/build.sh", "echo built app-a"))
+	check(t, repo.WritePowershellScript("app-a/build.ps1", "write-host built app-a"))
+
+	check(t, repo.InitModuleWithOptions("app-b", &Spec{
+		Name: "app-b",
+		Build: map[string]*Cmd{
+			"darwin":  {Cmd: "./build.sh", Args: []string{}},
+			"linux":   {Cmd: "./build.sh", Args: []string{}},
+			"windows": {Cmd: "powershell", Args: []string{"-ExecutionPolicy", "Bypass", "-File", ".\\build.ps1"}},
+		},
+		Dependencies: []string{"app-a"},
+	}))
+	check(t, repo.WriteShellScript("app-b/build.sh", "echo built app-b"))
+	check(t, repo.WritePowershellScript("app-b/build.ps1", "write-host built app-b"))
+
+	check(t, repo.InitModule("app-c"))
+	check(t, repo.WriteShellScript("app-c/build.sh", "echo built app-c"))
+	check(t, repo.WritePowershellScript("app-c/build.ps1", "write-host built app-c"))
+	check(t, repo.Commit("first"))
+	c1 := repo.LastCommit
+
+	check(t, repo.WriteContent("app-a/foo", "bar"))
+	check(t, repo.WriteContent("app-c/foo", "bar"))
+	check(t, repo.Commit("second"))
+	c2 := repo.LastCommit
+
+	buff := new(bytes.Buffer)
+	_, err := NewWorld(t, ".tmp/repo").System.BuildDiff(c1.String(), c2.String(), &FilterOptions{Name: "app-a", Dependents: true}, stdTestCmdOptions(buff))
+	check(t, err)
+
+	assert.Equal(t, "built app-a\nbuilt app-b\n", buff.String())
+}
+
 func TestBuildPr(t *testing.T) {
 	clean()
 	repo := NewTestRepo(t, ".tmp/repo")
@@ -219,18 +350,83 @@ func TestBuildPr(t *testing.T) {
 	check(t, repo.Commit("second"))
 
 	buff := new(bytes.Buffer)
-	_, err := NewWorld(t, ".tmp/repo").System.BuildPr("feature", "master", stdTestCmdOptions(buff))
+	_, err := NewWorld(t, ".tmp/repo").System.BuildPr("feature", "master", NoFilter, stdTestCmdOptions(buff))
 	check(t, err)
 
 	assert.Equal(t, "built app-b\n", buff.String())
 
 	buff = new(bytes.Buffer)
-	_, err = NewWorld(t, ".tmp/repo").System.BuildPr("master", "feature", stdTestCmdOptions(buff))
+	_, err = NewWorld(t, ".tmp/repo").System.BuildPr("master", "feature", NoFilter, stdTestCmdOptions(buff))
 	check(t, err)
 
 	assert.Equal(t, "", buff.String())
 }
 
+func TestBuildPrWithNameFilter(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.InitModule("app-a"))
+	check(t, repo.WriteShellScript("app-a/build.sh", "echo built app-a"))
+	check(t, repo.WritePowershellScript("app-a/build.ps1", "write-host built app-a"))
+	check(t, repo.Commit("first"))
+
+	check(t, repo.SwitchToBranch("feature"))
+
+	check(t, repo.InitModule("app-b"))
+	check(t, repo.WriteShellScript("app-b/build.sh", "echo built app-b"))
+	check(t, repo.WritePowershellScript("app-b/build.ps1", "write-host built app-b"))
+
+	check(t, repo.InitModule("app-c"))
+	check(t, repo.WriteShellScript("app-c/build.sh", "echo built app-c"))
+	check(t, repo.WritePowershellScript("app-c/build.ps1", "write-host built app-c"))
+	check(t, repo.Commit("second"))
+
+	buff := new(bytes.Buffer)
+	_, err := NewWorld(t, ".tmp/repo").System.BuildPr("feature", "master", ExactMatchFilter("app-c"), stdTestCmdOptions(buff))
+	check(t, err)
+
+	assert.Equal(t, "built app-c\n", buff.String())
+}
+
+func TestBuildPrWithDependents(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.InitModule("app-a"))
+	check(t, repo.WriteShellScript("app-a/build.sh", "echo built app-a"))
+	check(t, repo.WritePowershellScript("app-a/build.ps1", "write-host built app-a"))
+
+	check(t, repo.InitModuleWithOptions("app-b", &Spec{
+		Name: "app-b",
+		Build: map[string]*Cmd{
+			"darwin":  {Cmd: "./build.sh", Args: []string{}},
+			"linux":   {Cmd: "./build.sh", Args: []string{}},
+			"windows": {Cmd: "powershell", Args: []string{"-ExecutionPolicy", "Bypass", "-File", ".\\build.ps1"}},
+		},
+		Dependencies: []string{"app-a"},
+	}))
+	check(t, repo.WriteShellScript("app-b/build.sh", "echo built app-b"))
+	check(t, repo.WritePowershellScript("app-b/build.ps1", "write-host built app-b"))
+
+	check(t, repo.InitModule("app-c"))
+	check(t, repo.WriteShellScript("app-c/build.sh", "echo built app-c"))
+	check(t, repo.WritePowershellScript("app-c/build.ps1", "write-host built app-c"))
+	check(t, repo.Commit("first"))
+
+	check(t, repo.SwitchToBranch("feature"))
+
+	check(t, repo.WriteContent("app-a/foo", "bar"))
+	check(t, repo.WriteContent("app-c/foo", "bar"))
+	check(t, repo.Commit("second"))
+
+	buff := new(bytes.Buffer)
+	_, err := NewWorld(t, ".tmp/repo").System.BuildPr("feature", "master", &FilterOptions{Name: "app-a", Dependents: true}, stdTestCmdOptions(buff))
+	check(t, err)
+
+	assert.Equal(t, "built app-a\nbuilt app-b\n", buff.String())
+}
+
 func TestBuildWorkspaceWithNameFilter(t *testing.T) {
 	clean()
 	repo := NewTestRepo(t, ".tmp/repo")
@@ -348,7 +544,28 @@ func TestBuildWorkspaceChanges(t *testing.T) {
 	check(t, repo.WritePowershellScript("app-b/build.ps1", "write-host built app-b"))
 
 	buff := new(bytes.Buffer)
-	_, err := NewWorld(t, ".tmp/repo").System.BuildWorkspaceChanges(stdTestCmdOptions(buff))
+	_, err := NewWorld(t, ".tmp/repo").System.BuildWorkspaceChanges(NoFilter, stdTestCmdOptions(buff))
+	check(t, err)
+
+	assert.Equal(t, "built app-b\n", buff.String())
+}
+
+func TestBuildWorkspaceChangesWithNameFilter(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.InitModule("app-a"))
+	check(t, repo.WriteShellScript("app-a/build.sh", "echo built app-a"))
+	check(t, repo.WritePowershellScript("app-a/build.ps1", "write-host built app-a"))
+	check(t, repo.Commit("first"))
+
+	check(t, repo.WriteContent("app-a/foo", "bar"))
+	check(t, repo.InitModule("app-b"))
+	check(t, repo.WriteShellScript("app-b/build.sh", "echo built app-b"))
+	check(t, repo.WritePowershellScript("app-b/build.ps1", "write-host built app-b"))
+
+	buff := new(bytes.Buffer)
+	_, err := NewWorld(t, ".tmp/repo").System.BuildWorkspaceChanges(FuzzyFilter("apb"), stdTestCmdOptions(buff))
 	check(t, err)
 
 	assert.Equal(t, "built app-b\n", buff.String())
@@ -371,7 +588,7 @@ func TestBuildPrForManifestFailure(t *testing.T) {
 
 	w := NewWorld(t, ".tmp/repo")
 	w.ManifestBuilder.Interceptor.Config("ByPr").Return(nil, errors.New("doh"))
-	_, err := w.System.BuildPr("feature", "master", stdTestCmdOptions(nil))
+	_, err := w.System.BuildPr("feature", "master", NoFilter, stdTestCmdOptions(nil))
 
 	assert.EqualError(t, err, "doh")
 }
@@ -385,7 +602,7 @@ func TestBuildDiffForManifestFailure(t *testing.T) {
 
 	w := NewWorld(t, ".tmp/repo")
 	w.ManifestBuilder.Interceptor.Config("ByDiff").Return(nil, errors.New("doh"))
-	_, err := w.System.BuildDiff(c, c, stdTestCmdOptions(nil))
+	_, err := w.System.BuildDiff(c, c, NoFilter, stdTestCmdOptions(nil))
 
 	assert.EqualError(t, err, "doh")
 }
@@ -431,7 +648,7 @@ func TestBuildWorkspaceChangesForManifestFailure(t *testing.T) {
 
 	w := NewWorld(t, ".tmp/repo")
 	w.ManifestBuilder.Interceptor.Config("ByWorkspaceChanges").Return(nil, errors.New("doh"))
-	_, err := w.System.BuildWorkspaceChanges(stdTestCmdOptions(nil))
+	_, err := w.System.BuildWorkspaceChanges(NoFilter, stdTestCmdOptions(nil))
 
 	assert.EqualError(t, err, "doh")
 }
@@ -577,8 +794,7 @@ func TestBadSha(t *testing.T) {
 
 	_, err := NewWorld(t, ".tmp/repo").System.BuildCommit("a", NoFilter, stdTestCmdOptions(nil))
 
-	assert.EqualError(t, err, fmt.Sprintf(msgInvalidSha, "a"))
-	assert.EqualError(t, (err.(*e.E)).InnerError(), "encoding/hex: odd length hex string")
+	assert.EqualError(t, err, fmt.Sprintf(msgUnknownRevision, "a"))
 	assert.Equal(t, ErrClassUser, (err.(*e.E)).Class())
 }
 
@@ -592,8 +808,7 @@ func TestMissingSha(t *testing.T) {
 	sha := "22221c5e56794a2af5f59f94512df4c669c77a49"
 	_, err := NewWorld(t, ".tmp/repo").System.BuildCommit(sha, NoFilter, stdTestCmdOptions(nil))
 
-	assert.EqualError(t, err, fmt.Sprintf(msgCommitShaNotFound, sha))
-	assert.EqualError(t, (err.(*e.E)).InnerError(), "object not found - no match for id (22221c5e56794a2af5f59f94512df4c669c77a49)")
+	assert.EqualError(t, err, fmt.Sprintf(msgUnknownRevision, sha))
 	assert.Equal(t, ErrClassUser, (err.(*e.E)).Class())
 }
 
@@ -612,7 +827,7 @@ func TestBuildCommitContent(t *testing.T) {
 	check(t, repo.Commit("second"))
 
 	buff := new(bytes.Buffer)
-	_, err := NewWorld(t, ".tmp/repo").System.BuildCommitContent(repo.LastCommit.String(), stdTestCmdOptions(buff))
+	_, err := NewWorld(t, ".tmp/repo").System.BuildCommitContent(repo.LastCommit.String(), NoFilter, stdTestCmdOptions(buff))
 	check(t, err)
 
 	assert.Equal(t, "built app-b\n", buff.String())
@@ -628,7 +843,7 @@ func TestBuildCommitContentForManifestFailure(t *testing.T) {
 	w.ManifestBuilder.Interceptor.Config("ByCommitContent").Return((*Manifest)(nil), errors.New("doh"))
 
 	buff := new(bytes.Buffer)
-	_, err := w.System.BuildCommitContent(repo.LastCommit.String(), stdTestCmdOptions(buff))
+	_, err := w.System.BuildCommitContent(repo.LastCommit.String(), NoFilter, stdTestCmdOptions(buff))
 
 	assert.EqualError(t, err, "doh")
 }
@@ -742,3 +957,541 @@ func TestRestorationOnBuildFailure(t *testing.T) {
 	check(t, err)
 	assert.Equal(t, 0, numDeltas)
 }
+
+func TestParallelBuild(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.InitModule("app-a"))
+	check(t, repo.WriteShellScript("app-a/build.sh", "echo built app-a"))
+	check(t, repo.WritePowershellScript("app-a/build.ps1", "write-host built app-a"))
+
+	check(t, repo.InitModule("app-b"))
+	check(t, repo.WriteShellScript("app-b/build.sh", "echo built app-b"))
+	check(t, repo.WritePowershellScript("app-b/build.ps1", "write-host built app-b"))
+
+	check(t, repo.InitModuleWithOptions("app-c", &Spec{
+		Name: "app-c",
+		Build: map[string]*Cmd{
+			"darwin":  {Cmd: "./build.sh", Args: []string{}},
+			"linux":   {Cmd: "./build.sh", Args: []string{}},
+			"windows": {Cmd: "powershell", Args: []string{"-ExecutionPolicy", "Bypass", "-File", ".\\build.ps1"}},
+		},
+		Dependencies: []string{"app-a", "app-b"},
+	}))
+	check(t, repo.WriteShellScript("app-c/build.sh", "echo built app-c"))
+	check(t, repo.WritePowershellScript("app-c/build.ps1", "write-host built app-c"))
+	check(t, repo.Commit("first"))
+
+	buff := new(bytes.Buffer)
+	options := stdTestCmdOptions(buff)
+	options.Concurrency = 2
+
+	summary, err := NewWorld(t, ".tmp/repo").System.BuildCurrentBranch(NoFilter, options)
+	check(t, err)
+
+	out := buff.String()
+	assert.Contains(t, out, "built app-a\n")
+	assert.Contains(t, out, "built app-b\n")
+	assert.Equal(t, "built app-c\n", out[len(out)-len("built app-c\n"):])
+
+	assert.Len(t, summary.Completed, 3)
+	assert.Len(t, summary.Failures, 0)
+	assert.Len(t, summary.Cancelled, 0)
+}
+
+func TestParallelBuildCancelsDependentsOfFailedModule(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.InitModule("app-a"))
+	check(t, repo.WriteShellScript("app-a/build.sh", "exit 1"))
+	check(t, repo.WritePowershellScript("app-a/build.ps1", "throw \"foo\""))
+
+	check(t, repo.InitModuleWithOptions("app-b", &Spec{
+		Name: "app-b",
+		Build: map[string]*Cmd{
+			"darwin":  {Cmd: "./build.sh", Args: []string{}},
+			"linux":   {Cmd: "./build.sh", Args: []string{}},
+			"windows": {Cmd: "powershell", Args: []string{"-ExecutionPolicy", "Bypass", "-File", ".\\build.ps1"}},
+		},
+		Dependencies: []string{"app-a"},
+	}))
+	check(t, repo.WriteShellScript("app-b/build.sh", "echo built app-b"))
+	check(t, repo.WritePowershellScript("app-b/build.ps1", "write-host built app-b"))
+
+	check(t, repo.InitModule("app-c"))
+	check(t, repo.WriteShellScript("app-c/build.sh", "echo built app-c"))
+	check(t, repo.WritePowershellScript("app-c/build.ps1", "write-host built app-c"))
+	check(t, repo.Commit("first"))
+
+	buff := new(bytes.Buffer)
+	options := stdTestCmdOptions(buff)
+	options.Concurrency = 2
+
+	summary, err := NewWorld(t, ".tmp/repo").System.BuildCurrentBranch(NoFilter, options)
+	assert.EqualError(t, err, fmt.Sprintf(msgFailedBuild, "app-a"))
+
+	assert.Len(t, summary.Completed, 1)
+	assert.Equal(t, "app-c", summary.Completed[0].Module.Name())
+	assert.Len(t, summary.Failures, 1)
+	assert.Equal(t, "app-a", summary.Failures[0].Module.Name())
+	assert.Len(t, summary.Cancelled, 1)
+	assert.Equal(t, "app-b", summary.Cancelled[0].Name())
+	assert.NotContains(t, buff.String(), "built app-b")
+}
+
+// blockingCache blocks the uploads of a module until
+// another module is looked up.
+type blockingCache struct {
+	Cache
+	block, trigger string
+	triggered      chan struct{}
+	once           sync.Once
+}
+
+func (c *blockingCache) Has(name, version string) (bool, error) {
+	if name == c.trigger {
+		c.once.Do(func() { close(c.triggered) })
+	}
+
+	return c.Cache.Has(name, version)
+}
+
+func (c *blockingCache) Put(name, version string, artifacts io.Reader) error {
+	if name == c.block {
+		select {
+		case <-c.triggered:
+		case <-time.After(5 * time.Second):
+			return errors.New("timed out")
+		}
+	}
+
+	return c.Cache.Put(name, version, artifacts)
+}
+
+func TestParallelBuildDoesNotWaitForCacheUploads(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	for _, name := range []string{"app-a", "app-b", "app-c"} {
+		check(t, repo.InitModule(name))
+		check(t, repo.WriteShellScript(name+"/build.sh", "echo built "+name))
+		check(t, repo.WritePowershellScript(name+"/build.ps1", "write-host built "+name))
+	}
+	check(t, repo.Commit("first"))
+
+	cache := NewFileCache(".tmp/cache")
+	options := stdTestCmdOptions(new(bytes.Buffer))
+	options.Concurrency = 2
+	options.Cache = &blockingCache{Cache: cache, block: "app-a", trigger: "app-c", triggered: make(chan struct{})}
+
+	summary, err := NewWorld(t, ".tmp/repo").System.BuildCurrentBranch(NoFilter, options)
+	check(t, err)
+	assert.Len(t, summary.Completed, 3)
+
+	a := summary.Manifest.Modules.indexByName()["app-a"]
+	ok, err := cache.Has(a.Name(), cacheVersion(a))
+	check(t, err)
+	assert.True(t, ok)
+}
+
+func TestBuildWithCache(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.InitModule("app-a"))
+	check(t, repo.WriteShellScript("app-a/build.sh", "echo built app-a"))
+	check(t, repo.WritePowershellScript("app-a/build.ps1", "write-host built app-a"))
+	check(t, repo.Commit("first"))
+
+	check(t, repo.InitModule("app-b"))
+	check(t, repo.WriteShellScript("app-b/build.sh", "echo built app-b"))
+	check(t, repo.WritePowershellScript("app-b/build.ps1", "write-host built app-b"))
+	check(t, repo.Commit("second"))
+
+	cache := NewFileCache(".tmp/cache")
+	ma, err := NewWorld(t, ".tmp/repo").System.ManifestByCurrentBranch()
+	check(t, err)
+	a := ma.Modules.indexByName()["app-a"]
+	check(t, cache.Put(a.Name(), cacheVersion(a), new(bytes.Buffer)))
+
+	stages := make(map[string]CmdStage)
+	buff := new(bytes.Buffer)
+	options := stdTestCmdOptions(buff)
+	options.Cache = cache
+	options.Callback = func(a *Module, s CmdStage, err error) {
+		stages[a.Name()] = s
+	}
+
+	summary, err := NewWorld(t, ".tmp/repo").System.BuildCurrentBranch(NoFilter, options)
+	check(t, err)
+
+	assert.Equal(t, "built app-b\n", buff.String())
+	assert.Len(t, summary.Completed, 1)
+	assert.Len(t, summary.Cached, 1)
+	assert.Equal(t, "app-a", summary.Cached[0].Name())
+	assert.Equal(t, CmdStageCachedBuild, stages["app-a"])
+
+	buff = new(bytes.Buffer)
+	options.Stdout = buff
+	options.Stderr = buff
+	summary, err = NewWorld(t, ".tmp/repo").System.BuildCurrentBranch(NoFilter, options)
+	check(t, err)
+
+	assert.Equal(t, "", buff.String())
+	assert.Len(t, summary.Completed, 0)
+	assert.Len(t, summary.Cached, 2)
+}
+
+func TestBuildRestoresCachedArtifacts(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.InitModuleWithOptions("app-a", &Spec{
+		Name: "app-a",
+		Build: map[string]*Cmd{
+			"darwin":  {Cmd: "./build.sh", Args: []string{}},
+			"linux":   {Cmd: "./build.sh", Args: []string{}},
+			"windows": {Cmd: "powershell", Args: []string{"-ExecutionPolicy", "Bypass", "-File", ".\\build.ps1"}},
+		},
+		Artifacts: []string{"out"},
+	}))
+	check(t, repo.WriteShellScript("app-a/build.sh", "mkdir -p out && echo app-a > out/result.txt"))
+	check(t, repo.WritePowershellScript("app-a/build.ps1", "New-Item -ItemType Directory -Force out | Out-Null; Set-Content -NoNewline out/result.txt \"app-a`n\""))
+	check(t, repo.Commit("first"))
+
+	buff := new(bytes.Buffer)
+	options := stdTestCmdOptions(buff)
+	options.Cache = NewFileCache(".tmp/cache")
+
+	summary, err := NewWorld(t, ".tmp/repo").System.BuildCurrentBranch(NoFilter, options)
+	check(t, err)
+	assert.Len(t, summary.Completed, 1)
+
+	result := filepath.Join(".tmp/repo", "app-a", "out", "result.txt")
+	check(t, os.RemoveAll(filepath.Dir(result)))
+
+	summary, err = NewWorld(t, ".tmp/repo").System.BuildCurrentBranch(NoFilter, options)
+	check(t, err)
+	assert.Len(t, summary.Completed, 0)
+	assert.Len(t, summary.Cached, 1)
+
+	content, err := ioutil.ReadFile(result)
+	check(t, err)
+	assert.Equal(t, "app-a\n", string(content))
+}
+
+func TestBuildTimeout(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.InitModuleWithOptions("app-a", &Spec{
+		Name: "app-a",
+		Build: map[string]*Cmd{
+			"darwin":  {Cmd: "./build.sh", Timeout: 200 * time.Millisecond},
+			"linux":   {Cmd: "./build.sh", Timeout: 200 * time.Millisecond},
+			"windows": {Cmd: "powershell", Args: []string{"-ExecutionPolicy", "Bypass", "-File", ".\\build.ps1"}, Timeout: 200 * time.Millisecond},
+		},
+	}))
+	check(t, repo.WriteShellScript("app-a/build.sh", "sleep 10"))
+	check(t, repo.WritePowershellScript("app-a/build.ps1", "Start-Sleep 10"))
+	check(t, repo.Commit("first"))
+
+	buff := new(bytes.Buffer)
+	start := time.Now()
+	_, err := NewWorld(t, ".tmp/repo").System.BuildCurrentBranch(NoFilter, stdTestCmdOptions(buff))
+
+	assert.True(t, time.Since(start) < 10*time.Second)
+	assert.EqualError(t, err, fmt.Sprintf(msgFailedBuild, "app-a"))
+	assert.EqualError(t, err.(*e.E).InnerError(), "Command timed out after 200ms")
+}
+
+func TestBuildRetries(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.InitModuleWithOptions("app-a", &Spec{
+		Name: "app-a",
+		Build: map[string]*Cmd{
+			"darwin":  {Cmd: "./build.sh", Retries: 1},
+			"linux":   {Cmd: "./build.sh", Retries: 1},
+			"windows": {Cmd: "powershell", Args: []string{"-ExecutionPolicy", "Bypass", "-File", ".\\build.ps1"}, Retries: 1},
+		},
+	}))
+	check(t, repo.WriteShellScript("app-a/build.sh", "if [ -f attempt ]; then echo built app-a; else touch attempt; exit 1; fi"))
+	check(t, repo.WritePowershellScript("app-a/build.ps1", "if (Test-Path attempt) { write-host built app-a } else { New-Item attempt | Out-Null; exit 1 }"))
+
+	buff := new(bytes.Buffer)
+	summary, err := NewWorld(t, ".tmp/repo").System.BuildWorkspace(NoFilter, stdTestCmdOptions(buff))
+	check(t, err)
+
+	assert.Len(t, summary.Completed, 1)
+	assert.Equal(t, "built app-a\n", buff.String())
+}
+
+func TestBuildWithCancelledContext(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.InitModule("app-a"))
+	check(t, repo.WriteShellScript("app-a/build.sh", "echo built app-a"))
+	check(t, repo.WritePowershellScript("app-a/build.ps1", "write-host built app-a"))
+	check(t, repo.Commit("first"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	buff := new(bytes.Buffer)
+	options := stdTestCmdOptions(buff)
+	options.Context = ctx
+	_, err := NewWorld(t, ".tmp/repo").System.BuildCurrentBranch(NoFilter, options)
+
+	assert.EqualError(t, err, fmt.Sprintf(msgFailedBuild, "app-a"))
+	assert.Equal(t, context.Canceled, err.(*e.E).InnerError())
+	assert.Equal(t, "", buff.String())
+}
+
+func TestParallelBuildWithCancelledContext(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.InitModule("app-a"))
+	check(t, repo.WriteShellScript("app-a/build.sh", "echo built app-a"))
+	check(t, repo.WritePowershellScript("app-a/build.ps1", "write-host built app-a"))
+
+	check(t, repo.InitModule("app-b"))
+	check(t, repo.WriteShellScript("app-b/build.sh", "echo built app-b"))
+	check(t, repo.WritePowershellScript("app-b/build.ps1", "write-host built app-b"))
+	check(t, repo.Commit("first"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	buff := new(bytes.Buffer)
+	options := stdTestCmdOptions(buff)
+	options.Context = ctx
+	options.Concurrency = 2
+	summary, err := NewWorld(t, ".tmp/repo").System.BuildCurrentBranch(NoFilter, options)
+
+	assert.EqualError(t, err, fmt.Sprintf(msgBuildCancelled, 2))
+	assert.Equal(t, context.Canceled, err.(*e.E).InnerError())
+	assert.Len(t, summary.Completed, 0)
+	assert.Len(t, summary.Cancelled, 2)
+	assert.Equal(t, "", buff.String())
+}
+
+func TestBuildEvents(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.InitModule("app-a"))
+	check(t, repo.WriteShellScript("app-a/build.sh", "echo built app-a"))
+	check(t, repo.WritePowershellScript("app-a/build.ps1", "write-host built app-a"))
+
+	check(t, repo.InitModuleWithOptions("app-b", &Spec{
+		Name:         "app-b",
+		Dependencies: []string{"app-a"},
+		Build: map[string]*Cmd{
+			"darwin":  {Cmd: "./build.sh"},
+			"linux":   {Cmd: "./build.sh"},
+			"windows": {Cmd: "powershell", Args: []string{"-ExecutionPolicy", "Bypass", "-File", ".\\build.ps1"}},
+		},
+	}))
+	check(t, repo.WriteShellScript("app-b/build.sh", "exit 3"))
+	check(t, repo.WritePowershellScript("app-b/build.ps1", "exit 3"))
+	check(t, repo.Commit("first"))
+
+	recorder := &eventRecorder{}
+	buff := new(bytes.Buffer)
+	options := stdTestCmdOptions(buff)
+	options.Events = recorder
+
+	_, err := NewWorld(t, ".tmp/repo").System.BuildCurrentBranch(NoFilter, options)
+	assert.Error(t, err)
+
+	assert.Equal(t, []EventType{
+		EventBuildStarted,
+		EventModuleStarted,
+		EventModuleCompleted,
+		EventModuleStarted,
+		EventModuleFailed,
+		EventBuildFinished,
+	}, recorder.types())
+
+	for _, event := range recorder.events {
+		assert.Equal(t, "build", event.Command)
+		assert.Equal(t, repo.LastCommit.String(), event.Sha)
+	}
+
+	assert.Equal(t, "app-a", recorder.events[2].Module.Name())
+	assert.Equal(t, 0, recorder.events[2].ExitCode)
+	assert.Equal(t, "app-b", recorder.events[4].Module.Name())
+	assert.Equal(t, 3, recorder.events[4].ExitCode)
+	assert.Equal(t, err, recorder.events[5].Err)
+}
+
+func TestBuildResults(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.InitModule("app-a"))
+	check(t, repo.WriteShellScript("app-a/build.sh", "echo built app-a"))
+	check(t, repo.WritePowershellScript("app-a/build.ps1", "write-host built app-a"))
+
+	check(t, repo.InitModuleWithOptions("app-b", &Spec{Name: "app-b", Dependencies: []string{"app-a"}}))
+
+	check(t, repo.InitModuleWithOptions("app-c", &Spec{
+		Name:         "app-c",
+		Dependencies: []string{"app-b"},
+		Build: map[string]*Cmd{
+			"darwin":  {Cmd: "./build.sh"},
+			"linux":   {Cmd: "./build.sh"},
+			"windows": {Cmd: "powershell", Args: []string{"-ExecutionPolicy", "Bypass", "-File", ".\\build.ps1"}},
+		},
+	}))
+	check(t, repo.WriteShellScript("app-c/build.sh", "echo failing app-c\nexit 1"))
+	check(t, repo.WritePowershellScript("app-c/build.ps1", "write-host failing app-c\nexit 1"))
+
+	check(t, repo.InitModuleWithOptions("app-d", &Spec{Name: "app-d", Dependencies: []string{"app-c"}}))
+	check(t, repo.Commit("first"))
+
+	buff := new(bytes.Buffer)
+	options := stdTestCmdOptions(buff)
+	options.OutputTail = 1024
+	summary, err := NewWorld(t, ".tmp/repo").System.BuildCurrentBranch(NoFilter, options)
+
+	assert.Error(t, err)
+	assert.Len(t, summary.Failures, 1)
+	assert.Len(t, summary.Cancelled, 1)
+	assert.Len(t, summary.Results, 4)
+
+	assert.Equal(t, ModuleStatusCompleted, summary.Results[0].Status)
+	assert.Equal(t, "built app-a\n", summary.Results[0].Stdout)
+
+	assert.Equal(t, ModuleStatusSkipped, summary.Results[1].Status)
+	assert.Equal(t, SkipReasonNoCommand, summary.Results[1].SkipReason)
+
+	assert.Equal(t, ModuleStatusFailed, summary.Results[2].Status)
+	assert.Equal(t, "failing app-c\n", summary.Results[2].Stdout)
+	assert.Equal(t, err, summary.Results[2].Err)
+
+	assert.Equal(t, "app-d", summary.Results[3].Module.Name())
+	assert.Equal(t, ModuleStatusCancelled, summary.Results[3].Status)
+}
+
+func TestParallelBuildWithPrefixedOutput(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	for _, name := range []string{"app-a", "app-b"} {
+		check(t, repo.InitModule(name))
+		check(t, repo.WriteShellScript(name+"/build.sh", "echo one "+name+"\necho two "+name))
+		check(t, repo.WritePowershellScript(name+"/build.ps1", "write-host one "+name+"\nwrite-host two "+name))
+	}
+	check(t, repo.Commit("first"))
+
+	buff := new(bytes.Buffer)
+	options := stdTestCmdOptions(buff)
+	options.Concurrency = 2
+	options.PrefixOutput = true
+	options.LogDir = ".tmp/logs"
+
+	_, err := NewWorld(t, ".tmp/repo").System.BuildCurrentBranch(NoFilter, options)
+	check(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buff.String()), "\n")
+	assert.ElementsMatch(t, []string{
+		"app-a | one app-a",
+		"app-a | two app-a",
+		"app-b | one app-b",
+		"app-b | two app-b",
+	}, lines)
+
+	log, err := ioutil.ReadFile(".tmp/logs/app-b.log")
+	check(t, err)
+	assert.True(t, strings.HasSuffix(string(log), "one app-b\ntwo app-b\n"))
+}
+
+func TestBuildDryRun(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.InitModuleWithOptions("app-a", &Spec{
+		Name: "app-a",
+		Build: map[string]*Cmd{
+			"default": {Cmd: "./build.sh", Args: []string{"a"}, Timeout: time.Minute, Retries: 2},
+		},
+	}))
+	check(t, repo.WriteShellScript("app-a/build.sh", "echo built > built.txt"))
+	check(t, repo.InitModuleWithOptions("app-b", &Spec{Name: "app-b"}))
+	check(t, repo.Commit("first"))
+
+	buff := new(bytes.Buffer)
+	options := stdTestCmdOptions(buff)
+	options.DryRun = true
+	summary, err := NewWorld(t, ".tmp/repo").System.BuildCurrentBranch(NoFilter, options)
+	check(t, err)
+
+	assert.Empty(t, buff.String())
+	assert.Empty(t, summary.Completed)
+	assert.NoFileExists(t, ".tmp/repo/app-a/built.txt")
+
+	plan := summary.Plan
+	assert.Equal(t, "build", plan.Command)
+	assert.Len(t, plan.Steps, 2)
+
+	a := plan.Steps[0]
+	assert.Equal(t, "app-a", a.Module.Name())
+	assert.Equal(t, PlanActionRun, a.Action)
+	assert.Equal(t, "./build.sh", a.Cmd)
+	assert.Equal(t, []string{"a"}, a.Args)
+	assert.Equal(t, time.Minute, a.Timeout)
+	assert.Equal(t, 2, a.Retries)
+	assert.Contains(t, a.Env, "MBT_MODULE_NAME=app-a")
+	assert.Contains(t, a.Env, "MBT_BUILD_COMMIT="+summary.Manifest.Sha)
+
+	assert.Equal(t, "app-b", plan.Steps[1].Module.Name())
+	assert.Equal(t, PlanActionSkip, plan.Steps[1].Action)
+	assert.Equal(t, SkipReasonNoCommand, plan.Steps[1].SkipReason)
+}
+
+func TestIsolatedBuildWithDirtyWorkingDir(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.InitModule("app-a"))
+	check(t, repo.WriteContent("app-a/foo", "a"))
+	check(t, repo.WriteShellScript("app-a/build.sh", "cat foo\necho\necho built > built.txt"))
+	check(t, repo.WritePowershellScript("app-a/build.ps1", "write-host (get-content foo)\nset-content built.txt built"))
+	check(t, repo.Commit("first"))
+
+	check(t, repo.SwitchToBranch("feature"))
+	check(t, repo.WriteContent("app-a/foo", "feature"))
+	check(t, repo.Commit("second"))
+	check(t, repo.SwitchToBranch("master"))
+
+	check(t, repo.WriteContent("app-a/foo", "b"))
+
+	buff := new(bytes.Buffer)
+	options := stdTestCmdOptions(buff)
+	options.Isolated = true
+	summary, err := NewWorld(t, ".tmp/repo").System.BuildBranch("feature", NoFilter, options)
+	check(t, err)
+
+	assert.Equal(t, "feature\n", buff.String())
+	assert.Len(t, summary.Completed, 1)
+
+	repoDir, err := filepath.Abs(".tmp/repo")
+	check(t, err)
+	assert.Equal(t, repoDir, summary.Manifest.Dir)
+
+	foo, err := ioutil.ReadFile(".tmp/repo/app-a/foo")
+	check(t, err)
+	assert.Equal(t, "b", string(foo))
+	assert.NoFileExists(t, ".tmp/repo/app-a/built.txt")
+
+	head, err := repo.Repo.Head()
+	check(t, err)
+	assert.Equal(t, "refs/heads/master", head.Name())
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mbtproject/mbt/e"
+)
+
+type fileCache struct {
+	dir string
+}
+
+// NewFileCache creates a Cache that stores build records in
+// the specified directory.
+// Each entry is stored in <dir>/<module>/<version>.
+func NewFileCache(dir string) Cache {
+	return &fileCache{dir: dir}
+}
+
+// DefaultCacheDir returns the default location of the build cache
+// in current user's cache directory (e.g. ~/.cache/mbt).
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", e.Wrap(ErrClassUser, err)
+	}
+
+	return filepath.Join(dir, "mbt"), nil
+}
+
+func (c *fileCache) Has(name, version string) (bool, error) {
+	p, err := c.entryPath(name, version)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(p)
+	if err == nil {
+		return true, nil
+	}
+
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	return false, e.Wrapf(ErrClassInternal, err, msgFailedCacheRead, name, version)
+}
+
+func (c *fileCache) Get(name, version string) (io.ReadCloser, error) {
+	p, err := c.entryPath(name, version)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, e.NewErrorf(ErrClassInternal, msgCacheEntryNotFound, name, version)
+	}
+
+	if err != nil {
+		return nil, e.Wrapf(ErrClassInternal, err, msgFailedCacheRead, name, version)
+	}
+
+	return f, nil
+}
+
+func (c *fileCache) Put(name, version string, artifacts io.Reader) error {
+	p, err := c.entryPath(name, version)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return e.Wrapf(ErrClassInternal, err, msgFailedCacheWrite, name, version)
+	}
+
+	// Write to a temporary file first so that partially written
+	// entries are never visible to the readers.
+	f, err := ioutil.TempFile(filepath.Dir(p), ".tmp-")
+	if err != nil {
+		return e.Wrapf(ErrClassInternal, err, msgFailedCacheWrite, name, version)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = io.Copy(f, artifacts)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return e.Wrapf(ErrClassInternal, err, msgFailedCacheWrite, name, version)
+	}
+
+	err = os.Rename(f.Name(), p)
+	if err != nil {
+		return e.Wrapf(ErrClassInternal, err, msgFailedCacheWrite, name, version)
+	}
+
+	return nil
+}
+
+func (c *fileCache) entryPath(name, version string) (string, error) {
+	err := checkCacheKey(name, version)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(c.dir, name, version), nil
+}
+
+// checkCacheKey verifies that the module name and version can be
+// used as a path component or url segment in cache entries.
+func checkCacheKey(name, version string) error {
+	for _, k := range []string{name, version} {
+		if k == "" || k == "." || k == ".." || strings.ContainsAny(k, `/\`) {
+			return e.NewErrorf(ErrClassUser, msgInvalidCacheKey, name, version)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileCache(t *testing.T) {
+	clean()
+	c := NewFileCache(".tmp/cache")
+
+	ok, err := c.Has("app-a", "abc")
+	check(t, err)
+	assert.False(t, ok)
+
+	check(t, c.Put("app-a", "abc", strings.NewReader("artifacts")))
+
+	ok, err = c.Has("app-a", "abc")
+	check(t, err)
+	assert.True(t, ok)
+
+	r, err := c.Get("app-a", "abc")
+	check(t, err)
+	content, err := ioutil.ReadAll(r)
+	r.Close()
+	check(t, err)
+	assert.Equal(t, "artifacts", string(content))
+
+	_, err = c.Get("app-a", "def")
+	assert.EqualError(t, err, "Cache entry for module app-a version def is not found")
+
+	ok, err = c.Has("app-a", "def")
+	check(t, err)
+	assert.False(t, ok)
+
+	ok, err = c.Has("app-b", "abc")
+	check(t, err)
+	assert.False(t, ok)
+}
+
+func TestCacheRejectsInvalidKeys(t *testing.T) {
+	clean()
+	server := httptest.NewServer(&testCacheServer{entries: make(map[string][]byte)})
+	defer server.Close()
+
+	for _, c := range []Cache{NewFileCache(".tmp/cache"), NewHTTPCache(server.URL)} {
+		for _, name := range []string{"../app-a", "app/a", "app\\a", "..", ""} {
+			_, err := c.Has(name, "abc")
+			assert.EqualError(t, err, fmt.Sprintf(msgInvalidCacheKey, name, "abc"))
+
+			_, err = c.Get(name, "abc")
+			assert.EqualError(t, err, fmt.Sprintf(msgInvalidCacheKey, name, "abc"))
+
+			err = c.Put(name, "abc", strings.NewReader("artifacts"))
+			assert.EqualError(t, err, fmt.Sprintf(msgInvalidCacheKey, name, "abc"))
+		}
+	}
+
+	_, err := os.Stat(".tmp/app-a")
+	assert.True(t, os.IsNotExist(err))
+}
+
+type testCacheServer struct {
+	mu      sync.Mutex
+	entries map[string][]byte
+}
+
+func (s *testCacheServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodHead, http.MethodGet:
+		content, ok := s.entries[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(content)
+	case http.MethodPut:
+		content, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.entries[r.URL.Path] = content
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestHTTPCache(t *testing.T) {
+	server := httptest.NewServer(&testCacheServer{entries: make(map[string][]byte)})
+	defer server.Close()
+
+	c := NewHTTPCache(server.URL + "/")
+
+	ok, err := c.Has("app-a", "abc")
+	check(t, err)
+	assert.False(t, ok)
+
+	check(t, c.Put("app-a", "abc", strings.NewReader("artifacts")))
+
+	ok, err = c.Has("app-a", "abc")
+	check(t, err)
+	assert.True(t, ok)
+
+	r, err := c.Get("app-a", "abc")
+	check(t, err)
+	content, err := ioutil.ReadAll(r)
+	r.Close()
+	check(t, err)
+	assert.Equal(t, "artifacts", string(content))
+
+	_, err = c.Get("app-b", "abc")
+	assert.EqualError(t, err, "Cache entry for module app-b version abc is not found")
+}
+
+func TestHTTPCacheUnexpectedResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	c := NewHTTPCache(server.URL)
+
+	_, err := c.Has("app-a", "abc")
+	assert.EqualError(t, err, "Unexpected response from cache server HEAD "+server.URL+"/app-a/abc: 500 Internal Server Error")
+
+	err = c.Put("app-a", "abc", strings.NewReader("artifacts"))
+	assert.EqualError(t, err, "Unexpected response from cache server PUT "+server.URL+"/app-a/abc: 500 Internal Server Error")
+}
+
+func TestArtifactsRoundTrip(t *testing.T) {
+	clean()
+	src := ".tmp/artifacts/src"
+	check(t, os.MkdirAll(filepath.Join(src, "out", "nested"), 0755))
+	check(t, ioutil.WriteFile(filepath.Join(src, "out", "a.txt"), []byte("a"), 0644))
+	check(t, ioutil.WriteFile(filepath.Join(src, "out", "nested", "b.txt"), []byte("b"), 0644))
+	check(t, ioutil.WriteFile(filepath.Join(src, "app.bin"), []byte("bin"), 0755))
+	check(t, ioutil.WriteFile(filepath.Join(src, "src.txt"), []byte("src"), 0644))
+
+	buff := new(bytes.Buffer)
+	check(t, archiveArtifacts(src, []string{"out", "*.bin"}, buff))
+
+	dst := ".tmp/artifacts/dst"
+	check(t, restoreArtifacts(dst, buff))
+
+	for f, expected := range map[string]string{
+		"out/a.txt":        "a",
+		"out/nested/b.txt": "b",
+		"app.bin":          "bin",
+	} {
+		content, err := ioutil.ReadFile(filepath.Join(dst, f))
+		check(t, err)
+		assert.Equal(t, expected, string(content))
+	}
+
+	_, err := os.Stat(filepath.Join(dst, "src.txt"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"fmt"
+	"strings"
+)
+
+func (s *stdSystem) CompareCommits(from, to string) (*Comparison, error) {
+	f, err := s.Repo.ResolveRevision(from)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := s.Repo.ResolveRevision(to)
+	if err != nil {
+		return nil, err
+	}
+
+	fm, err := s.MB.ByCommit(f)
+	if err != nil {
+		return nil, err
+	}
+
+	tm, err := s.MB.ByCommit(t)
+	if err != nil {
+		return nil, err
+	}
+
+	return compareManifests(fm, tm), nil
+}
+
+// compareManifests returns the modules that are different in two
+// manifests. Modules are matched by name.
+// Modules in 'to' are listed first (in topological order), followed
+// by the modules removed from 'from'.
+func compareManifests(from, to *Manifest) *Comparison {
+	c := &Comparison{From: from, To: to, Modules: make([]*ModuleComparison, 0)}
+	fromModules := from.Modules.indexByName()
+	toModules := to.Modules.indexByName()
+
+	for _, t := range to.Modules {
+		f, ok := fromModules[t.Name()]
+		if !ok {
+			c.Modules = append(c.Modules, &ModuleComparison{Name: t.Name(), To: t, Changes: []ModuleChange{ModuleAdded}})
+			continue
+		}
+
+		changes := make([]ModuleChange, 0)
+		if f.Path() != t.Path() {
+			changes = append(changes, ModulePathChanged)
+		}
+
+		if f.Version() != t.Version() {
+			changes = append(changes, ModuleVersionChanged)
+		}
+
+		if len(changes) > 0 {
+			c.Modules = append(c.Modules, &ModuleComparison{Name: t.Name(), From: f, To: t, Changes: changes})
+		}
+	}
+
+	for _, f := range from.Modules {
+		if _, ok := toModules[f.Name()]; !ok {
+			c.Modules = append(c.Modules, &ModuleComparison{Name: f.Name(), From: f, Changes: []ModuleChange{ModuleRemoved}})
+		}
+	}
+
+	return c
+}
+
+// Has returns true if the module comparison contains the specified change.
+func (m *ModuleComparison) Has(change ModuleChange) bool {
+	for _, c := range m.Changes {
+		if c == change {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SerializeAsDot converts a comparison into a dot graph of the modules
+// in 'to' commit and the modules removed since 'from' commit.
+// Added modules are plotted in green, removed modules in grey,
+// modules with a different version in red and moved modules in orange.
+func (c *Comparison) SerializeAsDot() string {
+	colours := make(map[string]string)
+	for _, m := range c.Modules {
+		switch {
+		case m.Has(ModuleAdded):
+			colours[m.Name] = "palegreen"
+		case m.Has(ModuleRemoved):
+			colours[m.Name] = "lightgrey"
+		case m.Has(ModuleVersionChanged):
+			colours[m.Name] = "red"
+		default:
+			colours[m.Name] = "orange"
+		}
+	}
+
+	nodes := []string{}
+	paths := []string{}
+	add := func(m *Module) {
+		colour, ok := colours[m.Name()]
+		if !ok {
+			colour = "powderblue"
+		}
+		nodes = append(nodes, fmt.Sprintf("\"%s\" [fillcolor=%s]", m.Name(), colour))
+
+		for _, r := range m.Requires() {
+			paths = append(paths, fmt.Sprintf("\"%s\" -> \"%s\"", m.Name(), r.Name()))
+		}
+	}
+
+	for _, m := range c.To.Modules {
+		add(m)
+	}
+
+	for _, m := range c.Modules {
+		if m.Has(ModuleRemoved) {
+			add(m.From)
+		}
+	}
+
+	return fmt.Sprintf(`digraph mbt {
+  node [shape=box style=filled fontcolor=black];
+  %s
+  %s
+}`, strings.Join(nodes, "\n  "), strings.Join(paths, "\n  "))
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newCompareTestRepo(t *testing.T) (MemoryRepo, Commit, Commit) {
+	repo := NewMemoryRepo(".tmp/repo")
+	repo.WriteFile("app-a/.mbt.yml", "name: app-a\n")
+	repo.WriteFile("app-b/.mbt.yml", "name: app-b\ndependencies: [app-a]\n")
+	repo.WriteFile("app-c/.mbt.yml", "name: app-c\n")
+	repo.WriteFile("app-e/.mbt.yml", "name: app-e\n")
+	from, err := repo.Commit("first")
+	check(t, err)
+
+	repo.RemoveFile("app-a/.mbt.yml")
+	repo.WriteFile("apps/app-a/.mbt.yml", "name: app-a\n")
+	repo.WriteFile("app-b/.mbt.yml", "name: app-b\ndependencies: [app-a]\nproperties:\n  foo: bar\n")
+	repo.RemoveFile("app-c/.mbt.yml")
+	repo.WriteFile("app-d/.mbt.yml", "name: app-d\n")
+	to, err := repo.Commit("second")
+	check(t, err)
+
+	return repo, from, to
+}
+
+func TestCompareCommits(t *testing.T) {
+	repo, from, to := newCompareTestRepo(t)
+
+	c, err := NewSystemWith(repo).CompareCommits(from.ID(), to.ID())
+	check(t, err)
+
+	assert.Equal(t, from.ID(), c.From.Sha)
+	assert.Equal(t, to.ID(), c.To.Sha)
+
+	changes := make(map[string]*ModuleComparison)
+	for _, m := range c.Modules {
+		changes[m.Name] = m
+	}
+
+	assert.Len(t, changes, 4)
+	assert.NotContains(t, changes, "app-e")
+
+	a := changes["app-a"]
+	assert.True(t, a.Has(ModulePathChanged))
+	assert.Equal(t, "app-a", a.From.Path())
+	assert.Equal(t, "apps/app-a", a.To.Path())
+
+	b := changes["app-b"]
+	assert.Equal(t, []ModuleChange{ModuleVersionChanged}, b.Changes)
+	assert.NotEqual(t, b.From.Version(), b.To.Version())
+
+	assert.Equal(t, []ModuleChange{ModuleRemoved}, changes["app-c"].Changes)
+	assert.Nil(t, changes["app-c"].To)
+
+	assert.Equal(t, []ModuleChange{ModuleAdded}, changes["app-d"].Changes)
+	assert.Nil(t, changes["app-d"].From)
+
+	// Removed modules are listed last
+	assert.Equal(t, "app-c", c.Modules[len(c.Modules)-1].Name)
+}
+
+func TestCompareSameCommit(t *testing.T) {
+	repo, _, to := newCompareTestRepo(t)
+
+	c, err := NewSystemWith(repo).CompareCommits(to.ID(), to.ID())
+	check(t, err)
+
+	assert.Empty(t, c.Modules)
+}
+
+func TestCompareCommitsWithInvalidRevision(t *testing.T) {
+	repo, from, _ := newCompareTestRepo(t)
+
+	_, err := NewSystemWith(repo).CompareCommits(from.ID(), "unknown")
+
+	assert.Error(t, err)
+}
+
+func TestComparisonSerializeAsDot(t *testing.T) {
+	repo, from, to := newCompareTestRepo(t)
+
+	c, err := NewSystemWith(repo).CompareCommits(from.ID(), to.ID())
+	check(t, err)
+
+	dot := c.SerializeAsDot()
+
+	assert.Contains(t, dot, `"app-b" [fillcolor=red]`)
+	assert.Contains(t, dot, `"app-c" [fillcolor=lightgrey]`)
+	assert.Contains(t, dot, `"app-d" [fillcolor=palegreen]`)
+	assert.Contains(t, dot, `"app-e" [fillcolor=powderblue]`)
+	assert.Contains(t, dot, `"app-b" -> "app-a"`)
+}
@@ -18,9 +18,10 @@ package lib
 import (
 	"crypto/sha1"
 	"encoding/hex"
+	"fmt"
 	"io"
-	"io/ioutil"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	yaml "github.com/go-yaml/yaml"
@@ -35,6 +36,10 @@ type moduleMetadata struct {
 	hash                string
 	spec                *Spec
 	dependentFileHashes map[string]string
+	// defaultsHash is the hash of the spec resolved by merging
+	// the repository defaults and the kind of the module.
+	// Empty if the module does not inherit anything.
+	defaultsHash string
 }
 
 // moduleMetadataSet is an array of ModuleMetadata extracted from the repository.
@@ -55,8 +60,14 @@ func NewDiscover(repo Repo, l Log) Discover {
 func (d *stdDiscover) ModulesInCommit(commit Commit) (Modules, error) {
 	repo := d.Repo
 	metadataSet := moduleMetadataSet{}
+	blobs := make(map[string]Blob)
+	var defaults Blob
 
 	err := repo.WalkBlobs(commit, func(b Blob) error {
+		if b.Name() == defaultsFileName && strings.TrimRight(b.Path(), "/") == "" {
+			defaults = b
+		}
+
 		if b.Name() == configFileName {
 			var (
 				hash string
@@ -84,19 +95,10 @@ func (d *stdDiscover) ModulesInCommit(commit Commit) (Modules, error) {
 				return e.Wrapf(ErrClassUser, err, "error while parsing the spec at %v", b)
 			}
 
-			// Discover the hashes for file dependencies of this module
-			dependentFileHashes := make(map[string]string)
-			for _, f := range spec.FileDependencies {
-				fh, err := repo.EntryID(commit, f)
-				if err != nil {
-					return e.Wrapf(ErrClassUser, err, msgFileDependencyNotFound, f, spec.Name, p)
-				}
-
-				dependentFileHashes[f] = fh
-			}
-
-			metadataSet = append(metadataSet, newModuleMetadata(p, hash, spec, dependentFileHashes))
+			metadataSet = append(metadataSet, newModuleMetadata(p, hash, spec, nil))
 		}
+
+		blobs[b.String()] = b
 		return nil
 	})
 
@@ -104,6 +106,32 @@ func (d *stdDiscover) ModulesInCommit(commit Commit) (Modules, error) {
 		return nil, err
 	}
 
+	var defaultsContents []byte
+	if defaults != nil && len(metadataSet) > 0 {
+		defaultsContents, err = repo.BlobContents(defaults)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = applyDefaults(metadataSet, defaultsContents, defaultsContents != nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Discover the content hash (when files are ignored) and
+	// the hashes for file dependencies of each module
+	for _, meta := range metadataSet {
+		if len(meta.spec.Ignore) > 0 {
+			meta.hash = contentHash(meta.dir, meta.spec.Ignore, blobs)
+		}
+
+		meta.dependentFileHashes, err = d.fileDependencyHashes(commit, meta, blobs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return toModules(metadataSet)
 }
 
@@ -129,7 +157,7 @@ func (d *stdDiscover) ModulesInWorkspace() (Modules, error) {
 
 		path := filepath.Join(absRepoPath, entry)
 
-		contents, err := ioutil.ReadFile(path)
+		contents, err := d.Repo.WorkspaceFileContents(entry)
 		if err != nil {
 			return nil, e.Wrapf(ErrClassInternal, err, "error whilst reading file contents at path %s", path)
 		}
@@ -147,17 +175,209 @@ func (d *stdDiscover) ModulesInWorkspace() (Modules, error) {
 			dir = strings.TrimRight(dir, "/")
 		}
 
-		hash := "local"
-		metadataSet = append(metadataSet, newModuleMetadata(dir, hash, spec, nil))
+		metadataSet = append(metadataSet, newModuleMetadata(dir, "", spec, nil))
 	}
 
+	if len(metadataSet) == 0 {
+		return toModules(metadataSet)
+	}
+
+	// Module hashes are computed from the content on disk the same
+	// way git computes tree ids. Therefore, modules that are not
+	// modified in the workspace get the same version as in HEAD.
+	dirs := make([]string, 0, len(metadataSet))
+	for _, meta := range metadataSet {
+		dirs = append(dirs, meta.dir)
+	}
+
+	ids, err := d.Repo.WorkspaceEntryIDs(append(dirs, defaultsFileName))
 	if err != nil {
-		return nil, e.Wrap(ErrClassInternal, err)
+		return nil, err
+	}
+
+	var defaultsContents []byte
+	_, hasDefaults := ids[defaultsFileName]
+	if hasDefaults {
+		defaultsContents, err = d.Repo.WorkspaceFileContents(defaultsFileName)
+		if err != nil {
+			return nil, e.Wrapf(ErrClassInternal, err, "error whilst reading file contents at path %s", filepath.Join(absRepoPath, defaultsFileName))
+		}
+	}
+
+	err = applyDefaults(metadataSet, defaultsContents, hasDefaults)
+	if err != nil {
+		return nil, err
+	}
+
+	var blobs map[string]Blob
+	for _, meta := range metadataSet {
+		if meta.dir != "" {
+			meta.hash = ids[meta.dir]
+		} else {
+			meta.hash = d.workspaceRootHash(ids[""])
+		}
+
+		if len(meta.spec.Ignore) > 0 || hasGlob(meta.spec.FileDependencies) {
+			if blobs == nil {
+				blobs, err = d.workspaceBlobs()
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if len(meta.spec.Ignore) > 0 {
+			meta.hash = contentHash(meta.dir, meta.spec.Ignore, blobs)
+		}
+
+		meta.dependentFileHashes, err = d.workspaceFileDependencyHashes(meta, blobs)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return toModules(metadataSet)
 }
 
+// workspaceRootHash returns the hash of the root module in workspace.
+// Modules in the root are identified by the commit sha (see ModulesInCommit).
+// We use the sha of HEAD when the workspace is identical to it
+// and the id of the root tree otherwise.
+func (d *stdDiscover) workspaceRootHash(treeID string) string {
+	head, err := d.Repo.ResolveRevision("HEAD")
+	if err != nil {
+		return treeID
+	}
+
+	headTreeID, err := d.Repo.EntryID(head, "")
+	if err != nil || headTreeID != treeID {
+		return treeID
+	}
+
+	return head.ID()
+}
+
+// workspaceBlobs returns all files in workspace indexed by path.
+func (d *stdDiscover) workspaceBlobs() (map[string]Blob, error) {
+	files, err := d.Repo.WorkspaceBlobs()
+	if err != nil {
+		return nil, err
+	}
+
+	blobs := make(map[string]Blob, len(files))
+	for _, b := range files {
+		blobs[b.String()] = b
+	}
+
+	return blobs, nil
+}
+
+// workspaceFileDependencyHashes is the workspace equivalent of
+// fileDependencyHashes.
+func (d *stdDiscover) workspaceFileDependencyHashes(meta *moduleMetadata, blobs map[string]Blob) (map[string]string, error) {
+	spec := meta.spec
+	paths, globs := splitGlobs(spec.FileDependencies)
+	hashes := make(map[string]string)
+	if len(paths) > 0 {
+		ids, err := d.Repo.WorkspaceEntryIDs(paths)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range paths {
+			fh, ok := ids[f]
+			if !ok {
+				return nil, e.NewErrorf(ErrClassUser, msgFileDependencyNotFound, f, spec.Name, meta.dir)
+			}
+
+			hashes[f] = fh
+		}
+	}
+
+	return matchFileDependencies(meta, globs, blobs, hashes)
+}
+
+// fileDependencyHashes returns the hashes of the files matched by
+// the file dependencies of a module. Paths are indexed by the file
+// dependency and glob patterns by the path of each matching blob.
+func (d *stdDiscover) fileDependencyHashes(commit Commit, meta *moduleMetadata, blobs map[string]Blob) (map[string]string, error) {
+	spec := meta.spec
+	paths, globs := splitGlobs(spec.FileDependencies)
+	hashes := make(map[string]string)
+	for _, f := range paths {
+		fh, err := d.Repo.EntryID(commit, f)
+		if err != nil {
+			return nil, e.Wrapf(ErrClassUser, err, msgFileDependencyNotFound, f, spec.Name, meta.dir)
+		}
+
+		hashes[f] = fh
+	}
+
+	return matchFileDependencies(meta, globs, blobs, hashes)
+}
+
+// matchFileDependencies adds the hashes of the blobs matched by
+// the glob patterns in file dependencies of a module to hashes,
+// indexed by the path of each blob.
+func matchFileDependencies(meta *moduleMetadata, globs []string, blobs map[string]Blob, hashes map[string]string) (map[string]string, error) {
+	if len(globs) == 0 {
+		return hashes, nil
+	}
+
+	matcher, err := newPathMatcher(globs, false)
+	if err != nil {
+		return nil, e.Wrapf(ErrClassUser, err, msgInvalidFileDependency, meta.spec.Name, meta.dir)
+	}
+
+	for p, b := range blobs {
+		if matcher.Match(p) {
+			hashes[p] = b.ID()
+		}
+	}
+
+	return hashes, nil
+}
+
+// applyDefaults merges the repository defaults and the kinds into
+// the spec of each module. exists is false when the repository does
+// not have a defaults file.
+// Modules are versioned with the hash of the resolved spec rather than
+// the defaults file. Therefore, changes to the parts of the defaults a
+// module does not inherit (e.g. other kinds) do not change its version.
+func applyDefaults(metadataSet moduleMetadataSet, contents []byte, exists bool) error {
+	defaults := &specDefaults{}
+	if exists {
+		var err error
+		defaults, err = newSpecDefaults(contents)
+		if err != nil {
+			return e.Wrapf(ErrClassUser, err, "error while parsing the defaults at %s", defaultsFileName)
+		}
+	}
+
+	for _, meta := range metadataSet {
+		own, err := specHash(meta.spec)
+		if err != nil {
+			return err
+		}
+
+		err = defaults.apply(meta.spec)
+		if err != nil {
+			return err
+		}
+
+		resolved, err := specHash(meta.spec)
+		if err != nil {
+			return err
+		}
+
+		if resolved != own {
+			meta.defaultsHash = resolved
+		}
+	}
+
+	return nil
+}
+
 func newModuleMetadata(dir string, hash string, spec *Spec, dependentFileHashes map[string]string) *moduleMetadata {
 	/*
 		Normalise the module dir. We always use paths
@@ -191,6 +411,14 @@ func newSpec(content []byte) (*Spec, error) {
 		return nil, err
 	}
 
+	// Unknown keys are usually typos (e.g. dependancies) that would
+	// otherwise be silently ignored.
+	problems := checkSpecKeys(parseSpecNode(content))
+	if len(problems) > 0 {
+		p := problems[0]
+		return nil, e.NewErrorf(ErrClassUser, msgInvalidSpecKey, p.Line, p.Column, p.Message)
+	}
+
 	a.Properties, err = transformProps(a.Properties)
 	if err != nil {
 		return nil, err
@@ -265,35 +493,55 @@ func toModules(a moduleMetadataSet) (Modules, error) {
 // initialises their version field.
 func calculateVersion(topSorted Modules) Modules {
 	for _, a := range topSorted {
-		if a.Hash() == "local" {
-			a.version = "local"
+		if len(a.Requires()) == 0 && len(a.FileDependencies()) == 0 && a.metadata.defaultsHash == "" {
+			// Fast path for modules without any dependencies
+			a.version = a.Hash()
 		} else {
-			if len(a.Requires()) == 0 && len(a.FileDependencies()) == 0 {
-				// Fast path for modules without any dependencies
-				a.version = a.Hash()
-			} else {
-				// This module has dependencies.
-				// Version is created by combining the hashes of the module
-				// content, its file dependencies and the hashes of the dependencies.
-				h := sha1.New()
-
-				io.WriteString(h, a.Hash())
-				// Consider the version of all dependencies to compute the version of
-				// current module.
-				// It is unnecessary to traverse the entire dependency graph
-				// here because we are processing the list of modules in topological
-				// order. Therefore, version of a dependency would already contain
-				// the version of its dependencies.
-				for _, r := range a.Requires() {
-					io.WriteString(h, r.Version())
+			// This module has dependencies.
+			// Version is created by combining the hashes of the module
+			// content, inherited defaults, its file dependencies and the
+			// hashes of the dependencies.
+			h := sha1.New()
+
+			io.WriteString(h, a.Hash())
+			io.WriteString(h, a.metadata.defaultsHash)
+			// Consider the version of all dependencies to compute the version of
+			// current module.
+			// It is unnecessary to traverse the entire dependency graph
+			// here because we are processing the list of modules in topological
+			// order. Therefore, version of a dependency would already contain
+			// the version of its dependencies.
+			for _, r := range a.Requires() {
+				io.WriteString(h, r.Version())
+			}
+
+			paths, globs := splitGlobs(a.FileDependencies())
+			for _, f := range paths {
+				io.WriteString(h, a.metadata.dependentFileHashes[f])
+			}
+
+			if len(globs) > 0 {
+				// Hashes of the files matching glob patterns are indexed
+				// by their paths, which are also part of the version.
+				isPath := make(map[string]bool, len(paths))
+				for _, f := range paths {
+					isPath[f] = true
 				}
 
-				for _, f := range a.FileDependencies() {
-					io.WriteString(h, a.metadata.dependentFileHashes[f])
+				files := make([]string, 0, len(a.metadata.dependentFileHashes))
+				for f := range a.metadata.dependentFileHashes {
+					if !isPath[f] {
+						files = append(files, f)
+					}
 				}
+				sort.Strings(files)
 
-				a.version = hex.EncodeToString(h.Sum(nil))
+				for _, f := range files {
+					fmt.Fprintf(h, "%s\x00%s\x00", f, a.metadata.dependentFileHashes[f])
+				}
 			}
+
+			a.version = hex.EncodeToString(h.Sum(nil))
 		}
 	}
 
@@ -199,3 +199,40 @@ func TestVersionChangeOnFileDependencyChange(t *testing.T) {
 
 	assert.NotEqual(t, m2[0].Version(), m1[0].Version())
 }
+
+func TestVersionChangeOnFileDependencyPatternChange(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.InitModuleWithOptions("app-a", &Spec{
+		Name:             "app-a",
+		FileDependencies: []string{"shared/**/*.proto", "!**/internal/**"},
+	}))
+
+	check(t, repo.WriteContent("shared/a/foo.proto", "hello"))
+	check(t, repo.WriteContent("shared/internal/bar.proto", "hello"))
+	check(t, repo.Commit("first"))
+
+	world := NewWorld(t, ".tmp/repo")
+	c1, err := world.Repo.GetCommit(repo.LastCommit.String())
+	check(t, err)
+	m1, err := world.Discover.ModulesInCommit(c1)
+	check(t, err)
+
+	check(t, repo.AppendContent("shared/internal/bar.proto", "world"))
+	check(t, repo.Commit("second"))
+	c2, err := world.Repo.GetCommit(repo.LastCommit.String())
+	check(t, err)
+	m2, err := world.Discover.ModulesInCommit(c2)
+	check(t, err)
+
+	check(t, repo.WriteContent("shared/b/baz.proto", "hello"))
+	check(t, repo.Commit("third"))
+	c3, err := world.Repo.GetCommit(repo.LastCommit.String())
+	check(t, err)
+	m3, err := world.Discover.ModulesInCommit(c3)
+	check(t, err)
+
+	assert.Equal(t, m1[0].Version(), m2[0].Version())
+	assert.NotEqual(t, m2[0].Version(), m3[0].Version())
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"encoding/json"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/mbtproject/mbt/e"
+)
+
+// exitCode returns the exit code of the process that caused err.
+func exitCode(err error) int {
+	for err != nil {
+		switch v := err.(type) {
+		case *exec.ExitError:
+			return v.ExitCode()
+		case *e.E:
+			err = v.InnerError()
+		default:
+			return -1
+		}
+	}
+
+	return 0
+}
+
+type jsonEventSink struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+type jsonEvent struct {
+	Type       EventType `json:"type"`
+	Time       time.Time `json:"time"`
+	Command    string    `json:"command"`
+	Sha        string    `json:"sha"`
+	Module     string    `json:"module,omitempty"`
+	Path       string    `json:"path,omitempty"`
+	Version    string    `json:"version,omitempty"`
+	DurationMs *int64    `json:"durationMs,omitempty"`
+	ExitCode   *int      `json:"exitCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// NewJSONEventSink creates an EventSink that writes the events to w
+// in newline delimited json format.
+func NewJSONEventSink(w io.Writer) EventSink {
+	return &jsonEventSink{encoder: json.NewEncoder(w)}
+}
+
+func (s *jsonEventSink) Emit(event *Event) error {
+	j := &jsonEvent{
+		Type:    event.Type,
+		Time:    event.Time,
+		Command: event.Command,
+		Sha:     event.Sha,
+	}
+
+	if event.Module != nil {
+		j.Module = event.Module.Name()
+		j.Path = event.Module.Path()
+		j.Version = event.Module.Version()
+	}
+
+	switch event.Type {
+	case EventModuleCompleted, EventModuleFailed:
+		code := event.ExitCode
+		j.ExitCode = &code
+		fallthrough
+	case EventBuildFinished:
+		ms := int64(event.Duration / time.Millisecond)
+		j.DurationMs = &ms
+	}
+
+	j.Error = errorMessage(event.Err)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.encoder.Encode(j)
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mbtproject/mbt/e"
+	"github.com/stretchr/testify/assert"
+)
+
+type eventRecorder struct {
+	events []*Event
+}
+
+func (r *eventRecorder) Emit(event *Event) error {
+	r.events = append(r.events, event)
+	return nil
+}
+
+func (r *eventRecorder) types() []EventType {
+	types := make([]EventType, 0, len(r.events))
+	for _, event := range r.events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func TestJSONEventSink(t *testing.T) {
+	mod := newModule(newModuleMetadata("app-a", "abc", &Spec{Name: "app-a"}, nil), nil)
+	mod.version = "abc"
+	buff := new(bytes.Buffer)
+	sink := NewJSONEventSink(buff)
+
+	now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	check(t, sink.Emit(&Event{Type: EventBuildStarted, Time: now, Command: "build", Sha: "sha"}))
+	check(t, sink.Emit(&Event{Type: EventModuleFailed, Time: now, Command: "build", Sha: "sha", Module: mod, Duration: 1500 * time.Millisecond, ExitCode: 2, Err: errors.New("boom")}))
+
+	lines := strings.Split(strings.TrimSpace(buff.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.Equal(t, `{"type":"build_started","time":"2018-01-01T00:00:00Z","command":"build","sha":"sha"}`, lines[0])
+
+	v := make(map[string]interface{})
+	check(t, json.Unmarshal([]byte(lines[1]), &v))
+	assert.Equal(t, "module_failed", v["type"])
+	assert.Equal(t, "app-a", v["module"])
+	assert.Equal(t, "app-a", v["path"])
+	assert.Equal(t, "abc", v["version"])
+	assert.Equal(t, float64(1500), v["durationMs"])
+	assert.Equal(t, float64(2), v["exitCode"])
+	assert.Equal(t, "boom", v["error"])
+}
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, 0, exitCode(nil))
+	assert.Equal(t, -1, exitCode(errors.New("boom")))
+
+	err := exec.Command("sh", "-c", "exit 3").Run()
+	assert.Equal(t, 3, exitCode(err))
+	assert.Equal(t, 3, exitCode(e.Wrap(ErrClassUser, err)))
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"context"
+	"time"
+
+	"github.com/mbtproject/mbt/e"
+)
+
+// execWithRetries executes a module command via the ProcessManager.
+// Each attempt is stopped after the specified timeout (if non-zero) and
+// failed attempts are repeated up to the specified number of retries.
+// Commands are not retried once options.Context is done.
+func (s *stdSystem) execWithRetries(m *Manifest, mod *Module, options *CmdOptions, timeout time.Duration, retries int, command string, args ...string) error {
+	ctx := options.context()
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			s.Log.Warnf(msgRetryingCommand, mod.Name(), attempt, retries, err)
+		}
+
+		err = s.execAttempt(ctx, m, mod, options, timeout, command, args...)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+func (s *stdSystem) execAttempt(ctx context.Context, m *Manifest, mod *Module, options *CmdOptions, timeout time.Duration, command string, args ...string) error {
+	attemptCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	err := s.ProcessManager.Exec(attemptCtx, m, mod, options, command, args...)
+	if err != nil && ctx.Err() == nil && attemptCtx.Err() == context.DeadlineExceeded {
+		return e.NewErrorf(ErrClassUser, msgCommandTimedOut, timeout)
+	}
+
+	return err
+}
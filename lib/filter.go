@@ -0,0 +1,345 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/mbtproject/mbt/e"
+	"github.com/mbtproject/mbt/utils"
+)
+
+// filterExpr is a parsed filter expression (see parseFilter).
+type filterExpr interface {
+	match(m *Module) bool
+}
+
+type filterAnd struct {
+	left, right filterExpr
+}
+
+func (f *filterAnd) match(m *Module) bool {
+	return f.left.match(m) && f.right.match(m)
+}
+
+type filterOr struct {
+	left, right filterExpr
+}
+
+func (f *filterOr) match(m *Module) bool {
+	return f.left.match(m) || f.right.match(m)
+}
+
+type filterNot struct {
+	expr filterExpr
+}
+
+func (f *filterNot) match(m *Module) bool {
+	return !f.expr.match(m)
+}
+
+// filterComparison compares a field of the module with a value.
+type filterComparison struct {
+	field string
+	// property is the path of the property when field is properties.
+	property []string
+	op       string
+	value    string
+	// glob is the compiled value when it is a pattern
+	// or the field is path.
+	glob *regexp.Regexp
+}
+
+func (f *filterComparison) match(m *Module) bool {
+	values := f.values(m)
+	matched := false
+	for _, v := range values {
+		if f.matchValue(v) {
+			matched = true
+			break
+		}
+	}
+
+	if f.op == "!=" {
+		return !matched
+	}
+
+	return matched
+}
+
+// values returns the values of the field in a module. A field may
+// have multiple values (e.g. command) or none (e.g. a missing property).
+func (f *filterComparison) values(m *Module) []string {
+	switch f.field {
+	case "name":
+		return []string{m.Name()}
+	case "path":
+		return []string{m.Path()}
+	case "kind":
+		return []string{m.Kind()}
+	case "command":
+		commands := make([]string, 0, len(m.Commands()))
+		for c := range m.Commands() {
+			commands = append(commands, c)
+		}
+		sort.Strings(commands)
+		return commands
+	default:
+		v := resolveProperty(m.Properties(), f.property, nil)
+		if v == nil {
+			return []string{}
+		}
+		return []string{fmt.Sprint(v)}
+	}
+}
+
+func (f *filterComparison) matchValue(v string) bool {
+	switch {
+	case f.op == "~":
+		return utils.IsSubsequence(v, f.value, true)
+	case f.glob != nil:
+		return f.glob.MatchString(v)
+	default:
+		return strings.EqualFold(v, f.value)
+	}
+}
+
+// parseFilter parses a filter expression.
+// An expression consists of comparisons in <field><op><value> form
+// combined with and, or, not and parentheses. Fields are name, path,
+// kind, command and properties.<name> (nested properties are separated
+// by dots). Operators are = (case insensitive match, values can be
+// glob patterns), != (negation of =) and ~ (fuzzy match). Values
+// containing whitespace or special characters can be quoted.
+func parseFilter(expression string) (filterExpr, error) {
+	tokens, err := tokenizeFilter(expression)
+	if err != nil {
+		return nil, e.NewErrorf(ErrClassUser, msgInvalidFilter, expression, err)
+	}
+
+	p := &filterParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err == nil && !p.done() {
+		err = fmt.Errorf("unexpected '%s'", p.peek().text)
+	}
+
+	if err != nil {
+		return nil, e.NewErrorf(ErrClassUser, msgInvalidFilter, expression, err)
+	}
+
+	return expr, nil
+}
+
+type filterTokenKind int
+
+const (
+	filterWord filterTokenKind = iota
+	filterString
+	filterOperator
+	filterOpen
+	filterClose
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	text string
+}
+
+func tokenizeFilter(s string) ([]*filterToken, error) {
+	tokens := make([]*filterToken, 0)
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, &filterToken{kind: filterOpen, text: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, &filterToken{kind: filterClose, text: ")"})
+			i++
+		case c == '=' || c == '~':
+			tokens = append(tokens, &filterToken{kind: filterOperator, text: string(c)})
+			i++
+		case c == '!':
+			if i+1 >= len(runes) || runes[i+1] != '=' {
+				return nil, fmt.Errorf("unexpected '!' at position %v", i+1)
+			}
+			tokens = append(tokens, &filterToken{kind: filterOperator, text: "!="})
+			i += 2
+		case c == '\'' || c == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != c {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %v", i+1)
+			}
+			tokens = append(tokens, &filterToken{kind: filterString, text: string(runes[i+1 : end])})
+			i = end + 1
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune("()=~!'\"", runes[end]) {
+				end++
+			}
+			tokens = append(tokens, &filterToken{kind: filterWord, text: string(runes[i:end])})
+			i = end
+		}
+	}
+
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []*filterToken
+	pos    int
+}
+
+func (p *filterParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *filterParser) peek() *filterToken {
+	if p.done() {
+		return nil
+	}
+
+	return p.tokens[p.pos]
+}
+
+// keyword returns true and consumes the next token if it is
+// the specified keyword.
+func (p *filterParser) keyword(k string) bool {
+	t := p.peek()
+	if t != nil && t.kind == filterWord && strings.EqualFold(t.text, k) {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+func (p *filterParser) parseOr() (filterExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterOr{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("and") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterAnd{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterExpr, error) {
+	if p.keyword("not") {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &filterNot{expr}, nil
+	}
+
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+
+	if t.kind == filterOpen {
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if t := p.peek(); t == nil || t.kind != filterClose {
+			return nil, fmt.Errorf("missing ')'")
+		}
+		p.pos++
+		return expr, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (filterExpr, error) {
+	field := p.peek()
+	if field.kind != filterWord {
+		return nil, fmt.Errorf("unexpected '%s'", field.text)
+	}
+	p.pos++
+
+	c := &filterComparison{field: strings.ToLower(field.text)}
+	switch {
+	case c.field == "name" || c.field == "path" || c.field == "kind" || c.field == "command":
+	case strings.HasPrefix(c.field, "properties.") && len(c.field) > len("properties."):
+		c.field = "properties"
+		c.property = strings.Split(field.text[len("properties."):], ".")
+	default:
+		return nil, fmt.Errorf("unknown field '%s'", field.text)
+	}
+
+	op := p.peek()
+	if op == nil || op.kind != filterOperator {
+		return nil, fmt.Errorf("expected an operator after '%s'", field.text)
+	}
+	p.pos++
+	c.op = op.text
+
+	value := p.peek()
+	if value == nil || (value.kind != filterWord && value.kind != filterString) {
+		return nil, fmt.Errorf("expected a value after '%s%s'", field.text, op.text)
+	}
+	p.pos++
+	c.value = value.text
+
+	if c.op != "~" && (c.field == "path" || strings.ContainsAny(c.value, "*?[")) {
+		glob, err := compileGlob(c.value, true)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s'", c.value)
+		}
+		c.glob = glob
+	}
+
+	return c, nil
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mbtproject/mbt/e"
+	"github.com/stretchr/testify/assert"
+)
+
+func newFilterTestManifest(t *testing.T) *Manifest {
+	repo := NewMemoryRepo(".tmp/repo")
+	repo.WriteFile(defaultsFileName, "kinds:\n  go-service: {}\n")
+	repo.WriteFile("services/payments/.mbt.yml", `name: payments-api
+kind: go-service
+commands:
+  test:
+    cmd: go
+properties:
+  team: payments
+  deploy:
+    region: eu
+`)
+	repo.WriteFile("services/legacy-billing/.mbt.yml", `name: legacy-billing
+properties:
+  team: payments
+`)
+	repo.WriteFile("web/.mbt.yml", `name: web
+commands:
+  lint:
+    cmd: eslint
+properties:
+  team: frontend
+  replicas: 2
+`)
+	_, err := repo.Commit("first")
+	check(t, err)
+
+	m, err := NewSystemWith(repo).ManifestByCurrentBranch()
+	check(t, err)
+
+	return m
+}
+
+func TestFilterExpressions(t *testing.T) {
+	m := newFilterTestManifest(t)
+
+	cases := []struct {
+		expression string
+		expected   []string
+	}{
+		{"name=web", []string{"web"}},
+		{"name=WEB", []string{"web"}},
+		{"name=*-api", []string{"payments-api"}},
+		{"name~lgb", []string{"legacy-billing"}},
+		{"path=services", []string{"legacy-billing", "payments-api"}},
+		{"path=services/**", []string{"legacy-billing", "payments-api"}},
+		{"path=services/pay*", []string{"payments-api"}},
+		{"kind=go-service", []string{"payments-api"}},
+		{"kind!=go-service", []string{"legacy-billing", "web"}},
+		{"command=test", []string{"payments-api"}},
+		{"command!=test", []string{"legacy-billing", "web"}},
+		{"properties.team=payments", []string{"legacy-billing", "payments-api"}},
+		{"properties.deploy.region=eu", []string{"payments-api"}},
+		{"properties.replicas=2", []string{"web"}},
+		{"properties.missing!=x", []string{"legacy-billing", "payments-api", "web"}},
+		{"path=services/** and properties.team=payments and not name~legacy", []string{"payments-api"}},
+		{"name=web or kind=go-service", []string{"payments-api", "web"}},
+		{"not (name=web or kind=go-service)", []string{"legacy-billing"}},
+		{"name=web or name=legacy-billing and properties.team=frontend", []string{"web"}},
+		{"properties.team='payments'", []string{"legacy-billing", "payments-api"}},
+		{`NOT name="web"`, []string{"legacy-billing", "payments-api"}},
+	}
+
+	for _, c := range cases {
+		f, err := m.ApplyFilters(&FilterOptions{Expression: c.expression})
+		check(t, err)
+		assert.ElementsMatch(t, c.expected, f.Modules.names(), c.expression)
+	}
+}
+
+func TestFilterExpressionWithOtherFilters(t *testing.T) {
+	m := newFilterTestManifest(t)
+
+	f, err := m.ApplyFilters(&FilterOptions{Name: "web,payments-api", Expression: "properties.team=payments"})
+	check(t, err)
+
+	assert.Equal(t, []string{"payments-api"}, f.Modules.names())
+}
+
+func TestInvalidFilterExpressions(t *testing.T) {
+	m := newFilterTestManifest(t)
+
+	cases := map[string]string{
+		"":                       "unexpected end of expression",
+		"name":                   "expected an operator after 'name'",
+		"name=":                  "expected a value after 'name='",
+		"owner=a":                "unknown field 'owner'",
+		"properties.=a":          "unknown field 'properties.'",
+		"name=a and":             "unexpected end of expression",
+		"(name=a":                "missing ')'",
+		"name=a)":                "unexpected ')'",
+		"name=a name=b":          "unexpected 'name'",
+		"name='a":                "unterminated string at position 6",
+		"name!a":                 "unexpected '!' at position 5",
+		"= a":                    "unexpected '='",
+		"name=a or or name=b":    "unknown field 'or'",
+		"not":                    "unexpected end of expression",
+		"path=a and (name=b or)": "unexpected ')'",
+	}
+
+	for expression, msg := range cases {
+		_, err := parseFilter(expression)
+		if assert.Error(t, err, expression) {
+			assert.EqualError(t, err, fmt.Sprintf(msgInvalidFilter, expression, msg))
+			assert.Equal(t, ErrClassUser, (err.(*e.E)).Class())
+		}
+	}
+
+	_, err := m.ApplyFilters(&FilterOptions{Expression: "name=(a"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,723 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/mbtproject/mbt/e"
+)
+
+type gogitBlob struct {
+	path string
+	name string
+	hash plumbing.Hash
+	mode filemode.FileMode
+}
+
+func (b *gogitBlob) ID() string {
+	return b.hash.String()
+}
+
+func (b *gogitBlob) Name() string {
+	return b.name
+}
+
+func (b *gogitBlob) Path() string {
+	return b.path
+}
+
+func (b *gogitBlob) Mode() uint32 {
+	return uint32(b.mode)
+}
+
+func (b *gogitBlob) String() string {
+	return fmt.Sprintf("%s%s", b.Path(), b.Name())
+}
+
+type gogitCommit struct {
+	commit *object.Commit
+	tree   *object.Tree
+}
+
+func (c *gogitCommit) ID() string {
+	return c.commit.Hash.String()
+}
+
+func (c *gogitCommit) String() string {
+	return c.ID()
+}
+
+func (c *gogitCommit) Tree() (*object.Tree, error) {
+	if c.tree == nil {
+		tree, err := c.commit.Tree()
+		if err != nil {
+			return nil, e.Wrapf(ErrClassInternal, err, msgFailedTreeLoad, c.commit.Hash)
+		}
+		c.tree = tree
+	}
+
+	return c.tree, nil
+}
+
+type gogitReference struct {
+	name         string
+	symbolicName string
+	hash         plumbing.Hash
+}
+
+func (r *gogitReference) Name() string {
+	return r.name
+}
+
+func (r *gogitReference) SymbolicName() string {
+	return r.symbolicName
+}
+
+type gogitRepo struct {
+	path string
+	Repo *gogit.Repository
+	Log  Log
+}
+
+// upstreamRevision matches the revisions referring to the upstream
+// of a branch (e.g. master@{upstream} or @{u}~1).
+var upstreamRevision = regexp.MustCompile(`^([^@]*)@\{(u|upstream)\}(.*)$`)
+
+var hexPrefix = regexp.MustCompile(`^[0-9a-fA-F]{4,39}$`)
+
+// NewGoGitRepo creates a Repo implemented in pure Go.
+// Unlike the libgit2 based implementation, it does not require cgo.
+func NewGoGitRepo(path string, log Log) (Repo, error) {
+	repo, err := gogit.PlainOpen(path)
+	if err == gogit.ErrRepositoryNotExists {
+		// Report the same error as libgit2 does.
+		err = fmt.Errorf("could not find repository from '%s'", path)
+	}
+
+	if err != nil {
+		return nil, e.Wrapf(ErrClassUser, err, msgFailedOpenRepo, path)
+	}
+
+	return &gogitRepo{
+		path: path,
+		Repo: repo,
+		Log:  log,
+	}, nil
+}
+
+func (r *gogitRepo) GetCommit(commitSha string) (Commit, error) {
+	if len(commitSha) != 40 || !plumbing.IsHash(commitSha) {
+		return nil, e.NewErrorf(ErrClassUser, msgInvalidSha, commitSha)
+	}
+
+	commit, err := r.Repo.CommitObject(plumbing.NewHash(commitSha))
+	if err != nil {
+		return nil, e.Wrapf(ErrClassUser, err, msgCommitShaNotFound, commitSha)
+	}
+
+	return &gogitCommit{commit: commit}, nil
+}
+
+func (r *gogitRepo) ResolveRevision(rev string) (Commit, error) {
+	expr := rev
+	if m := upstreamRevision.FindStringSubmatch(rev); m != nil {
+		upstream, err := r.upstream(m[1])
+		if err != nil {
+			return nil, e.Wrapf(ErrClassUser, err, msgUnknownRevision, rev)
+		}
+		expr = upstream + m[3]
+	}
+
+	err := r.ensureUnambiguous(expr)
+	if err != nil {
+		return nil, e.Wrapf(ErrClassUser, err, msgAmbiguousRevision, rev)
+	}
+
+	hash, err := r.Repo.ResolveRevision(plumbing.Revision(expr))
+	if err != nil {
+		return nil, e.Wrapf(ErrClassUser, err, msgUnknownRevision, rev)
+	}
+
+	commit, err := r.Repo.CommitObject(*hash)
+	if err != nil {
+		return nil, e.Wrapf(ErrClassUser, err, msgRevisionNotCommit, rev)
+	}
+
+	return &gogitCommit{commit: commit}, nil
+}
+
+// upstream returns the name of the remote tracking branch configured
+// as the upstream of a branch (current branch if name is empty).
+func (r *gogitRepo) upstream(name string) (string, error) {
+	if name == "" || name == "HEAD" {
+		var err error
+		name, err = r.CurrentBranch()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	b, err := r.Repo.Branch(name)
+	if err != nil {
+		return "", err
+	}
+
+	if b.Remote == "" || b.Merge == "" {
+		return "", fmt.Errorf("no upstream configured for branch '%s'", name)
+	}
+
+	if b.Remote == "." {
+		return b.Merge.String(), nil
+	}
+
+	return plumbing.NewRemoteReferenceName(b.Remote, b.Merge.Short()).String(), nil
+}
+
+// ensureUnambiguous returns an error if the abbreviated sha at the
+// beginning of a revision matches more than one commit.
+func (r *gogitRepo) ensureUnambiguous(rev string) error {
+	prefix := rev
+	if i := strings.IndexAny(rev, "~^:@"); i >= 0 {
+		prefix = rev[:i]
+	}
+
+	if !hexPrefix.MatchString(prefix) {
+		return nil
+	}
+
+	prefix = strings.ToLower(prefix)
+	iter, err := r.Repo.CommitObjects()
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	matches := 0
+	err = iter.ForEach(func(c *object.Commit) error {
+		if strings.HasPrefix(c.Hash.String(), prefix) {
+			matches++
+		}
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if matches > 1 {
+		return fmt.Errorf("short sha %s matches %v commits", prefix, matches)
+	}
+
+	return nil
+}
+
+func (r *gogitRepo) Path() string {
+	return r.path
+}
+
+func (r *gogitRepo) Diff(a, b Commit) ([]*DiffDelta, error) {
+	return r.diff(a, b)
+}
+
+func (r *gogitRepo) DiffMergeBase(from, to Commit) ([]*DiffDelta, error) {
+	bc, err := r.MergeBase(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.diff(bc, to)
+}
+
+func (r *gogitRepo) DiffWorkspace() ([]*DiffDelta, error) {
+	status, err := r.status()
+	if err != nil {
+		return nil, err
+	}
+
+	deltas := make([]*DiffDelta, 0)
+	for _, p := range sortedPaths(status) {
+		if status[p].Worktree != gogit.Unmodified {
+			deltas = append(deltas, &DiffDelta{OldFile: p, NewFile: p})
+		}
+	}
+
+	return deltas, nil
+}
+
+func (r *gogitRepo) Changes(c Commit) ([]*DiffDelta, error) {
+	commit := c.(*gogitCommit).commit
+	np := commit.NumParents()
+	r.Log.Debug("Commit %v has %v parents", commit.Hash, np)
+	if np == 0 {
+		return []*DiffDelta{}, nil
+	}
+
+	p, err := commit.Parent(0)
+	if err != nil {
+		return nil, e.Wrap(ErrClassInternal, err)
+	}
+	r.Log.Debug("Changes are based on parent %v", p.Hash)
+
+	return r.diff(c, &gogitCommit{commit: p})
+}
+
+func (r *gogitRepo) WalkBlobs(commit Commit, callback BlobWalkCallback) error {
+	tree, err := commit.(*gogitCommit).Tree()
+	if err != nil {
+		return err
+	}
+
+	var walkErr error
+	err = tree.Files().ForEach(func(f *object.File) error {
+		dir := path.Dir(f.Name)
+		if dir == "." {
+			dir = ""
+		} else {
+			dir += "/"
+		}
+
+		walkErr = callback(&gogitBlob{path: dir, name: path.Base(f.Name), hash: f.Hash, mode: f.Mode})
+		return walkErr
+	})
+
+	if walkErr != nil {
+		return walkErr
+	}
+
+	if err != nil {
+		return e.Wrapf(ErrClassInternal, err, msgFailedTreeWalk, tree.Hash)
+	}
+
+	return nil
+}
+
+func (r *gogitRepo) BlobContents(blob Blob) ([]byte, error) {
+	b, err := r.Repo.BlobObject(blob.(*gogitBlob).hash)
+	if err != nil {
+		return nil, e.Wrapf(ErrClassInternal, err, msgFailedBlobRead, blob.Path(), blob.Name())
+	}
+
+	return readBlob(b)
+}
+
+func (r *gogitRepo) BlobContentsFromTree(commit Commit, path string) ([]byte, error) {
+	t, err := commit.(*gogitCommit).Tree()
+	if err != nil {
+		return nil, e.Wrap(ErrClassInternal, err)
+	}
+
+	f, err := t.File(path)
+	if err != nil {
+		return nil, e.Wrap(ErrClassInternal, err)
+	}
+
+	contents, err := readBlob(&f.Blob)
+	if err != nil {
+		return nil, e.Wrap(ErrClassInternal, err)
+	}
+
+	return contents, nil
+}
+
+func (r *gogitRepo) EntryID(commit Commit, path string) (string, error) {
+	tree, err := commit.(*gogitCommit).Tree()
+	if err != nil {
+		return "", err
+	}
+
+	if path == "" {
+		return tree.Hash.String(), nil
+	}
+
+	entry, err := tree.FindEntry(path)
+	if err != nil {
+		return "", e.Wrapf(ErrClassInternal, err, msgFailedTreeEntryRead, path)
+	}
+
+	return entry.Hash.String(), nil
+}
+
+func (r *gogitRepo) BranchCommit(name string) (Commit, error) {
+	// Same lookup rules as git_reference_dwim in libgit2.
+	for _, format := range []string{"%s", "refs/%s", "refs/tags/%s", "refs/heads/%s", "refs/remotes/%s", "refs/remotes/%s/HEAD"} {
+		ref, err := r.Repo.Reference(plumbing.ReferenceName(fmt.Sprintf(format, name)), true)
+		if err == nil {
+			return r.GetCommit(ref.Hash().String())
+		}
+	}
+
+	err := fmt.Errorf("no reference found for shorthand '%s'", name)
+	return nil, e.Wrapf(ErrClassUser, err, msgFailedBranchLookup, name)
+}
+
+func (r *gogitRepo) CurrentBranch() (string, error) {
+	head, err := r.Repo.Head()
+	if err != nil {
+		return "", e.Wrap(ErrClassInternal, err)
+	}
+
+	if !head.Name().IsBranch() {
+		return "", e.NewError(ErrClassInternal, msgDetachedHead)
+	}
+
+	return head.Name().Short(), nil
+}
+
+func (r *gogitRepo) CurrentBranchCommit() (Commit, error) {
+	b, err := r.CurrentBranch()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.BranchCommit(b)
+}
+
+func (r *gogitRepo) IsEmpty() (bool, error) {
+	_, err := r.Repo.Head()
+	if err == plumbing.ErrReferenceNotFound {
+		return true, nil
+	}
+
+	if err != nil {
+		return false, e.Wrap(ErrClassInternal, err)
+	}
+
+	return false, nil
+}
+
+func (r *gogitRepo) FindAllFilesInWorkspace(pathSpec []string) ([]string, error) {
+	idx, err := r.Repo.Storer.Index()
+	if err != nil {
+		return nil, e.Wrap(ErrClassInternal, err)
+	}
+
+	status, err := r.status()
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]bool)
+	for _, entry := range idx.Entries {
+		files[entry.Name] = true
+	}
+
+	for p, s := range status {
+		switch s.Worktree {
+		case gogit.Deleted:
+			delete(files, p)
+		case gogit.Untracked:
+			files[p] = true
+		}
+	}
+
+	var configPaths []string
+	for p := range files {
+		if matchPathSpec(pathSpec, p) {
+			r.Log.Debug("Matching file detected: %v", p)
+			configPaths = append(configPaths, p)
+		}
+	}
+	sort.Strings(configPaths)
+
+	r.Log.Debug("Discovered %v files matching the filter", len(configPaths))
+	return configPaths, nil
+}
+
+func (r *gogitRepo) WorkspaceFileContents(path string) ([]byte, error) {
+	return readWorkspaceFile(r.path, path)
+}
+
+func (r *gogitRepo) WorkspaceEntryIDs(paths []string) (map[string]string, error) {
+	h, err := r.workspaceHasher()
+	if err != nil {
+		return nil, err
+	}
+
+	return h.entryIDs(paths)
+}
+
+func (r *gogitRepo) WorkspaceBlobs() ([]Blob, error) {
+	h, err := r.workspaceHasher()
+	if err != nil {
+		return nil, err
+	}
+
+	return h.blobs()
+}
+
+func (r *gogitRepo) workspaceHasher() (*workspaceHasher, error) {
+	files, err := r.FindAllFilesInWorkspace([]string{"*"})
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := r.Repo.Storer.Index()
+	if err != nil {
+		return nil, e.Wrap(ErrClassInternal, err)
+	}
+
+	modes := make(map[string]uint32)
+	for _, entry := range idx.Entries {
+		modes[entry.Name] = uint32(entry.Mode)
+	}
+
+	return newWorkspaceHasher(r.path, files, modes), nil
+}
+
+func (r *gogitRepo) EnsureSafeWorkspace() error {
+	status, err := r.status()
+	if err != nil {
+		return err
+	}
+
+	if !status.IsClean() {
+		r.Log.Debug("Workspace has %v changes", len(status))
+		r.Log.Debug("Begin tracing all changes")
+		for _, p := range sortedPaths(status) {
+			r.Log.Debug("%v", p)
+		}
+		r.Log.Debug("End tracing all changes")
+		return e.NewError(ErrClassUser, msgDirtyWorkingDir)
+	}
+
+	return nil
+}
+
+func (r *gogitRepo) Checkout(commit Commit) (Reference, error) {
+	reference, err := r.readHeadReference()
+	if err != nil {
+		return nil, err
+	}
+
+	wt, err := r.Repo.Worktree()
+	if err != nil {
+		return nil, e.Wrap(ErrClassInternal, err)
+	}
+
+	err = wt.Checkout(&gogit.CheckoutOptions{Hash: commit.(*gogitCommit).commit.Hash})
+	if err != nil {
+		return reference, e.Wrap(ErrClassInternal, err)
+	}
+
+	return reference, nil
+}
+
+func (r *gogitRepo) CheckoutReference(reference Reference) error {
+	ref := reference.(*gogitReference)
+	wt, err := r.Repo.Worktree()
+	if err != nil {
+		return e.Wrap(ErrClassInternal, err)
+	}
+
+	options := &gogit.CheckoutOptions{Force: true}
+	if ref.SymbolicName() != "" {
+		options.Branch = plumbing.ReferenceName(ref.SymbolicName())
+	} else {
+		options.Hash = ref.hash
+	}
+
+	err = wt.Checkout(options)
+	if err != nil {
+		return e.Wrap(ErrClassInternal, err)
+	}
+
+	return nil
+}
+
+func (r *gogitRepo) Export(commit Commit, dir string) error {
+	tree, err := commit.(*gogitCommit).Tree()
+	if err != nil {
+		return err
+	}
+
+	err = tree.Files().ForEach(func(f *object.File) error {
+		return exportFile(f, filepath.Join(dir, filepath.FromSlash(f.Name)))
+	})
+
+	if err != nil {
+		return e.Wrap(ErrClassInternal, err)
+	}
+
+	return nil
+}
+
+func (r *gogitRepo) MergeBase(a, b Commit) (Commit, error) {
+	bases, err := a.(*gogitCommit).commit.MergeBase(b.(*gogitCommit).commit)
+	if err != nil {
+		return nil, e.Wrapf(ErrClassInternal, err, msgFailedMergeBase, a.ID(), b.ID())
+	}
+
+	if len(bases) == 0 {
+		return nil, e.NewErrorf(ErrClassInternal, msgFailedMergeBase, a.ID(), b.ID())
+	}
+
+	return &gogitCommit{commit: bases[0]}, nil
+}
+
+func (r *gogitRepo) readHeadReference() (Reference, error) {
+	head, err := r.Repo.Head()
+	if err != nil {
+		return nil, e.Wrap(ErrClassInternal, err)
+	}
+
+	reference := &gogitReference{name: head.Name().String(), hash: head.Hash()}
+	if head.Name().IsBranch() {
+		reference.symbolicName = head.Name().String()
+	}
+
+	return reference, nil
+}
+
+func (r *gogitRepo) status() (gogit.Status, error) {
+	wt, err := r.Repo.Worktree()
+	if err != nil {
+		return nil, e.Wrap(ErrClassInternal, err)
+	}
+
+	status, err := wt.Status()
+	if err != nil {
+		return nil, e.Wrap(ErrClassInternal, err)
+	}
+
+	return status, nil
+}
+
+func (r *gogitRepo) diff(ca, cb Commit) ([]*DiffDelta, error) {
+	t1, err := ca.(*gogitCommit).Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	t2, err := cb.(*gogitCommit).Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := object.DiffTreeWithOptions(context.Background(), t1, t2, object.DefaultDiffTreeOptions)
+	if err != nil {
+		return nil, e.Wrap(ErrClassInternal, err)
+	}
+
+	deltas := make([]*DiffDelta, 0, len(changes))
+	for _, c := range changes {
+		// Similar to libgit2, both paths are set for
+		// the files added or deleted while the renamed
+		// files have different paths.
+		from, to := c.From.Name, c.To.Name
+		if from == "" {
+			from = to
+		}
+		if to == "" {
+			to = from
+		}
+		deltas = append(deltas, &DiffDelta{OldFile: from, NewFile: to})
+	}
+
+	return deltas, nil
+}
+
+func readBlob(b *object.Blob) ([]byte, error) {
+	reader, err := b.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return ioutil.ReadAll(reader)
+}
+
+func exportFile(f *object.File, target string) error {
+	err := os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return err
+	}
+
+	reader, err := f.Reader()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if f.Mode == filemode.Symlink {
+		link, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(string(link), target)
+	}
+
+	perm := os.FileMode(0644)
+	if f.Mode == filemode.Executable {
+		perm = 0755
+	}
+
+	w, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, reader)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// matchPathSpec returns true if p matches any of the specified git
+// pathspecs. Similar to git, wildcards in pathspecs match the
+// directory separators and a pathspec without wildcards matches
+// the files within the directory it points to.
+func matchPathSpec(pathSpec []string, p string) bool {
+	for _, spec := range pathSpec {
+		spec = strings.TrimPrefix(spec, "/")
+		if p == spec || strings.HasPrefix(p, spec+"/") {
+			return true
+		}
+
+		pattern := regexp.QuoteMeta(spec)
+		pattern = strings.Replace(pattern, `\*`, `.*`, -1)
+		pattern = strings.Replace(pattern, `\?`, `.`, -1)
+		if ok, _ := regexp.MatchString("^"+pattern+"$", p); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortedPaths(status gogit.Status) []string {
+	paths := make([]string, 0, len(status))
+	for p := range status {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mbtproject/mbt/e"
+)
+
+type httpCache struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewHTTPCache creates a Cache backed by a remote http server.
+// Entries are accessed via the resource /<module>/<version> relative to
+// the base url with following methods.
+// - HEAD checks whether the entry exists (200 or 404)
+// - GET downloads the artifacts archive of the entry
+// - PUT uploads the artifacts archive of the entry
+func NewHTTPCache(baseURL string) Cache {
+	return &httpCache{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  http.DefaultClient,
+	}
+}
+
+func (c *httpCache) Has(name, version string) (bool, error) {
+	err := checkCacheKey(name, version)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := c.do(http.MethodHead, name, version, nil)
+	if err != nil {
+		return false, e.Wrapf(ErrClassInternal, err, msgFailedCacheRead, name, version)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, e.NewErrorf(ErrClassInternal, msgUnexpectedCacheResponse, http.MethodHead, res.Request.URL, res.Status)
+	}
+}
+
+func (c *httpCache) Get(name, version string) (io.ReadCloser, error) {
+	err := checkCacheKey(name, version)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.do(http.MethodGet, name, version, nil)
+	if err != nil {
+		return nil, e.Wrapf(ErrClassInternal, err, msgFailedCacheRead, name, version)
+	}
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return res.Body, nil
+	case http.StatusNotFound:
+		res.Body.Close()
+		return nil, e.NewErrorf(ErrClassInternal, msgCacheEntryNotFound, name, version)
+	default:
+		res.Body.Close()
+		return nil, e.NewErrorf(ErrClassInternal, msgUnexpectedCacheResponse, http.MethodGet, res.Request.URL, res.Status)
+	}
+}
+
+func (c *httpCache) Put(name, version string, artifacts io.Reader) error {
+	err := checkCacheKey(name, version)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.do(http.MethodPut, name, version, artifacts)
+	if err != nil {
+		return e.Wrapf(ErrClassInternal, err, msgFailedCacheWrite, name, version)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return e.NewErrorf(ErrClassInternal, msgUnexpectedCacheResponse, http.MethodPut, res.Request.URL, res.Status)
+	}
+
+	// Drain the body to allow the connection to be reused.
+	io.Copy(ioutil.Discard, res.Body)
+	return nil
+}
+
+func (c *httpCache) do(method, name, version string, body io.Reader) (*http.Response, error) {
+	u := c.baseURL + "/" + url.PathEscape(name) + "/" + url.PathEscape(version)
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/gzip")
+	}
+
+	return c.client.Do(req)
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// ignoreMatcher matches the files ignored by a module using
+// the patterns in gitignore syntax.
+type ignoreMatcher struct {
+	matcher gitignore.Matcher
+}
+
+// newIgnoreMatcher creates an ignoreMatcher for the specified patterns.
+// Blank patterns and comments (starting with #) are skipped.
+func newIgnoreMatcher(patterns []string) *ignoreMatcher {
+	parsed := make([]gitignore.Pattern, 0, len(patterns))
+	for _, p := range patterns {
+		if strings.TrimSpace(p) == "" || strings.HasPrefix(p, "#") {
+			continue
+		}
+		parsed = append(parsed, gitignore.ParsePattern(p, nil))
+	}
+
+	return &ignoreMatcher{matcher: gitignore.NewMatcher(parsed)}
+}
+
+// Match returns true if the file in path (relative to the module
+// directory) is ignored.
+func (m *ignoreMatcher) Match(path string) bool {
+	return m.matcher.Match(strings.Split(path, "/"), false)
+}
+
+// contentHash computes the hash of the files in a module directory
+// excluding the ones matched by ignore patterns.
+// blobs is the index of blobs by path in the commit tree.
+// Like the reducer (see contentMatcher), module directory is
+// matched case insensitively.
+func contentHash(dir string, patterns []string, blobs map[string]Blob) string {
+	prefix := ""
+	if dir != "" {
+		prefix = strings.ToLower(dir + "/")
+	}
+
+	ignore := newIgnoreMatcher(patterns)
+	files := make([]string, 0)
+	for p := range blobs {
+		if strings.HasPrefix(strings.ToLower(p), prefix) && !ignore.Match(p[len(prefix):]) {
+			files = append(files, p)
+		}
+	}
+	sort.Strings(files)
+
+	h := sha1.New()
+	for _, f := range files {
+		b := blobs[f]
+		fmt.Fprintf(h, "%s\x00%o\x00%s\x00", f[len(prefix):], b.Mode(), b.ID())
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIgnoreMatcher(t *testing.T) {
+	m := newIgnoreMatcher([]string{"# docs", "*.md", "docs/", "/build", "!CHANGELOG.md", ""})
+
+	assert.True(t, m.Match("README.md"))
+	assert.True(t, m.Match("src/README.md"))
+	assert.True(t, m.Match("docs/index.html"))
+	assert.True(t, m.Match("build/out"))
+	assert.False(t, m.Match("src/build/out"))
+	assert.False(t, m.Match("CHANGELOG.md"))
+	assert.False(t, m.Match("main.go"))
+}
+
+func testBlob(id string, mode uint32) Blob {
+	return &memoryBlob{id: id, mode: mode}
+}
+
+func TestContentHash(t *testing.T) {
+	blobs := map[string]Blob{
+		"app-a/main.go":   testBlob("a", gitModeFile),
+		"app-a/README.md": testBlob("b", gitModeFile),
+		"app-ab/main.go":  testBlob("c", gitModeFile),
+	}
+
+	h1 := contentHash("app-a", []string{"*.md"}, blobs)
+
+	blobs["app-a/README.md"] = testBlob("d", gitModeFile)
+	blobs["app-ab/main.go"] = testBlob("e", gitModeFile)
+	h2 := contentHash("app-a", []string{"*.md"}, blobs)
+
+	blobs["app-a/main.go"] = testBlob("f", gitModeFile)
+	h3 := contentHash("app-a", []string{"*.md"}, blobs)
+
+	assert.Equal(t, h1, h2)
+	assert.NotEqual(t, h2, h3)
+
+	// File modes are part of the hash
+	blobs["app-a/main.go"] = testBlob("f", gitModeExecutable)
+	h4 := contentHash("app-a", []string{"*.md"}, blobs)
+	assert.NotEqual(t, h3, h4)
+
+	// Module directory is matched case insensitively
+	blobs["App-A/other.go"] = testBlob("g", gitModeFile)
+	h5 := contentHash("app-a", []string{"*.md"}, blobs)
+	assert.NotEqual(t, h4, h5)
+}
+
+func TestContentHashSeparatesPathsAndIDs(t *testing.T) {
+	h1 := contentHash("", []string{"*.md"}, map[string]Blob{"ab": testBlob("c", gitModeFile)})
+	h2 := contentHash("", []string{"*.md"}, map[string]Blob{"a": testBlob("bc", gitModeFile)})
+
+	assert.NotEqual(t, h1, h2)
+}
@@ -16,12 +16,12 @@ limitations under the License.
 package lib
 
 func (s *stdSystem) IntersectionByCommit(first, second string) (Modules, error) {
-	c1, err := s.Repo.GetCommit(first)
+	c1, err := s.Repo.ResolveRevision(first)
 	if err != nil {
 		return nil, err
 	}
 
-	c2, err := s.Repo.GetCommit(second)
+	c2, err := s.Repo.ResolveRevision(second)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,66 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/mbtproject/mbt/e"
+)
+
+type isolatedWorkspaceManager struct {
+	Log  Log
+	Repo Repo
+}
+
+func (w *isolatedWorkspaceManager) ExportAndRun(commit string, fn func(dir string) (interface{}, error)) (interface{}, error) {
+	c, err := w.Repo.GetCommit(commit)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := ioutil.TempDir("", "mbt-")
+	if err != nil {
+		return nil, e.Wrap(ErrClassInternal, err)
+	}
+	defer w.remove(dir)
+
+	err = w.Repo.Export(c, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	w.Log.Infof(msgSuccessfulExport, commit, dir)
+	return fn(dir)
+}
+
+func (w *isolatedWorkspaceManager) remove(dir string) {
+	err := os.RemoveAll(dir)
+	if err != nil {
+		w.Log.Errorf(msgFailedRemovalOfExport, dir, err)
+	}
+}
+
+// NewIsolatedWorkspaceManager creates a workspace manager that exports
+// the commits into temporary directories instead of checking them out
+// in the workspace. The workspace and the current head are never
+// modified, therefore it can be used while having uncommitted changes.
+// Temporary directories do not contain the git repository and they are
+// removed after running the function.
+func NewIsolatedWorkspaceManager(log Log, repo Repo) IsolatedWorkspaceManager {
+	return &isolatedWorkspaceManager{Log: log, Repo: repo}
+}
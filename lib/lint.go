@@ -0,0 +1,463 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	yaml "github.com/go-yaml/yaml"
+	"github.com/mbtproject/mbt/e"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// knownOS is the list of operating system names accepted in
+// build and commands sections of a spec.
+var knownOS = map[string]bool{
+	"aix":       true,
+	"android":   true,
+	"darwin":    true,
+	"dragonfly": true,
+	"freebsd":   true,
+	"illumos":   true,
+	"ios":       true,
+	"js":        true,
+	"linux":     true,
+	"netbsd":    true,
+	"openbsd":   true,
+	"plan9":     true,
+	"solaris":   true,
+	"windows":   true,
+}
+
+// specFile is a spec found in a commit or the workspace.
+type specFile struct {
+	path     string
+	contents []byte
+	// defaults is true for the repository defaults file.
+	defaults bool
+}
+
+type lintModule struct {
+	file *specFile
+	spec *Spec
+	root *yamlv3.Node
+}
+
+func (s *stdSystem) LintCommit(commit string) ([]*LintProblem, error) {
+	c, err := s.Repo.ResolveRevision(commit)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]*specFile, 0)
+	paths := make([]string, 0)
+	err = s.Repo.WalkBlobs(c, func(b Blob) error {
+		isDefaults := b.String() == defaultsFileName
+		if b.Name() == configFileName || isDefaults {
+			contents, err := s.Repo.BlobContents(b)
+			if err != nil {
+				return err
+			}
+
+			files = append(files, &specFile{path: b.String(), contents: contents, defaults: isDefaults})
+		}
+
+		paths = append(paths, b.String())
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return lintSpecs(files, paths), nil
+}
+
+func (s *stdSystem) LintWorkspace() ([]*LintProblem, error) {
+	configFiles, err := s.Repo.FindAllFilesInWorkspace([]string{configFileName, "/**/" + configFileName, defaultsFileName})
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]*specFile, 0, len(configFiles))
+	for _, entry := range configFiles {
+		isDefaults := entry == defaultsFileName
+		if path.Base(entry) != configFileName && !isDefaults {
+			continue
+		}
+
+		contents, err := s.Repo.WorkspaceFileContents(entry)
+		if err != nil {
+			return nil, e.Wrapf(ErrClassInternal, err, "error whilst reading file contents at path %s", entry)
+		}
+
+		files = append(files, &specFile{path: entry, contents: contents, defaults: isDefaults})
+	}
+
+	paths, err := s.Repo.FindAllFilesInWorkspace([]string{"*"})
+	if err != nil {
+		return nil, err
+	}
+
+	return lintSpecs(files, paths), nil
+}
+
+// lintSpecs checks the specs for problems that would either fail
+// the discovery or lead to unexpected behaviour.
+// paths contains all files in the repository and is used to verify
+// file dependencies.
+func lintSpecs(files []*specFile, paths []string) []*LintProblem {
+	problems := make([]*LintProblem, 0)
+	report := func(m *lintModule, node *yamlv3.Node, format string, args ...interface{}) {
+		p := &LintProblem{File: m.file.path, Module: m.spec.Name, Message: fmt.Sprintf(format, args...)}
+		if node != nil {
+			p.Line = node.Line
+			p.Column = node.Column
+		}
+		problems = append(problems, p)
+	}
+
+	modules := make([]*lintModule, 0, len(files))
+	var (
+		defaults *lintModule
+		kinds    map[string]*specKind
+	)
+	for _, f := range files {
+		if f.defaults {
+			d := &specDefaults{}
+			err := yaml.Unmarshal(f.contents, d)
+			if err != nil {
+				problems = append(problems, &LintProblem{File: f.path, Message: err.Error()})
+				continue
+			}
+
+			root := parseSpecNode(f.contents)
+			for _, p := range checkDefaultsKeys(root) {
+				p.File = f.path
+				problems = append(problems, p)
+			}
+
+			defaults = &lintModule{file: f, spec: &Spec{Build: d.Build, Commands: d.Commands}, root: root}
+			kinds = d.Kinds
+			continue
+		}
+
+		spec := &Spec{}
+		err := yaml.Unmarshal(f.contents, spec)
+		if err != nil {
+			problems = append(problems, &LintProblem{File: f.path, Message: err.Error()})
+			continue
+		}
+
+		root := parseSpecNode(f.contents)
+		for _, p := range checkSpecKeys(root) {
+			p.File = f.path
+			p.Module = spec.Name
+			problems = append(problems, p)
+		}
+
+		modules = append(modules, &lintModule{file: f, spec: spec, root: root})
+	}
+
+	names := make(map[string]*lintModule)
+	for _, m := range modules {
+		if m.spec.Name == "" {
+			report(m, m.root, "module name is not specified")
+			continue
+		}
+
+		if conflict, ok := names[m.spec.Name]; ok {
+			report(m, specNode(m.root, "name"), "module name '%s' conflicts with the module in '%s'", m.spec.Name, conflict.file.path)
+			continue
+		}
+
+		names[m.spec.Name] = m
+	}
+
+	// Build and commands inherited from defaults are checked
+	// the same way as the ones in modules.
+	checked := modules
+	if defaults != nil {
+		checked = append(checked, defaults)
+	}
+
+	for _, m := range checked {
+		spec := m.spec
+		if _, ok := kinds[spec.Kind]; spec.Kind != "" && !ok {
+			report(m, specNode(m.root, "kind"), "kind '%s' is not defined in %s", spec.Kind, defaultsFileName)
+		}
+
+		deps := specNode(m.root, "dependencies")
+		for i, d := range spec.Dependencies {
+			if d == spec.Name {
+				report(m, specItem(deps, i), "module depends on itself")
+			} else if _, ok := names[d]; !ok {
+				report(m, specItem(deps, i), "dependency '%s' is not found", d)
+			}
+		}
+
+		fileDeps := specNode(m.root, "fileDependencies")
+		for i, f := range spec.FileDependencies {
+			if isGlob(f) {
+				if _, err := newPathMatcher([]string{f}, false); err != nil {
+					report(m, specItem(fileDeps, i), "invalid file dependency pattern '%s'", f)
+				}
+			} else if !pathExists(paths, f) {
+				report(m, specItem(fileDeps, i), "file dependency '%s' is not found (file dependencies are case sensitive)", f)
+			}
+		}
+
+		for os, cmd := range spec.Build {
+			if os != "default" && !knownOS[os] {
+				report(m, specKey(m.root, "build", os), "unknown os '%s' in build", os)
+			}
+
+			if cmd == nil || strings.TrimSpace(cmd.Cmd) == "" {
+				report(m, specKey(m.root, "build", os), "build command for '%s' is empty", os)
+			}
+		}
+
+		for name, cmd := range spec.Commands {
+			if cmd == nil || strings.TrimSpace(cmd.Cmd) == "" {
+				report(m, specKey(m.root, "commands", name), "command '%s' is empty", name)
+				continue
+			}
+
+			osNode := specNode(m.root, "commands", name, "os")
+			for i, os := range cmd.OS {
+				if !knownOS[os] {
+					report(m, specItem(osNode, i), "unknown os '%s' in command '%s'", os, name)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		a, b := problems[i], problems[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		return a.Message < b.Message
+	})
+
+	return problems
+}
+
+// String returns the problem in <file>:<line>:<column>: <message> form.
+func (p *LintProblem) String() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("%s: %s", p.File, p.Message)
+	}
+
+	return fmt.Sprintf("%s:%v:%v: %s", p.File, p.Line, p.Column, p.Message)
+}
+
+// pathExists returns true if the specified path is a file or a
+// directory containing one or more files.
+func pathExists(paths []string, p string) bool {
+	p = strings.TrimRight(p, "/")
+	for _, f := range paths {
+		if f == p || strings.HasPrefix(f, p+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseSpecNode returns the root node of a spec document.
+// Returns nil if the document is empty or cannot be parsed.
+func parseSpecNode(content []byte) *yamlv3.Node {
+	doc := &yamlv3.Node{}
+	err := yamlv3.Unmarshal(content, doc)
+	if err != nil || len(doc.Content) == 0 {
+		return nil
+	}
+
+	return doc.Content[0]
+}
+
+// checkSpecKeys returns the unknown and duplicate keys in a spec.
+// Known keys are derived from the yaml tags of Spec type.
+func checkSpecKeys(root *yamlv3.Node) []*LintProblem {
+	problems := make([]*LintProblem, 0)
+	if root != nil {
+		checkKeys(root, reflect.TypeOf(Spec{}), "", &problems)
+	}
+
+	return problems
+}
+
+// checkDefaultsKeys returns the unknown and duplicate keys in
+// a defaults file.
+func checkDefaultsKeys(root *yamlv3.Node) []*LintProblem {
+	problems := make([]*LintProblem, 0)
+	if root != nil {
+		checkKeys(root, reflect.TypeOf(specDefaults{}), "", &problems)
+	}
+
+	return problems
+}
+
+func checkKeys(node *yamlv3.Node, t reflect.Type, context string, problems *[]*LintProblem) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	report := func(n *yamlv3.Node, format string, args ...interface{}) {
+		m := fmt.Sprintf(format, args...)
+		if context != "" {
+			m = fmt.Sprintf("%s in '%s'", m, context)
+		}
+		*problems = append(*problems, &LintProblem{Line: n.Line, Column: n.Column, Message: m})
+	}
+
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+		if node.Kind != yamlv3.MappingNode {
+			// Type mismatches are reported by the decoder
+			return
+		}
+
+		var fields map[string]reflect.Type
+		if t.Kind() == reflect.Struct {
+			fields = yamlFields(t)
+		}
+
+		seen := make(map[string]bool)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, v := node.Content[i], node.Content[i+1]
+			if k.Value == "<<" {
+				continue
+			}
+
+			if seen[k.Value] {
+				report(k, "key '%s' is already defined", k.Value)
+				continue
+			}
+			seen[k.Value] = true
+
+			var elem reflect.Type
+			if t.Kind() == reflect.Struct {
+				var ok bool
+				elem, ok = fields[k.Value]
+				if !ok {
+					report(k, "unknown key '%s'", k.Value)
+					continue
+				}
+			} else {
+				elem = t.Elem()
+			}
+
+			checkKeys(v, elem, path.Join(context, k.Value), problems)
+		}
+	case reflect.Slice:
+		if node.Kind != yamlv3.SequenceNode {
+			return
+		}
+
+		for _, item := range node.Content {
+			checkKeys(item, t.Elem(), context, problems)
+		}
+	}
+}
+
+// yamlFields returns the types of the fields of a struct indexed by
+// their yaml key.
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+
+		tag := strings.Split(f.Tag.Get("yaml"), ",")
+		if tag[0] == "-" {
+			continue
+		}
+
+		if len(tag) > 1 && tag[1] == "inline" {
+			for k, v := range yamlFields(f.Type) {
+				fields[k] = v
+			}
+			continue
+		}
+
+		name := tag[0]
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+
+	return fields
+}
+
+// specKey returns the key node at the specified path in a spec.
+func specKey(root *yamlv3.Node, keys ...string) *yamlv3.Node {
+	key, _ := lookupSpec(root, keys...)
+	return key
+}
+
+// specNode returns the value node at the specified path in a spec.
+func specNode(root *yamlv3.Node, keys ...string) *yamlv3.Node {
+	_, value := lookupSpec(root, keys...)
+	return value
+}
+
+// specItem returns the node of an item in a sequence.
+// Returns the sequence node if the item is not found.
+func specItem(node *yamlv3.Node, index int) *yamlv3.Node {
+	if node != nil && node.Kind == yamlv3.SequenceNode && index < len(node.Content) {
+		return node.Content[index]
+	}
+
+	return node
+}
+
+// lookupSpec returns the key and value nodes at the specified path
+// in a spec. Both nodes are nil if the path does not exist.
+func lookupSpec(root *yamlv3.Node, keys ...string) (*yamlv3.Node, *yamlv3.Node) {
+	var key *yamlv3.Node
+	node := root
+	for _, k := range keys {
+		if node == nil || node.Kind != yamlv3.MappingNode {
+			return nil, nil
+		}
+
+		parent := node
+		key, node = nil, nil
+		for i := 0; i+1 < len(parent.Content); i += 2 {
+			if parent.Content[i].Value == k {
+				key, node = parent.Content[i], parent.Content[i+1]
+				break
+			}
+		}
+	}
+
+	return key, node
+}
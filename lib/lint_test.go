@@ -0,0 +1,203 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/mbtproject/mbt/e"
+	"github.com/stretchr/testify/assert"
+)
+
+func lintMessages(problems []*LintProblem) []string {
+	messages := make([]string, 0, len(problems))
+	for _, p := range problems {
+		messages = append(messages, p.String())
+	}
+	return messages
+}
+
+func TestLintCommit(t *testing.T) {
+	repo := NewMemoryRepo(".tmp/repo")
+	repo.WriteFile("shared/file", "a")
+	repo.WriteFile("app-a/.mbt.yml", `name: app-a
+dependancies: [app-b]
+buid:
+  default:
+    cmd: make
+`)
+	repo.WriteFile("app-b/.mbt.yml", `name: app-b
+dependencies: [app-b, app-x]
+fileDependencies: [shared/file, shared/missing, "shared/[z-a]"]
+build:
+  linux:
+    cmd: make
+  beos:
+    cmd: make
+  default:
+    cmdd: make
+commands:
+  lint:
+    cmd: golint
+    os: [linux, windoze]
+  empty:
+    args: [a]
+`)
+	repo.WriteFile("app-c/.mbt.yml", "name: app-a\n")
+	repo.WriteFile("app-d/.mbt.yml", "name: app-d\nname: app-e\n")
+	repo.WriteFile("app-e/.mbt.yml", "name: [\n")
+	repo.WriteFile("app-f/.mbt.yml", "dependencies: []\n")
+	c, err := repo.Commit("first")
+	check(t, err)
+
+	problems, err := NewSystemWith(repo).LintCommit(c.ID())
+	check(t, err)
+
+	assert.Equal(t, []string{
+		"app-a/.mbt.yml:2:1: unknown key 'dependancies'",
+		"app-a/.mbt.yml:3:1: unknown key 'buid'",
+		"app-b/.mbt.yml:2:16: module depends on itself",
+		"app-b/.mbt.yml:2:23: dependency 'app-x' is not found",
+		"app-b/.mbt.yml:3:33: file dependency 'shared/missing' is not found (file dependencies are case sensitive)",
+		"app-b/.mbt.yml:3:49: invalid file dependency pattern 'shared/[z-a]'",
+		"app-b/.mbt.yml:7:3: unknown os 'beos' in build",
+		"app-b/.mbt.yml:9:3: build command for 'default' is empty",
+		"app-b/.mbt.yml:10:5: unknown key 'cmdd' in 'build/default'",
+		"app-b/.mbt.yml:14:17: unknown os 'windoze' in command 'lint'",
+		"app-b/.mbt.yml:15:3: command 'empty' is empty",
+		"app-c/.mbt.yml:1:7: module name 'app-a' conflicts with the module in 'app-a/.mbt.yml'",
+		"app-d/.mbt.yml:2:1: key 'name' is already defined",
+		"app-e/.mbt.yml: yaml: line 1: did not find expected node content",
+		"app-f/.mbt.yml:1:1: module name is not specified",
+	}, lintMessages(problems))
+
+	assert.Equal(t, "app-b", problems[2].Module)
+	assert.Equal(t, 2, problems[2].Line)
+	assert.Equal(t, 16, problems[2].Column)
+}
+
+func TestLintWorkspace(t *testing.T) {
+	repo := NewMemoryRepo(".tmp/repo")
+	repo.WriteFile("app-a/.mbt.yml", "name: app-a\nfileDependencies: [shared]\n")
+	_, err := repo.Commit("first")
+	check(t, err)
+
+	system := NewSystemWith(repo)
+	problems, err := system.LintWorkspace()
+	check(t, err)
+	assert.Equal(t, []string{"app-a/.mbt.yml:2:20: file dependency 'shared' is not found (file dependencies are case sensitive)"}, lintMessages(problems))
+
+	repo.WriteFile("shared/file", "a")
+	problems, err = system.LintWorkspace()
+	check(t, err)
+	assert.Empty(t, problems)
+}
+
+func TestStrictSpecParsing(t *testing.T) {
+	_, err := newSpec([]byte("name: app-a\nbuild:\n  default:\n    cmd: make\n    arg: [a]\n"))
+
+	assert.EqualError(t, err, "line 5, column 5: unknown key 'arg' in 'build/default'")
+	assert.Equal(t, ErrClassUser, (err.(*e.E)).Class())
+}
+
+func TestStrictSpecParsingInDiscovery(t *testing.T) {
+	repo := NewMemoryRepo(".tmp/repo")
+	repo.WriteFile("app-a/.mbt.yml", "name: app-a\ndependancies: [app-b]\n")
+	c, err := repo.Commit("first")
+	check(t, err)
+
+	_, err = NewDiscover(repo, NewStdLog(LogLevelNormal)).ModulesInCommit(c)
+
+	assert.EqualError(t, err, "error while parsing the spec at app-a/.mbt.yml")
+	assert.EqualError(t, (err.(*e.E)).InnerError(), "line 2, column 1: unknown key 'dependancies'")
+	assert.Equal(t, ErrClassUser, (err.(*e.E)).Class())
+}
+
+func TestSpecSchemaIsInSyncWithSpec(t *testing.T) {
+	var schema struct {
+		Properties  map[string]interface{}
+		Definitions struct {
+			OS struct {
+				Enum []string
+			}
+			Cmd struct {
+				Properties map[string]interface{}
+			}
+			UserCmd struct {
+				Properties map[string]interface{}
+			}
+		}
+	}
+	check(t, json.Unmarshal([]byte(SpecSchema), &schema))
+
+	keys := func(m interface{}) []string {
+		r := make([]string, 0)
+		for _, k := range reflect.ValueOf(m).MapKeys() {
+			r = append(r, k.String())
+		}
+		sort.Strings(r)
+		return r
+	}
+
+	assert.Equal(t, keys(yamlFields(reflect.TypeOf(Spec{}))), keys(schema.Properties))
+	assert.Equal(t, keys(yamlFields(reflect.TypeOf(Cmd{}))), keys(schema.Definitions.Cmd.Properties))
+	assert.Equal(t, keys(yamlFields(reflect.TypeOf(UserCmd{}))), keys(schema.Definitions.UserCmd.Properties))
+
+	sort.Strings(schema.Definitions.OS.Enum)
+	assert.Equal(t, keys(knownOS), schema.Definitions.OS.Enum)
+}
+
+func TestLintDefaults(t *testing.T) {
+	repo := NewMemoryRepo(".tmp/repo")
+	repo.WriteFile(defaultsFileName, "name: common\nbuild:\n  beos:\n    cmd: make\n")
+	repo.WriteFile("app-a/.mbt.yml", "name: app-a\n")
+	c, err := repo.Commit("first")
+	check(t, err)
+
+	system := NewSystemWith(repo)
+	expected := []string{
+		".mbt-defaults.yml:1:1: unknown key 'name'",
+		".mbt-defaults.yml:3:3: unknown os 'beos' in build",
+	}
+
+	problems, err := system.LintCommit(c.ID())
+	check(t, err)
+	assert.Equal(t, expected, lintMessages(problems))
+
+	problems, err = system.LintWorkspace()
+	check(t, err)
+	assert.Equal(t, expected, lintMessages(problems))
+}
+
+func TestLintKinds(t *testing.T) {
+	repo := NewMemoryRepo(".tmp/repo")
+	repo.WriteFile(defaultsFileName, "kinds:\n  go-service:\n    fileDependencies: [go.mod]\n    dependencies: [a]\n")
+	repo.WriteFile("go.mod", "module example.com/repo")
+	repo.WriteFile("app-a/.mbt.yml", "name: app-a\nkind: go-service\n")
+	repo.WriteFile("app-b/.mbt.yml", "name: app-b\nkind: terraform\n")
+	c, err := repo.Commit("first")
+	check(t, err)
+
+	problems, err := NewSystemWith(repo).LintCommit(c.ID())
+	check(t, err)
+	assert.Equal(t, []string{
+		".mbt-defaults.yml:4:5: unknown key 'dependencies' in 'kinds/go-service'",
+		"app-b/.mbt.yml:2:7: kind 'terraform' is not defined in .mbt-defaults.yml",
+	}, lintMessages(problems))
+}
@@ -22,12 +22,7 @@ import (
 )
 
 func (s *stdSystem) ManifestByDiff(from, to string) (*Manifest, error) {
-	f, err := s.Repo.GetCommit(from)
-	if err != nil {
-		return nil, err
-	}
-
-	t, err := s.Repo.GetCommit(to)
+	f, t, err := s.resolveDiff(from, to)
 	if err != nil {
 		return nil, err
 	}
@@ -40,7 +35,7 @@ func (s *stdSystem) ManifestByPr(src, dst string) (*Manifest, error) {
 }
 
 func (s *stdSystem) ManifestByCommit(sha string) (*Manifest, error) {
-	c, err := s.Repo.GetCommit(sha)
+	c, err := s.Repo.ResolveRevision(sha)
 	if err != nil {
 		return nil, err
 	}
@@ -48,7 +43,7 @@ func (s *stdSystem) ManifestByCommit(sha string) (*Manifest, error) {
 }
 
 func (s *stdSystem) ManifestByCommitContent(sha string) (*Manifest, error) {
-	c, err := s.Repo.GetCommit(sha)
+	c, err := s.Repo.ResolveRevision(sha)
 	if err != nil {
 		return nil, err
 	}
@@ -79,21 +74,83 @@ func (s *stdSystem) ManifestByWorkspaceChanges() (*Manifest, error) {
 // subsequence comparison. Otherwise, it's a case insensitive
 // exact match.
 func (m *Manifest) FilterByName(filterOptions *FilterOptions) *Manifest {
-	filteredModules := make(Modules, 0)
 	filter := strings.ToLower(filterOptions.Name)
 	filters := strings.Split(filter, ",")
 
-	for _, m := range m.Modules {
-		lowerModuleName := strings.ToLower(m.Name())
+	filterModules := func(modules Modules) Modules {
+		filteredModules := make(Modules, 0)
+		for _, m := range modules {
+			lowerModuleName := strings.ToLower(m.Name())
 
-		match := matches(lowerModuleName, filters, filterOptions.Fuzzy)
+			match := matches(lowerModuleName, filters, filterOptions.Fuzzy)
 
-		if match {
-			filteredModules = append(filteredModules, m)
+			if match {
+				filteredModules = append(filteredModules, m)
+			}
+		}
+
+		return filteredModules
+	}
+
+	var deleted Modules
+	if m.Deleted != nil {
+		deleted = filterModules(m.Deleted)
+	}
+
+	return &Manifest{Dir: m.Dir, Modules: filterModules(m.Modules), Sha: m.Sha, Deleted: deleted}
+}
+
+// FilterByKind reduces the modules in a Manifest to the
+// ones of the kinds specified in filter.
+// Multiple kinds can be specified as a comma separated
+// string. Comparison is a case insensitive exact match.
+func (m *Manifest) FilterByKind(filterOptions *FilterOptions) *Manifest {
+	kinds := strings.Split(strings.ToLower(filterOptions.Kind), ",")
+
+	filterModules := func(modules Modules) Modules {
+		filteredModules := make(Modules, 0)
+		for _, m := range modules {
+			if matches(strings.ToLower(m.Kind()), kinds, false) {
+				filteredModules = append(filteredModules, m)
+			}
+		}
+
+		return filteredModules
+	}
+
+	var deleted Modules
+	if m.Deleted != nil {
+		deleted = filterModules(m.Deleted)
+	}
+
+	return &Manifest{Dir: m.Dir, Modules: filterModules(m.Modules), Sha: m.Sha, Deleted: deleted}
+}
+
+// FilterByExpression reduces the modules in a Manifest to the
+// ones matching the filter expression in filterOptions.
+func (m *Manifest) FilterByExpression(filterOptions *FilterOptions) (*Manifest, error) {
+	expr, err := parseFilter(filterOptions.Expression)
+	if err != nil {
+		return nil, err
+	}
+
+	filterModules := func(modules Modules) Modules {
+		filteredModules := make(Modules, 0)
+		for _, m := range modules {
+			if expr.match(m) {
+				filteredModules = append(filteredModules, m)
+			}
 		}
+
+		return filteredModules
 	}
 
-	return &Manifest{Dir: m.Dir, Modules: filteredModules, Sha: m.Sha}
+	var deleted Modules
+	if m.Deleted != nil {
+		deleted = filterModules(m.Deleted)
+	}
+
+	return &Manifest{Dir: m.Dir, Modules: filterModules(m.Modules), Sha: m.Sha, Deleted: deleted}, nil
 }
 
 // ApplyFilters will filter the modules in the manifest to the ones that
@@ -108,6 +165,20 @@ func (m *Manifest) ApplyFilters(filterOptions *FilterOptions) (*Manifest, error)
 		m = m.FilterByName(filterOptions)
 	}
 
+	if filterOptions.Kind != "" {
+		m = m.FilterByKind(filterOptions)
+	}
+
+	if filterOptions.Expression != "" {
+		var err error
+
+		m, err = m.FilterByExpression(filterOptions)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if filterOptions.Dependents {
 		var err error
 
@@ -118,6 +189,16 @@ func (m *Manifest) ApplyFilters(filterOptions *FilterOptions) (*Manifest, error)
 		}
 	}
 
+	if filterOptions.Dependencies {
+		var err error
+
+		m.Modules, err = m.Modules.expandRequiresDependencies()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return m, nil
 }
 
@@ -35,7 +35,7 @@ type manifestBuilder func() (*Manifest, error)
 
 func (b *stdManifestBuilder) ByDiff(from, to Commit) (*Manifest, error) {
 	return b.runManifestBuilder(func() (*Manifest, error) {
-		mods, err := b.Discover.ModulesInCommit(to)
+		all, err := b.Discover.ModulesInCommit(to)
 		if err != nil {
 			return nil, err
 		}
@@ -45,7 +45,22 @@ func (b *stdManifestBuilder) ByDiff(from, to Commit) (*Manifest, error) {
 			return nil, err
 		}
 
-		mods, err = b.Reducer.Reduce(mods, deltas)
+		var baseModules Modules
+		base := func() (Modules, error) {
+			if baseModules != nil {
+				return baseModules, nil
+			}
+
+			c, err := b.Repo.MergeBase(from, to)
+			if err != nil {
+				return nil, err
+			}
+
+			baseModules, err = b.Discover.ModulesInCommit(c)
+			return baseModules, err
+		}
+
+		mods, err := b.reduce(all, deltas, base)
 		if err != nil {
 			return nil, err
 		}
@@ -55,18 +70,48 @@ func (b *stdManifestBuilder) ByDiff(from, to Commit) (*Manifest, error) {
 			return nil, err
 		}
 
-		return b.buildManifest(mods, to.ID())
+		deleted, err := deletedModules(base, all)
+		if err != nil {
+			return nil, err
+		}
+
+		m, err := b.buildManifest(mods, to.ID())
+		if err != nil {
+			return nil, err
+		}
+
+		m.Deleted = deleted
+		return m, nil
 	})
 }
 
+// deletedModules returns the modules in base, which are not in
+// the specified modules.
+func deletedModules(base func() (Modules, error), modules Modules) (Modules, error) {
+	baseModules, err := base()
+	if err != nil {
+		return nil, err
+	}
+
+	index := modules.indexByName()
+	deleted := Modules{}
+	for _, m := range baseModules {
+		if _, ok := index[m.Name()]; !ok {
+			deleted = append(deleted, m)
+		}
+	}
+
+	return deleted, nil
+}
+
 func (b *stdManifestBuilder) ByPr(src, dst string) (*Manifest, error) {
 	return b.runManifestBuilder(func() (*Manifest, error) {
-		from, err := b.Repo.BranchCommit(dst)
+		from, err := b.Repo.ResolveRevision(dst)
 		if err != nil {
 			return nil, err
 		}
 
-		to, err := b.Repo.BranchCommit(src)
+		to, err := b.Repo.ResolveRevision(src)
 		if err != nil {
 			return nil, err
 		}
@@ -99,7 +144,14 @@ func (b *stdManifestBuilder) ByCommitContent(sha Commit) (*Manifest, error) {
 		}
 
 		if len(diff) > 0 {
-			mods, err = b.Reducer.Reduce(mods, diff)
+			mods, err = b.reduce(mods, diff, func() (Modules, error) {
+				parent, err := b.Repo.ResolveRevision(sha.ID() + "^")
+				if err != nil {
+					return nil, err
+				}
+
+				return b.Discover.ModulesInCommit(parent)
+			})
 			if err != nil {
 				return nil, err
 			}
@@ -141,7 +193,7 @@ func (b *stdManifestBuilder) ByWorkspace() (*Manifest, error) {
 		return nil, err
 	}
 
-	return b.buildManifest(mods, "local")
+	return b.buildManifest(mods, WorkspaceSha)
 }
 
 func (b *stdManifestBuilder) ByWorkspaceChanges() (*Manifest, error) {
@@ -155,7 +207,19 @@ func (b *stdManifestBuilder) ByWorkspaceChanges() (*Manifest, error) {
 		return nil, err
 	}
 
-	mods, err = b.Reducer.Reduce(mods, deltas)
+	mods, err = b.reduce(mods, deltas, func() (Modules, error) {
+		empty, err := b.Repo.IsEmpty()
+		if err != nil || empty {
+			return Modules{}, err
+		}
+
+		head, err := b.Repo.ResolveRevision("HEAD")
+		if err != nil {
+			return nil, err
+		}
+
+		return b.Discover.ModulesInCommit(head)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -165,7 +229,46 @@ func (b *stdManifestBuilder) ByWorkspaceChanges() (*Manifest, error) {
 		return nil, err
 	}
 
-	return b.buildManifest(mods, "local")
+	return b.buildManifest(mods, WorkspaceSha)
+}
+
+// reduce returns the modules impacted by deltas.
+// In addition to the modules selected by the reducer, modules are
+// impacted when the defaults file is changed and the spec they resolve
+// to is different from the one in base. base is only invoked when
+// the defaults file is changed.
+func (b *stdManifestBuilder) reduce(modules Modules, deltas []*DiffDelta, base func() (Modules, error)) (Modules, error) {
+	reduced, err := b.Reducer.Reduce(modules, deltas)
+	if err != nil {
+		return nil, err
+	}
+
+	defaults := changedFiles(deltas, isDefaultsFile)
+	if len(defaults) == 0 || len(reduced) == len(modules) {
+		return reduced, nil
+	}
+
+	baseModules, err := base()
+	if err != nil {
+		return nil, err
+	}
+
+	impacted := reduced.indexByName()
+	inBase := baseModules.indexByName()
+	filtered := make(Modules, 0, len(modules))
+	for _, m := range modules {
+		if _, ok := impacted[m.Name()]; !ok {
+			if old, ok := inBase[m.Name()]; ok && old.metadata.defaultsHash == m.metadata.defaultsHash {
+				continue
+			}
+
+			m.reason = &Reason{Kind: ReasonDefaults, Files: defaults}
+		}
+
+		filtered = append(filtered, m)
+	}
+
+	return filtered, nil
 }
 
 func (b *stdManifestBuilder) runManifestBuilder(builder manifestBuilder) (*Manifest, error) {
@@ -0,0 +1,143 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/mbtproject/mbt/e"
+)
+
+// ManifestFormatVersion is the version of the json document written by
+// WriteManifest. It's incremented whenever the document changes in a way
+// that older versions of mbt cannot read.
+const ManifestFormatVersion = 1
+
+type jsonManifest struct {
+	FormatVersion int                   `json:"formatVersion"`
+	Sha           string                `json:"sha"`
+	Dir           string                `json:"dir"`
+	Modules       []*jsonManifestModule `json:"modules"`
+}
+
+type jsonManifestModule struct {
+	Name                 string                 `json:"name"`
+	Kind                 string                 `json:"kind,omitempty"`
+	Path                 string                 `json:"path"`
+	Version              string                 `json:"version"`
+	Hash                 string                 `json:"hash"`
+	Requires             []string               `json:"requires"`
+	RequiredBy           []string               `json:"requiredBy"`
+	Properties           map[string]interface{} `json:"properties"`
+	FileDependencyHashes map[string]string      `json:"fileDependencyHashes"`
+}
+
+// WriteManifest writes a manifest as a versioned json document.
+// Modules are written in the order they appear in the manifest
+// (topological order). The document can be read back with
+// System.ManifestByFile.
+func WriteManifest(w io.Writer, m *Manifest) error {
+	doc := &jsonManifest{
+		FormatVersion: ManifestFormatVersion,
+		Sha:           m.Sha,
+		Dir:           m.Dir,
+		Modules:       make([]*jsonManifestModule, 0, len(m.Modules)),
+	}
+
+	for _, a := range m.Modules {
+		doc.Modules = append(doc.Modules, &jsonManifestModule{
+			Name:                 a.Name(),
+			Kind:                 a.Kind(),
+			Path:                 a.Path(),
+			Version:              a.Version(),
+			Hash:                 a.Hash(),
+			Requires:             a.Requires().names(),
+			RequiredBy:           a.RequiredBy().names(),
+			Properties:           a.Properties(),
+			FileDependencyHashes: a.metadata.dependentFileHashes,
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(doc)
+	if err != nil {
+		return e.Wrap(ErrClassInternal, err)
+	}
+
+	return nil
+}
+
+// ManifestByFile reads a manifest written by WriteManifest.
+// Modules are resolved from the commit recorded in the document (or
+// the current workspace for the manifests of local changes) so that
+// their build and user defined commands are available. It's an error
+// if a module does not exist in that commit or its version is
+// different to the one in the document.
+// Dir of the returned manifest is the path of current repository.
+func (s *stdSystem) ManifestByFile(path string) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, e.Wrapf(ErrClassUser, err, msgFailedManifestRead, path)
+	}
+	defer f.Close()
+
+	doc := &jsonManifest{}
+	err = json.NewDecoder(f).Decode(doc)
+	if err != nil {
+		return nil, e.Wrapf(ErrClassUser, err, msgFailedManifestRead, path)
+	}
+
+	if doc.FormatVersion != ManifestFormatVersion {
+		return nil, e.NewErrorf(ErrClassUser, msgUnsupportedManifestVersion, doc.FormatVersion, path, ManifestFormatVersion)
+	}
+
+	var all *Manifest
+	switch doc.Sha {
+	case WorkspaceSha:
+		all, err = s.MB.ByWorkspace()
+	default:
+		var c Commit
+		c, err = s.Repo.ResolveRevision(doc.Sha)
+		if err != nil {
+			return nil, err
+		}
+		all, err = s.MB.ByCommit(c)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	index := all.Modules.indexByName()
+	modules := make(Modules, 0, len(doc.Modules))
+	for _, a := range doc.Modules {
+		mod, ok := index[a.Name]
+		if !ok {
+			return nil, e.NewErrorf(ErrClassUser, msgManifestModuleNotFound, a.Name, doc.Sha)
+		}
+
+		if mod.Version() != a.Version {
+			return nil, e.NewErrorf(ErrClassUser, msgManifestModuleVersionMismatch, a.Name, a.Version, doc.Sha, mod.Version())
+		}
+
+		modules = append(modules, mod)
+	}
+
+	return &Manifest{Dir: all.Dir, Sha: all.Sha, Modules: modules}, nil
+}
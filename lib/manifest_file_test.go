@@ -0,0 +1,192 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mbtproject/mbt/e"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestManifest(t *testing.T, m *Manifest) string {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	f, err := os.Create(path)
+	check(t, err)
+	defer f.Close()
+
+	check(t, WriteManifest(f, m))
+	return path
+}
+
+func newManifestFileTestRepo(t *testing.T) (MemoryRepo, Commit) {
+	repo := NewMemoryRepo(".tmp/repo")
+	repo.WriteFile("shared/file", "a")
+	repo.WriteFile("app-a/.mbt.yml", "name: app-a\nfileDependencies: [shared/file]\nproperties:\n  team: a\nbuild:\n  default:\n    cmd: echo\n")
+	repo.WriteFile("app-b/.mbt.yml", "name: app-b\ndependencies: [app-a]\nbuild:\n  default:\n    cmd: echo\n")
+	repo.WriteFile("app-c/.mbt.yml", "name: app-c\n")
+	c, err := repo.Commit("first")
+	check(t, err)
+
+	return repo, c
+}
+
+func TestWriteManifest(t *testing.T) {
+	repo, c := newManifestFileTestRepo(t)
+	m, err := NewSystemWith(repo).ManifestByCommit(c.ID())
+	check(t, err)
+
+	buff := new(bytes.Buffer)
+	check(t, WriteManifest(buff, m))
+
+	doc := &jsonManifest{}
+	check(t, json.Unmarshal(buff.Bytes(), doc))
+
+	assert.Equal(t, ManifestFormatVersion, doc.FormatVersion)
+	assert.Equal(t, c.ID(), doc.Sha)
+	assert.Equal(t, m.Dir, doc.Dir)
+	assert.Len(t, doc.Modules, 3)
+
+	a := doc.Modules[0]
+	assert.Equal(t, "app-a", a.Name)
+	assert.Equal(t, "app-a", a.Path)
+	assert.Equal(t, m.Modules[0].Version(), a.Version)
+	assert.Equal(t, m.Modules[0].Hash(), a.Hash)
+	assert.Equal(t, []string{}, a.Requires)
+	assert.Equal(t, []string{"app-b"}, a.RequiredBy)
+	assert.Equal(t, map[string]interface{}{"team": "a"}, a.Properties)
+	assert.Equal(t, map[string]string{"shared/file": blobID([]byte("a"))}, a.FileDependencyHashes)
+
+	b := doc.Modules[1]
+	assert.Equal(t, "app-b", b.Name)
+	assert.Equal(t, []string{"app-a"}, b.Requires)
+	assert.Equal(t, []string{}, b.RequiredBy)
+}
+
+func TestManifestByFile(t *testing.T) {
+	repo, c := newManifestFileTestRepo(t)
+	system := NewSystemWith(repo)
+
+	m, err := system.ManifestByCommit(c.ID())
+	check(t, err)
+	m, err = m.ApplyFilters(&FilterOptions{Name: "app-b,app-c"})
+	check(t, err)
+
+	path := writeTestManifest(t, m)
+
+	// Changes after writing the manifest should not be visible
+	repo.WriteFile("app-b/main.go", "package main")
+	_, err = repo.Commit("second")
+	check(t, err)
+
+	loaded, err := system.ManifestByFile(path)
+	check(t, err)
+
+	assert.Equal(t, c.ID(), loaded.Sha)
+	assert.Len(t, loaded.Modules, 2)
+	assert.Equal(t, "app-b", loaded.Modules[0].Name())
+	assert.Equal(t, m.Modules[0].Version(), loaded.Modules[0].Version())
+	assert.Equal(t, "echo", loaded.Modules[0].Build()["default"].Cmd)
+	assert.Equal(t, "app-c", loaded.Modules[1].Name())
+}
+
+func TestBuildManifestFileDryRun(t *testing.T) {
+	repo, c := newManifestFileTestRepo(t)
+	system := NewSystemWith(repo)
+
+	m, err := system.ManifestByCommit(c.ID())
+	check(t, err)
+	path := writeTestManifest(t, m)
+
+	options := stdTestCmdOptions(new(bytes.Buffer))
+	options.DryRun = true
+	summary, err := system.BuildManifestFile(path, options)
+	check(t, err)
+
+	assert.Equal(t, c.ID(), summary.Manifest.Sha)
+	assert.Len(t, summary.Plan.Steps, 3)
+	assert.Equal(t, PlanActionRun, summary.Plan.Steps[0].Action)
+	assert.Equal(t, PlanActionSkip, summary.Plan.Steps[2].Action)
+
+	result, err := system.RunInManifestFile("lint", path, options)
+	check(t, err)
+	assert.Len(t, result.Plan.Steps, 3)
+}
+
+func TestManifestByFileWithModifiedVersion(t *testing.T) {
+	repo, c := newManifestFileTestRepo(t)
+	system := NewSystemWith(repo)
+
+	m, err := system.ManifestByCommit(c.ID())
+	check(t, err)
+	version := m.Modules[0].Version()
+	m.Modules[0].version = "abc"
+	path := writeTestManifest(t, m)
+
+	_, err = system.ManifestByFile(path)
+
+	assert.EqualError(t, err, "Version of module app-a in the manifest (abc) does not match the version in commit "+c.ID()+" ("+version+")")
+	assert.Equal(t, ErrClassUser, (err.(*e.E)).Class())
+}
+
+func TestManifestByFileWithUnknownModule(t *testing.T) {
+	repo, c := newManifestFileTestRepo(t)
+	system := NewSystemWith(repo)
+
+	m, err := system.ManifestByCommit(c.ID())
+	check(t, err)
+	path := writeTestManifest(t, m)
+
+	repo.RemoveFile("app-c/.mbt.yml")
+	c2, err := repo.Commit("second")
+	check(t, err)
+
+	contents, err := ioutil.ReadFile(path)
+	check(t, err)
+	check(t, ioutil.WriteFile(path, bytes.Replace(contents, []byte(c.ID()), []byte(c2.ID()), 1), 0644))
+
+	_, err = system.ManifestByFile(path)
+
+	assert.EqualError(t, err, "Module app-c in the manifest is not found in commit "+c2.ID())
+	assert.Equal(t, ErrClassUser, (err.(*e.E)).Class())
+}
+
+func TestManifestByFileWithUnsupportedVersion(t *testing.T) {
+	repo, _ := newManifestFileTestRepo(t)
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	check(t, ioutil.WriteFile(path, []byte(`{"formatVersion": 42, "modules": []}`), 0644))
+
+	_, err := NewSystemWith(repo).ManifestByFile(path)
+
+	assert.EqualError(t, err, "Unsupported manifest format version 42 in file '"+path+"' (expected 1)")
+	assert.Equal(t, ErrClassUser, (err.(*e.E)).Class())
+}
+
+func TestManifestByFileWithInvalidFile(t *testing.T) {
+	repo, _ := newManifestFileTestRepo(t)
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	check(t, ioutil.WriteFile(path, []byte(`{`), 0644))
+
+	_, err := NewSystemWith(repo).ManifestByFile(path)
+
+	assert.EqualError(t, err, "Failed to read the manifest in file '"+path+"'")
+	assert.Equal(t, ErrClassUser, (err.(*e.E)).Class())
+}
@@ -342,6 +342,42 @@ func TestManifestByDiff(t *testing.T) {
 	assert.Len(t, m.Modules, 0)
 }
 
+func TestManifestByDiffWithRevisions(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.InitModule("app-a"))
+	check(t, repo.InitModule("app-b"))
+	check(t, repo.Commit("first"))
+
+	check(t, repo.SwitchToBranch("feature"))
+	check(t, repo.WriteContent("app-a/foo", "hello"))
+	check(t, repo.Commit("second"))
+
+	check(t, repo.SwitchToBranch("master"))
+	check(t, repo.WriteContent("app-b/foo", "hello"))
+	check(t, repo.Commit("third"))
+
+	w := NewWorld(t, ".tmp/repo")
+	m, err := w.System.ManifestByDiff("master~1", "feature")
+	check(t, err)
+	assert.Len(t, m.Modules, 1)
+	assert.Equal(t, "app-a", m.Modules[0].Name())
+
+	m, err = w.System.ManifestByDiff("master...feature", "")
+	check(t, err)
+	assert.Len(t, m.Modules, 1)
+	assert.Equal(t, "app-a", m.Modules[0].Name())
+
+	m, err = w.System.ManifestByDiff("feature..master", "")
+	check(t, err)
+	assert.Len(t, m.Modules, 1)
+	assert.Equal(t, "app-b", m.Modules[0].Name())
+
+	_, err = w.System.ManifestByDiff("master..feature..master", "")
+	assert.EqualError(t, err, fmt.Sprintf(msgInvalidRevisionRange, "master..feature..master"))
+}
+
 func TestManifestByHead(t *testing.T) {
 	repo := NewTestRepo(t, ".tmp/repo")
 
@@ -368,12 +404,15 @@ func TestManifestByLocalDirForUpdates(t *testing.T) {
 	expectedPath, err := filepath.Abs(".tmp/repo")
 	check(t, err)
 
-	assert.Equal(t, "local", m.Sha)
+	assert.Equal(t, WorkspaceSha, m.Sha)
 	assert.Equal(t, expectedPath, m.Dir)
 
 	// currently no modules changed locally
 	assert.Equal(t, 0, len(m.Modules))
 
+	head, err := NewWorld(t, ".tmp/repo").System.ManifestByCurrentBranch()
+	check(t, err)
+
 	// change the file, expect 1 module to be returned
 	check(t, repo.WriteContent("app-a/test.txt", "amended contents"))
 
@@ -382,7 +421,7 @@ func TestManifestByLocalDirForUpdates(t *testing.T) {
 
 	assert.Len(t, m.Modules, 1)
 	assert.Equal(t, "app-a", m.Modules[0].Name())
-	assert.Equal(t, "local", m.Modules[0].Version())
+	assert.NotEqual(t, head.Modules[0].Version(), m.Modules[0].Version())
 }
 
 func TestManifestByLocalDirForAddition(t *testing.T) {
@@ -399,7 +438,7 @@ func TestManifestByLocalDirForAddition(t *testing.T) {
 
 	assert.Len(t, m.Modules, 1)
 	assert.Equal(t, "app-b", m.Modules[0].Name())
-	assert.Equal(t, "local", m.Modules[0].Version())
+	assert.NotEmpty(t, m.Modules[0].Version())
 }
 
 func TestManifestByLocalDirForConversion(t *testing.T) {
@@ -444,7 +483,7 @@ func TestManifestByLocalDirForAnEmptyRepo(t *testing.T) {
 
 	assert.Len(t, m.Modules, 1)
 	assert.Equal(t, "app-a", m.Modules[0].Name())
-	assert.Equal(t, "local", m.Modules[0].Version())
+	assert.NotEmpty(t, m.Modules[0].Version())
 }
 
 func TestManifestByLocalForFilesEndingWithSpecFileName(t *testing.T) {
@@ -472,8 +511,8 @@ func TestManifestByLocalForDirsEndingWithSpecFileName(t *testing.T) {
 }
 
 func TestVersionOfLocalDirManifest(t *testing.T) {
-	// All modules should have the fixed version string "local" as
-	// for manifest derived from local directory.
+	// Modules that are not modified in the workspace should have
+	// the same version as in the last commit.
 	clean()
 	repo := NewTestRepo(t, ".tmp/repo")
 
@@ -491,14 +530,17 @@ func TestVersionOfLocalDirManifest(t *testing.T) {
 	expectedPath, err := filepath.Abs(".tmp/repo")
 	check(t, err)
 
-	assert.Equal(t, "local", m.Sha)
+	head, err := NewWorld(t, ".tmp/repo").System.ManifestByCurrentBranch()
+	check(t, err)
+
+	assert.Equal(t, WorkspaceSha, m.Sha)
 	assert.Equal(t, expectedPath, m.Dir)
 
 	assert.Equal(t, 2, len(m.Modules))
 	assert.Equal(t, "app-a", m.Modules[0].Name())
-	assert.Equal(t, "local", m.Modules[0].Version())
+	assert.Equal(t, head.Modules[0].Version(), m.Modules[0].Version())
 	assert.Equal(t, "app-b", m.Modules[1].Name())
-	assert.Equal(t, "local", m.Modules[1].Version())
+	assert.Equal(t, head.Modules[1].Version(), m.Modules[1].Version())
 }
 
 func TestLocalDependencyChange(t *testing.T) {
@@ -520,6 +562,9 @@ func TestLocalDependencyChange(t *testing.T) {
 	}))
 	check(t, repo.Commit("first"))
 
+	head, err := NewWorld(t, ".tmp/repo").System.ManifestByCurrentBranch()
+	check(t, err)
+
 	check(t, repo.WriteContent("app-b/foo", "bar"))
 
 	m, err := NewWorld(t, ".tmp/repo").System.ManifestByWorkspaceChanges()
@@ -527,11 +572,11 @@ func TestLocalDependencyChange(t *testing.T) {
 
 	assert.Equal(t, 3, len(m.Modules))
 	assert.Equal(t, "app-b", m.Modules[0].Name())
-	assert.Equal(t, "local", m.Modules[0].Version())
+	assert.NotEqual(t, head.Modules[1].Version(), m.Modules[0].Version())
 	assert.Equal(t, "app-c", m.Modules[1].Name())
-	assert.Equal(t, "local", m.Modules[1].Version())
+	assert.NotEqual(t, head.Modules[2].Version(), m.Modules[1].Version())
 	assert.Equal(t, "app-d", m.Modules[2].Name())
-	assert.Equal(t, "local", m.Modules[2].Version())
+	assert.NotEqual(t, head.Modules[3].Version(), m.Modules[2].Version())
 }
 
 func TestDependencyChange(t *testing.T) {
@@ -943,7 +988,7 @@ func TestByPrForInvalidSrcBranch(t *testing.T) {
 
 	w := NewWorld(t, ".tmp/repo")
 	_, err := w.System.ManifestByPr("master", "feature")
-	assert.EqualError(t, err, fmt.Sprintf(msgFailedBranchLookup, "feature"))
+	assert.EqualError(t, err, fmt.Sprintf(msgUnknownRevision, "feature"))
 }
 
 func TestByPrForInvalidDstBranch(t *testing.T) {
@@ -954,7 +999,7 @@ func TestByPrForInvalidDstBranch(t *testing.T) {
 
 	w := NewWorld(t, ".tmp/repo")
 	_, err := w.System.ManifestByPr("feature", "master")
-	assert.EqualError(t, err, fmt.Sprintf(msgFailedBranchLookup, "feature"))
+	assert.EqualError(t, err, fmt.Sprintf(msgUnknownRevision, "feature"))
 }
 
 func TestByCommitForDiscoverFailure(t *testing.T) {
@@ -1224,3 +1269,239 @@ func TestApplyFilter(t *testing.T) {
 	assert.Equal(t, "app-b", m1.Modules[0].Name())
 	assert.Equal(t, "app-a", m1.Modules[1].Name())
 }
+
+func TestApplyDependenciesFilter(t *testing.T) {
+	libA := &Module{metadata: &moduleMetadata{spec: &Spec{Name: "lib-a"}}}
+	libB := &Module{
+		metadata: &moduleMetadata{spec: &Spec{Name: "lib-b", Dependencies: []string{"lib-a"}}},
+		requires: Modules{libA},
+	}
+	appA := &Module{
+		metadata: &moduleMetadata{spec: &Spec{Name: "app-a", Dependencies: []string{"lib-b"}}},
+		requires: Modules{libB},
+	}
+	appB := &Module{metadata: &moduleMetadata{spec: &Spec{Name: "app-b"}}}
+
+	m := &Manifest{Modules: []*Module{libA, libB, appA, appB}}
+
+	m1, err := m.ApplyFilters(ExactMatchDependenciesFilter("app-a"))
+	check(t, err)
+	assert.Len(t, m1.Modules, 3)
+	assert.Equal(t, "lib-a", m1.Modules[0].Name())
+	assert.Equal(t, "lib-b", m1.Modules[1].Name())
+	assert.Equal(t, "app-a", m1.Modules[2].Name())
+
+	m1, err = m.ApplyFilters(FuzzyDependenciesFilter("apb"))
+	check(t, err)
+	assert.Len(t, m1.Modules, 1)
+	assert.Equal(t, "app-b", m1.Modules[0].Name())
+}
+
+func TestChangeToFileDependencyPattern(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.WriteContent("shared/proto/a/foo.proto", "a"))
+	check(t, repo.WriteContent("shared/proto/a/foo_test.go", "a"))
+	check(t, repo.WriteContent("shared/proto/readme.md", "a"))
+	check(t, repo.InitModule("app-a"))
+	check(t, repo.InitModuleWithOptions("app-b", &Spec{
+		Name:             "app-b",
+		FileDependencies: []string{"shared/proto/**/*.proto", "shared/proto/**/*.go", "!**/*_test.go"},
+	}))
+
+	check(t, repo.Commit("first"))
+	c1 := repo.LastCommit.String()
+
+	check(t, repo.WriteContent("shared/proto/readme.md", "b"))
+	check(t, repo.WriteContent("shared/proto/a/foo_test.go", "b"))
+	check(t, repo.Commit("second"))
+	c2 := repo.LastCommit.String()
+
+	check(t, repo.WriteContent("shared/proto/a/foo.proto", "b"))
+	check(t, repo.Commit("third"))
+	c3 := repo.LastCommit.String()
+
+	m, err := NewWorld(t, ".tmp/repo").System.ManifestByDiff(c1, c2)
+	check(t, err)
+	assert.Len(t, m.Modules, 0)
+
+	m, err = NewWorld(t, ".tmp/repo").System.ManifestByDiff(c2, c3)
+	check(t, err)
+	assert.Len(t, m.Modules, 1)
+	assert.Equal(t, "app-b", m.Modules[0].Name())
+}
+
+func TestFileDependencyDirectory(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.WriteContent("shared/lib/file", "a"))
+	check(t, repo.InitModuleWithOptions("app-a", &Spec{
+		Name:             "app-a",
+		FileDependencies: []string{"shared/lib"},
+	}))
+
+	check(t, repo.Commit("first"))
+	c1 := repo.LastCommit.String()
+
+	check(t, repo.WriteContent("shared/lib/nested/file", "b"))
+	check(t, repo.Commit("second"))
+	c2 := repo.LastCommit.String()
+
+	m, err := NewWorld(t, ".tmp/repo").System.ManifestByDiff(c1, c2)
+	check(t, err)
+
+	assert.Len(t, m.Modules, 1)
+	assert.Equal(t, "app-a", m.Modules[0].Name())
+}
+
+func TestChangeToIgnoredFile(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.InitModuleWithOptions("app-a", &Spec{
+		Name:   "app-a",
+		Ignore: []string{"*.md", "docs/"},
+	}))
+	check(t, repo.WriteContent("app-a/README.md", "a"))
+	check(t, repo.WriteContent("app-a/main.go", "a"))
+	check(t, repo.Commit("first"))
+	c1 := repo.LastCommit.String()
+
+	check(t, repo.WriteContent("app-a/README.md", "b"))
+	check(t, repo.WriteContent("app-a/docs/index.html", "b"))
+	check(t, repo.Commit("second"))
+	c2 := repo.LastCommit.String()
+
+	check(t, repo.WriteContent("app-a/main.go", "b"))
+	check(t, repo.Commit("third"))
+	c3 := repo.LastCommit.String()
+
+	w := NewWorld(t, ".tmp/repo")
+	m, err := w.System.ManifestByDiff(c1, c2)
+	check(t, err)
+	assert.Len(t, m.Modules, 0)
+
+	m, err = w.System.ManifestByDiff(c2, c3)
+	check(t, err)
+	assert.Len(t, m.Modules, 1)
+
+	m1, err := w.System.ManifestByCommit(c1)
+	check(t, err)
+	m2, err := w.System.ManifestByCommit(c2)
+	check(t, err)
+	m3, err := w.System.ManifestByCommit(c3)
+	check(t, err)
+
+	assert.Equal(t, m1.Modules[0].Version(), m2.Modules[0].Version())
+	assert.NotEqual(t, m2.Modules[0].Version(), m3.Modules[0].Version())
+}
+
+func TestMovingFileBetweenModules(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.InitModule("app-a"))
+	check(t, repo.InitModule("app-b"))
+	check(t, repo.InitModule("app-c"))
+	check(t, repo.WriteContent("app-a/file", "hello world"))
+	check(t, repo.Commit("first"))
+	c1 := repo.LastCommit.String()
+
+	check(t, repo.Rename("app-a/file", "app-b/file"))
+	check(t, repo.Commit("second"))
+	c2 := repo.LastCommit.String()
+
+	m, err := NewWorld(t, ".tmp/repo").System.ManifestByDiff(c1, c2)
+	check(t, err)
+
+	assert.Len(t, m.Modules, 2)
+	assert.Equal(t, "app-a", m.Modules[0].Name())
+	assert.Equal(t, "app-b", m.Modules[1].Name())
+}
+
+func TestDeletingFileMatchingFileDependency(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.WriteContent("shared/a.txt", "a"))
+	check(t, repo.WriteContent("shared/b.txt", "b"))
+	check(t, repo.InitModule("app-a"))
+	check(t, repo.InitModuleWithOptions("app-b", &Spec{
+		Name:             "app-b",
+		FileDependencies: []string{"shared/*.txt"},
+	}))
+	check(t, repo.Commit("first"))
+	c1 := repo.LastCommit.String()
+
+	check(t, repo.Remove("shared/b.txt"))
+	check(t, repo.Commit("second"))
+	c2 := repo.LastCommit.String()
+
+	m, err := NewWorld(t, ".tmp/repo").System.ManifestByDiff(c1, c2)
+	check(t, err)
+
+	assert.Len(t, m.Modules, 1)
+	assert.Equal(t, "app-b", m.Modules[0].Name())
+}
+
+func TestDeletedModules(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.InitModule("app-a"))
+	check(t, repo.InitModule("app-b"))
+	check(t, repo.Commit("first"))
+	check(t, repo.SwitchToBranch("feature"))
+	check(t, repo.Remove("app-b"))
+	check(t, repo.Commit("second"))
+
+	m, err := NewWorld(t, ".tmp/repo").System.ManifestByPr("feature", "master")
+	check(t, err)
+
+	assert.Len(t, m.Modules, 0)
+	assert.Len(t, m.Deleted, 1)
+	assert.Equal(t, "app-b", m.Deleted[0].Name())
+
+	m, err = m.ApplyFilters(&FilterOptions{Name: "app-a"})
+	check(t, err)
+	assert.Len(t, m.Deleted, 0)
+}
+
+func TestReasonsInManifest(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.WriteContent("shared/file", "a"))
+	check(t, repo.InitModule("proto"))
+	check(t, repo.InitModuleWithOptions("common", &Spec{
+		Name:         "common",
+		Dependencies: []string{"proto"},
+	}))
+	check(t, repo.InitModuleWithOptions("billing", &Spec{
+		Name:         "billing",
+		Dependencies: []string{"common"},
+	}))
+	check(t, repo.InitModuleWithOptions("tools", &Spec{
+		Name:             "tools",
+		FileDependencies: []string{"shared/file"},
+	}))
+	check(t, repo.Commit("first"))
+	c1 := repo.LastCommit.String()
+
+	check(t, repo.WriteContent("proto/file", "b"))
+	check(t, repo.WriteContent("shared/file", "b"))
+	check(t, repo.Commit("second"))
+	c2 := repo.LastCommit.String()
+
+	m, err := NewWorld(t, ".tmp/repo").System.ManifestByDiff(c1, c2)
+	check(t, err)
+
+	mods := m.Modules.indexByName()
+	assert.Len(t, mods, 4)
+	assert.Equal(t, &Reason{Kind: ReasonContent, Files: []string{"proto/file"}}, mods["proto"].Reason())
+	assert.Equal(t, &Reason{Kind: ReasonFileDependency, Files: []string{"shared/file"}}, mods["tools"].Reason())
+	assert.Equal(t, &Reason{Kind: ReasonDependency, Chain: []string{"common", "proto"}}, mods["common"].Reason())
+	assert.Equal(t, &Reason{Kind: ReasonDependency, Chain: []string{"billing", "common", "proto"}}, mods["billing"].Reason())
+}
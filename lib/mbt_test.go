@@ -16,6 +16,7 @@ limitations under the License.
 package lib
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -41,9 +42,9 @@ func (r *TestRepository) InitModule(p string) error {
 	return r.InitModuleWithOptions(p, &Spec{
 		Name: path.Base(p),
 		Build: map[string]*Cmd{
-			"darwin":  {"./build.sh", []string{}},
-			"linux":   {"./build.sh", []string{}},
-			"windows": {"powershell", []string{"-ExecutionPolicy", "Bypass", "-File", ".\\build.ps1"}},
+			"darwin":  {Cmd: "./build.sh", Args: []string{}},
+			"linux":   {Cmd: "./build.sh", Args: []string{}},
+			"windows": {Cmd: "powershell", Args: []string{"-ExecutionPolicy", "Bypass", "-File", ".\\build.ps1"}},
 		},
 		Properties: map[string]interface{}{"foo": "bar", "jar": "car"},
 	})
@@ -342,14 +343,15 @@ func check(t *testing.T, err error) {
 }
 
 type World struct {
-	Log              Log
-	Repo             *TestRepo
-	Discover         *TestDiscover
-	Reducer          *TestReducer
-	ManifestBuilder  *TestManifestBuilder
-	WorkspaceManager *TestWorkspaceManager
-	ProcessManager   *TestProcessManager
-	System           *TestSystem
+	Log                      Log
+	Repo                     *TestRepo
+	Discover                 *TestDiscover
+	Reducer                  *TestReducer
+	ManifestBuilder          *TestManifestBuilder
+	WorkspaceManager         *TestWorkspaceManager
+	ProcessManager           *TestProcessManager
+	IsolatedWorkspaceManager *TestIsolatedWorkspaceManager
+	System                   *TestSystem
 }
 
 /* sXxx methods below are used to safely convert interface{} to an interface type */
@@ -384,6 +386,22 @@ func sManifest(e interface{}) *Manifest {
 	return e.(*Manifest)
 }
 
+func sComparison(e interface{}) *Comparison {
+	if e == nil {
+		return nil
+	}
+
+	return e.(*Comparison)
+}
+
+func sLintProblems(e interface{}) []*LintProblem {
+	if e == nil {
+		return nil
+	}
+
+	return e.([]*LintProblem)
+}
+
 func sModules(e interface{}) Modules {
 	if e == nil {
 		return nil
@@ -425,6 +443,11 @@ func (r *TestRepo) GetCommit(sha string) (Commit, error) {
 	return sCommit(ret[0]), sErr(ret[1])
 }
 
+func (r *TestRepo) ResolveRevision(rev string) (Commit, error) {
+	ret := r.Interceptor.Call("ResolveRevision", rev)
+	return sCommit(ret[0]), sErr(ret[1])
+}
+
 func (r *TestRepo) Path() string {
 	ret := r.Interceptor.Call("Path")
 	return ret[0].(string)
@@ -510,6 +533,26 @@ func (r *TestRepo) CheckoutReference(reference Reference) error {
 	return sErr(ret[0])
 }
 
+func (r *TestRepo) WorkspaceFileContents(path string) ([]byte, error) {
+	ret := r.Interceptor.Call("WorkspaceFileContents", path)
+	return ret[0].([]byte), sErr(ret[1])
+}
+
+func (r *TestRepo) WorkspaceEntryIDs(paths []string) (map[string]string, error) {
+	ret := r.Interceptor.Call("WorkspaceEntryIDs", paths)
+	return ret[0].(map[string]string), sErr(ret[1])
+}
+
+func (r *TestRepo) WorkspaceBlobs() ([]Blob, error) {
+	ret := r.Interceptor.Call("WorkspaceBlobs")
+	return ret[0].([]Blob), sErr(ret[1])
+}
+
+func (r *TestRepo) Export(commit Commit, dir string) error {
+	ret := r.Interceptor.Call("Export", commit, dir)
+	return sErr(ret[0])
+}
+
 func (r *TestRepo) MergeBase(a, b Commit) (Commit, error) {
 	ret := r.Interceptor.Call("MergeBase", a, b)
 	return sCommit(ret[0]), sErr(ret[1])
@@ -588,13 +631,13 @@ func (s *TestSystem) BuildBranch(name string, filterOptions *FilterOptions, opti
 	return sBuildSummary(ret[0]), sErr(ret[1])
 }
 
-func (s *TestSystem) BuildPr(src, dst string, options *CmdOptions) (*BuildSummary, error) {
-	ret := s.Interceptor.Call("BuildPr", src, dst, options)
+func (s *TestSystem) BuildPr(src, dst string, filterOptions *FilterOptions, options *CmdOptions) (*BuildSummary, error) {
+	ret := s.Interceptor.Call("BuildPr", src, dst, filterOptions, options)
 	return sBuildSummary(ret[0]), sErr(ret[1])
 }
 
-func (s *TestSystem) BuildDiff(from, to string, options *CmdOptions) (*BuildSummary, error) {
-	ret := s.Interceptor.Call("BuildDiff", from, to, options)
+func (s *TestSystem) BuildDiff(from, to string, filterOptions *FilterOptions, options *CmdOptions) (*BuildSummary, error) {
+	ret := s.Interceptor.Call("BuildDiff", from, to, filterOptions, options)
 	return sBuildSummary(ret[0]), sErr(ret[1])
 }
 
@@ -608,8 +651,8 @@ func (s *TestSystem) BuildCommit(commit string, filterOptions *FilterOptions, op
 	return sBuildSummary(ret[0]), sErr(ret[1])
 }
 
-func (s *TestSystem) BuildCommitContent(commit string, options *CmdOptions) (*BuildSummary, error) {
-	ret := s.Interceptor.Call("BuildCommitContent", commit, options)
+func (s *TestSystem) BuildCommitContent(commit string, filterOptions *FilterOptions, options *CmdOptions) (*BuildSummary, error) {
+	ret := s.Interceptor.Call("BuildCommitContent", commit, filterOptions, options)
 	return sBuildSummary(ret[0]), sErr(ret[1])
 
 }
@@ -619,8 +662,13 @@ func (s *TestSystem) BuildWorkspace(filterOptions *FilterOptions, options *CmdOp
 	return sBuildSummary(ret[0]), sErr(ret[1])
 }
 
-func (s *TestSystem) BuildWorkspaceChanges(options *CmdOptions) (*BuildSummary, error) {
-	ret := s.Interceptor.Call("BuildWorkspaceChanges", options)
+func (s *TestSystem) BuildWorkspaceChanges(filterOptions *FilterOptions, options *CmdOptions) (*BuildSummary, error) {
+	ret := s.Interceptor.Call("BuildWorkspaceChanges", filterOptions, options)
+	return sBuildSummary(ret[0]), sErr(ret[1])
+}
+
+func (s *TestSystem) BuildManifestFile(path string, options *CmdOptions) (*BuildSummary, error) {
+	ret := s.Interceptor.Call("BuildManifestFile", path, options)
 	return sBuildSummary(ret[0]), sErr(ret[1])
 }
 
@@ -629,13 +677,13 @@ func (s *TestSystem) RunInBranch(command, name string, filterOptions *FilterOpti
 	return sRunResult(ret[0]), sErr(ret[1])
 }
 
-func (s *TestSystem) RunInPr(command, src, dst string, options *CmdOptions) (*RunResult, error) {
-	ret := s.Interceptor.Call("RunInPr", command, src, dst, options)
+func (s *TestSystem) RunInPr(command, src, dst string, filterOptions *FilterOptions, options *CmdOptions) (*RunResult, error) {
+	ret := s.Interceptor.Call("RunInPr", command, src, dst, filterOptions, options)
 	return sRunResult(ret[0]), sErr(ret[1])
 }
 
-func (s *TestSystem) RunInDiff(command, from, to string, options *CmdOptions) (*RunResult, error) {
-	ret := s.Interceptor.Call("RunInDiff", command, from, to, options)
+func (s *TestSystem) RunInDiff(command, from, to string, filterOptions *FilterOptions, options *CmdOptions) (*RunResult, error) {
+	ret := s.Interceptor.Call("RunInDiff", command, from, to, filterOptions, options)
 	return sRunResult(ret[0]), sErr(ret[1])
 }
 
@@ -649,8 +697,8 @@ func (s *TestSystem) RunInCommit(command, commit string, filterOptions *FilterOp
 	return sRunResult(ret[0]), sErr(ret[1])
 }
 
-func (s *TestSystem) RunInCommitContent(command, commit string, options *CmdOptions) (*RunResult, error) {
-	ret := s.Interceptor.Call("RunInCommitContent", command, commit, options)
+func (s *TestSystem) RunInCommitContent(command, commit string, filterOptions *FilterOptions, options *CmdOptions) (*RunResult, error) {
+	ret := s.Interceptor.Call("RunInCommitContent", command, commit, filterOptions, options)
 	return sRunResult(ret[0]), sErr(ret[1])
 
 }
@@ -660,8 +708,13 @@ func (s *TestSystem) RunInWorkspace(command string, filterOptions *FilterOptions
 	return sRunResult(ret[0]), sErr(ret[1])
 }
 
-func (s *TestSystem) RunInWorkspaceChanges(command string, options *CmdOptions) (*RunResult, error) {
-	ret := s.Interceptor.Call("RunInWorkspaceChanges", command, options)
+func (s *TestSystem) RunInWorkspaceChanges(command string, filterOptions *FilterOptions, options *CmdOptions) (*RunResult, error) {
+	ret := s.Interceptor.Call("RunInWorkspaceChanges", command, filterOptions, options)
+	return sRunResult(ret[0]), sErr(ret[1])
+}
+
+func (s *TestSystem) RunInManifestFile(command, path string, options *CmdOptions) (*RunResult, error) {
+	ret := s.Interceptor.Call("RunInManifestFile", command, path, options)
 	return sRunResult(ret[0]), sErr(ret[1])
 }
 
@@ -715,6 +768,26 @@ func (s *TestSystem) ManifestByWorkspaceChanges() (*Manifest, error) {
 	return sManifest(ret[0]), sErr(ret[1])
 }
 
+func (s *TestSystem) ManifestByFile(path string) (*Manifest, error) {
+	ret := s.Interceptor.Call("ManifestByFile", path)
+	return sManifest(ret[0]), sErr(ret[1])
+}
+
+func (s *TestSystem) CompareCommits(from, to string) (*Comparison, error) {
+	ret := s.Interceptor.Call("CompareCommits", from, to)
+	return sComparison(ret[0]), sErr(ret[1])
+}
+
+func (s *TestSystem) LintCommit(commit string) ([]*LintProblem, error) {
+	ret := s.Interceptor.Call("LintCommit", commit)
+	return sLintProblems(ret[0]), sErr(ret[1])
+}
+
+func (s *TestSystem) LintWorkspace() ([]*LintProblem, error) {
+	ret := s.Interceptor.Call("LintWorkspace")
+	return sLintProblems(ret[0]), sErr(ret[1])
+}
+
 type TestDiscover struct {
 	Interceptor *intercept.Interceptor
 }
@@ -747,12 +820,21 @@ func (w *TestWorkspaceManager) CheckoutAndRun(commit string, fn func() (interfac
 	return ret[0], sErr(ret[1])
 }
 
+type TestIsolatedWorkspaceManager struct {
+	Interceptor *intercept.Interceptor
+}
+
+func (w *TestIsolatedWorkspaceManager) ExportAndRun(commit string, fn func(dir string) (interface{}, error)) (interface{}, error) {
+	ret := w.Interceptor.Call("ExportAndRun", commit, fn)
+	return ret[0], sErr(ret[1])
+}
+
 type TestProcessManager struct {
 	Interceptor *intercept.Interceptor
 }
 
-func (p *TestProcessManager) Exec(manifest *Manifest, module *Module, options *CmdOptions, command string, args ...string) error {
-	rest := []interface{}{manifest, module, options, command}
+func (p *TestProcessManager) Exec(ctx context.Context, manifest *Manifest, module *Module, options *CmdOptions, command string, args ...string) error {
+	rest := []interface{}{ctx, manifest, module, options, command}
 	for _, a := range args {
 		rest = append(rest, a)
 	}
@@ -762,29 +844,40 @@ func (p *TestProcessManager) Exec(manifest *Manifest, module *Module, options *C
 
 func buildWorld(repo string, failureCallback func(error)) *World {
 	log := NewStdLog(LogLevelNormal)
-	libgitRepo, err := NewLibgitRepo(repo, log)
+	gitRepo, err := NewRepo(repo, log)
 	if err != nil {
 		failureCallback(err)
 		return nil
 	}
 
-	r := &TestRepo{Interceptor: intercept.NewInterceptor(libgitRepo)}
+	r := &TestRepo{Interceptor: intercept.NewInterceptor(gitRepo)}
 
 	discover := &TestDiscover{Interceptor: intercept.NewInterceptor(NewDiscover(r, log))}
 	reducer := &TestReducer{Interceptor: intercept.NewInterceptor(NewReducer(log))}
 	mb := &TestManifestBuilder{Interceptor: intercept.NewInterceptor(NewManifestBuilder(r, reducer, discover, log))}
 	wm := &TestWorkspaceManager{Interceptor: intercept.NewInterceptor(NewWorkspaceManager(log, r))}
 	pm := &TestProcessManager{Interceptor: intercept.NewInterceptor(NewProcessManager(log))}
+	iwm := &TestIsolatedWorkspaceManager{Interceptor: intercept.NewInterceptor(NewIsolatedWorkspaceManager(log, r))}
+	system := NewSystemWith(r,
+		WithLog(log),
+		WithManifestBuilder(mb),
+		WithDiscover(discover),
+		WithReducer(reducer),
+		WithWorkspaceManager(wm),
+		WithProcessManager(pm),
+		WithIsolatedWorkspaceManager(iwm),
+	)
 
 	return &World{
-		Log:              log,
-		Repo:             r,
-		Discover:         discover,
-		Reducer:          reducer,
-		ManifestBuilder:  mb,
-		WorkspaceManager: wm,
-		ProcessManager:   pm,
-		System:           &TestSystem{Interceptor: intercept.NewInterceptor(initSystem(log, r, mb, discover, reducer, wm, pm))},
+		Log:                      log,
+		Repo:                     r,
+		Discover:                 discover,
+		Reducer:                  reducer,
+		ManifestBuilder:          mb,
+		WorkspaceManager:         wm,
+		ProcessManager:           pm,
+		IsolatedWorkspaceManager: iwm,
+		System:                   &TestSystem{Interceptor: intercept.NewInterceptor(system)},
 	}
 }
 
@@ -0,0 +1,819 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mbtproject/mbt/e"
+)
+
+// MemoryRepo is a Repo kept entirely in memory.
+// Commits, branches and workspace state are constructed
+// programmatically, which makes it possible to test the tools
+// built on top of System without creating git repositories on disk.
+type MemoryRepo interface {
+	Repo
+	// WriteFile writes a regular file into the workspace.
+	WriteFile(path, content string)
+	// WriteFileWithMode writes a file with the specified mode
+	// (e.g. 0755 for an executable script) into the workspace.
+	WriteFileWithMode(path, content string, mode os.FileMode)
+	// RemoveFile removes a file from the workspace.
+	RemoveFile(path string)
+	// Commit records the current state of the workspace as a new
+	// commit in the current branch (or the detached head).
+	Commit(message string) (Commit, error)
+	// CreateBranch creates a branch pointing to the specified commit.
+	CreateBranch(name string, commit Commit) error
+	// SwitchToBranch makes the specified branch the current branch
+	// and resets the workspace to its tree.
+	SwitchToBranch(name string) error
+	// CreateTag creates a tag pointing to the specified commit.
+	CreateTag(name string, commit Commit) error
+	// Merge creates a commit in the current branch merging the
+	// changes in the specified branch.
+	Merge(branch, message string) (Commit, error)
+}
+
+type memoryFile struct {
+	contents []byte
+	mode     os.FileMode
+}
+
+type memoryFiles map[string]*memoryFile
+
+type memoryCommit struct {
+	id      string
+	parents []*memoryCommit
+	files   memoryFiles
+}
+
+func (c *memoryCommit) ID() string {
+	return c.id
+}
+
+func (c *memoryCommit) String() string {
+	return c.id
+}
+
+type memoryBlob struct {
+	path     string
+	name     string
+	id       string
+	mode     uint32
+	contents []byte
+}
+
+func (b *memoryBlob) ID() string {
+	return b.id
+}
+
+func (b *memoryBlob) Name() string {
+	return b.name
+}
+
+func (b *memoryBlob) Path() string {
+	return b.path
+}
+
+func (b *memoryBlob) Mode() uint32 {
+	return b.mode
+}
+
+func (b *memoryBlob) String() string {
+	return fmt.Sprintf("%s%s", b.Path(), b.Name())
+}
+
+type memoryReference struct {
+	branch string
+	commit *memoryCommit
+}
+
+func (r *memoryReference) Name() string {
+	if r.branch != "" {
+		return "refs/heads/" + r.branch
+	}
+	return r.commit.id
+}
+
+func (r *memoryReference) SymbolicName() string {
+	if r.branch != "" {
+		return "refs/heads/" + r.branch
+	}
+	return ""
+}
+
+type memoryRepo struct {
+	path      string
+	commits   map[string]*memoryCommit
+	branches  map[string]*memoryCommit
+	tags      map[string]*memoryCommit
+	branch    string
+	detached  *memoryCommit
+	workspace memoryFiles
+}
+
+// NewMemoryRepo creates an empty MemoryRepo with master as
+// the current branch.
+// path is reported as the location of the repository and it is
+// where the commands are executed when a System is backed by
+// this repo.
+func NewMemoryRepo(path string) MemoryRepo {
+	return &memoryRepo{
+		path:      path,
+		commits:   make(map[string]*memoryCommit),
+		branches:  make(map[string]*memoryCommit),
+		tags:      make(map[string]*memoryCommit),
+		branch:    "master",
+		workspace: make(memoryFiles),
+	}
+}
+
+func (r *memoryRepo) WriteFile(path, content string) {
+	r.WriteFileWithMode(path, content, 0644)
+}
+
+func (r *memoryRepo) WriteFileWithMode(path, content string, mode os.FileMode) {
+	r.workspace[path] = &memoryFile{contents: []byte(content), mode: mode}
+}
+
+func (r *memoryRepo) RemoveFile(path string) {
+	delete(r.workspace, path)
+}
+
+func (r *memoryRepo) Commit(message string) (Commit, error) {
+	var parents []*memoryCommit
+	if head := r.head(); head != nil {
+		parents = append(parents, head)
+	}
+
+	return r.commit(message, parents, r.workspace.clone()), nil
+}
+
+func (r *memoryRepo) CreateBranch(name string, commit Commit) error {
+	c, err := r.lookup(commit)
+	if err != nil {
+		return err
+	}
+
+	r.branches[name] = c
+	return nil
+}
+
+func (r *memoryRepo) SwitchToBranch(name string) error {
+	c, ok := r.branches[name]
+	if !ok {
+		return e.NewErrorf(ErrClassUser, msgFailedBranchLookup, name)
+	}
+
+	r.branch = name
+	r.detached = nil
+	r.workspace = c.files.clone()
+	return nil
+}
+
+func (r *memoryRepo) CreateTag(name string, commit Commit) error {
+	c, err := r.lookup(commit)
+	if err != nil {
+		return err
+	}
+
+	r.tags[name] = c
+	return nil
+}
+
+func (r *memoryRepo) Merge(branch, message string) (Commit, error) {
+	if err := r.EnsureSafeWorkspace(); err != nil {
+		return nil, err
+	}
+
+	theirs, ok := r.branches[branch]
+	if !ok {
+		return nil, e.NewErrorf(ErrClassUser, msgFailedBranchLookup, branch)
+	}
+
+	ours := r.head()
+	if ours == nil {
+		return nil, e.NewErrorf(ErrClassUser, msgFailedBranchLookup, r.branch)
+	}
+
+	base := r.mergeBase(ours, theirs)
+	if base == nil {
+		return nil, e.NewErrorf(ErrClassUser, msgFailedMergeBase, ours, theirs)
+	}
+
+	files := ours.files.clone()
+	for _, p := range r.diffFiles(base.files, theirs.files) {
+		if !sameFile(base.files, ours.files, p) && !sameFile(ours.files, theirs.files, p) {
+			return nil, e.NewErrorf(ErrClassUser, msgMergeConflict, p)
+		}
+
+		if c, ok := theirs.files[p]; ok {
+			files[p] = c
+		} else {
+			delete(files, p)
+		}
+	}
+
+	c := r.commit(message, []*memoryCommit{ours, theirs}, files)
+	r.workspace = files.clone()
+	return c, nil
+}
+
+func (r *memoryRepo) GetCommit(commitSha string) (Commit, error) {
+	if len(commitSha) != 40 || !isHex(commitSha) {
+		return nil, e.NewErrorf(ErrClassUser, msgInvalidSha, commitSha)
+	}
+
+	c, ok := r.commits[commitSha]
+	if !ok {
+		return nil, e.NewErrorf(ErrClassUser, msgCommitShaNotFound, commitSha)
+	}
+
+	return c, nil
+}
+
+func (r *memoryRepo) ResolveRevision(rev string) (Commit, error) {
+	i := strings.IndexAny(rev, "~^")
+	if i < 0 {
+		i = len(rev)
+	}
+
+	c, err := r.resolveName(rev, rev[:i])
+	if err != nil {
+		return nil, err
+	}
+
+	for ops := rev[i:]; ops != ""; {
+		op := ops[0]
+		j := 1
+		for j < len(ops) && ops[j] >= '0' && ops[j] <= '9' {
+			j++
+		}
+
+		n := 1
+		if j > 1 {
+			n, _ = strconv.Atoi(ops[1:j])
+		}
+		ops = ops[j:]
+
+		if op == '~' {
+			for ; n > 0 && c != nil; n-- {
+				c = firstParent(c)
+			}
+		} else if n > 0 {
+			if n > len(c.parents) {
+				c = nil
+			} else {
+				c = c.parents[n-1]
+			}
+		}
+
+		if c == nil {
+			return nil, e.NewErrorf(ErrClassUser, msgUnknownRevision, rev)
+		}
+	}
+
+	return c, nil
+}
+
+func (r *memoryRepo) Path() string {
+	return r.path
+}
+
+func (r *memoryRepo) Diff(a, b Commit) ([]*DiffDelta, error) {
+	ca, err := r.lookup(a)
+	if err != nil {
+		return nil, err
+	}
+
+	cb, err := r.lookup(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.deltas(ca.files, cb.files), nil
+}
+
+func (r *memoryRepo) DiffMergeBase(from, to Commit) ([]*DiffDelta, error) {
+	bc, err := r.MergeBase(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Diff(bc, to)
+}
+
+func (r *memoryRepo) DiffWorkspace() ([]*DiffDelta, error) {
+	return toDeltas(r.diffFiles(r.headFiles(), r.workspace)), nil
+}
+
+func (r *memoryRepo) Changes(commit Commit) ([]*DiffDelta, error) {
+	c, err := r.lookup(commit)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(c.parents) == 0 {
+		return []*DiffDelta{}, nil
+	}
+
+	return r.deltas(c.files, c.parents[0].files), nil
+}
+
+func (r *memoryRepo) WalkBlobs(commit Commit, callback BlobWalkCallback) error {
+	c, err := r.lookup(commit)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range c.files.blobs() {
+		err := callback(b)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *memoryRepo) BlobContents(blob Blob) ([]byte, error) {
+	b, ok := blob.(*memoryBlob)
+	if !ok {
+		return nil, e.NewErrorf(ErrClassInternal, "%v is not a blob in memory repo", blob)
+	}
+
+	return b.contents, nil
+}
+
+func (r *memoryRepo) BlobContentsFromTree(commit Commit, path string) ([]byte, error) {
+	c, err := r.lookup(commit)
+	if err != nil {
+		return nil, err
+	}
+
+	f, ok := c.files[path]
+	if !ok {
+		return nil, e.NewErrorf(ErrClassInternal, "path %s does not exist in commit %v", path, c)
+	}
+
+	return f.contents, nil
+}
+
+func (r *memoryRepo) EntryID(commit Commit, path string) (string, error) {
+	c, err := r.lookup(commit)
+	if err != nil {
+		return "", err
+	}
+
+	id, ok := c.files.entryID(path)
+	if !ok {
+		return "", e.NewErrorf(ErrClassInternal, msgFailedTreeEntryRead, path)
+	}
+
+	return id, nil
+}
+
+func (r *memoryRepo) BranchCommit(name string) (Commit, error) {
+	ref := strings.TrimPrefix(name, "refs/")
+	if c, ok := r.tags[strings.TrimPrefix(ref, "tags/")]; ok {
+		return c, nil
+	}
+
+	if c, ok := r.branches[strings.TrimPrefix(ref, "heads/")]; ok {
+		return c, nil
+	}
+
+	err := fmt.Errorf("no reference found for shorthand '%s'", name)
+	return nil, e.Wrapf(ErrClassUser, err, msgFailedBranchLookup, name)
+}
+
+func (r *memoryRepo) CurrentBranch() (string, error) {
+	if r.detached != nil {
+		return "", e.NewError(ErrClassInternal, msgDetachedHead)
+	}
+
+	return r.branch, nil
+}
+
+func (r *memoryRepo) CurrentBranchCommit() (Commit, error) {
+	b, err := r.CurrentBranch()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.BranchCommit(b)
+}
+
+func (r *memoryRepo) IsEmpty() (bool, error) {
+	return len(r.commits) == 0, nil
+}
+
+func (r *memoryRepo) FindAllFilesInWorkspace(pathSpec []string) ([]string, error) {
+	var files []string
+	for _, p := range r.workspace.paths() {
+		if matchPathSpec(pathSpec, p) {
+			files = append(files, p)
+		}
+	}
+
+	return files, nil
+}
+
+func (r *memoryRepo) WorkspaceEntryIDs(paths []string) (map[string]string, error) {
+	ids := make(map[string]string)
+	for _, p := range paths {
+		if id, ok := r.workspace.entryID(p); ok {
+			ids[p] = id
+		}
+	}
+
+	return ids, nil
+}
+
+func (r *memoryRepo) WorkspaceBlobs() ([]Blob, error) {
+	return r.workspace.blobs(), nil
+}
+
+func (r *memoryRepo) WorkspaceFileContents(path string) ([]byte, error) {
+	f, ok := r.workspace[filepath.ToSlash(path)]
+	if !ok {
+		return nil, e.Wrap(ErrClassInternal, os.ErrNotExist)
+	}
+
+	return f.contents, nil
+}
+
+func (r *memoryRepo) EnsureSafeWorkspace() error {
+	if len(r.diffFiles(r.headFiles(), r.workspace)) > 0 {
+		return e.NewError(ErrClassUser, msgDirtyWorkingDir)
+	}
+
+	return nil
+}
+
+func (r *memoryRepo) Checkout(commit Commit) (Reference, error) {
+	c, err := r.lookup(commit)
+	if err != nil {
+		return nil, err
+	}
+
+	reference := &memoryReference{commit: r.detached}
+	if r.detached == nil {
+		reference.branch = r.branch
+	}
+
+	r.detached = c
+	r.workspace = c.files.clone()
+	return reference, nil
+}
+
+func (r *memoryRepo) CheckoutReference(reference Reference) error {
+	ref, ok := reference.(*memoryReference)
+	if !ok {
+		return e.NewErrorf(ErrClassInternal, "%v is not a reference in memory repo", reference.Name())
+	}
+
+	if ref.branch != "" {
+		r.branch = ref.branch
+		r.detached = nil
+	} else {
+		r.detached = ref.commit
+	}
+
+	r.workspace = r.headFiles().clone()
+	return nil
+}
+
+func (r *memoryRepo) Export(commit Commit, dir string) error {
+	c, err := r.lookup(commit)
+	if err != nil {
+		return err
+	}
+
+	for p, f := range c.files {
+		target := filepath.Join(dir, filepath.FromSlash(p))
+		err := os.MkdirAll(filepath.Dir(target), 0755)
+		if err != nil {
+			return e.Wrap(ErrClassInternal, err)
+		}
+
+		err = ioutil.WriteFile(target, f.contents, f.mode)
+		if err != nil {
+			return e.Wrap(ErrClassInternal, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *memoryRepo) MergeBase(a, b Commit) (Commit, error) {
+	ca, err := r.lookup(a)
+	if err != nil {
+		return nil, err
+	}
+
+	cb, err := r.lookup(b)
+	if err != nil {
+		return nil, err
+	}
+
+	base := r.mergeBase(ca, cb)
+	if base == nil {
+		return nil, e.NewErrorf(ErrClassInternal, msgFailedMergeBase, a.ID(), b.ID())
+	}
+
+	return base, nil
+}
+
+func (r *memoryRepo) commit(message string, parents []*memoryCommit, files memoryFiles) *memoryCommit {
+	h := sha1.New()
+	fmt.Fprintf(h, "%v\x00%s\x00", len(r.commits), message)
+	for _, p := range parents {
+		fmt.Fprintf(h, "%s\x00", p.id)
+	}
+	for _, p := range files.paths() {
+		fmt.Fprintf(h, "%s\x00%o\x00%s\n", p, files[p].mode, blobID(files[p].contents))
+	}
+
+	c := &memoryCommit{id: fmt.Sprintf("%x", h.Sum(nil)), parents: parents, files: files}
+	r.commits[c.id] = c
+	if r.detached != nil {
+		r.detached = c
+	} else {
+		r.branches[r.branch] = c
+	}
+
+	return c
+}
+
+// head returns the commit currently checked out or nil
+// if the current branch does not have any commits yet.
+func (r *memoryRepo) head() *memoryCommit {
+	if r.detached != nil {
+		return r.detached
+	}
+
+	return r.branches[r.branch]
+}
+
+func (r *memoryRepo) headFiles() memoryFiles {
+	if head := r.head(); head != nil {
+		return head.files
+	}
+
+	return memoryFiles{}
+}
+
+func (r *memoryRepo) lookup(commit Commit) (*memoryCommit, error) {
+	c, ok := r.commits[commit.ID()]
+	if !ok {
+		return nil, e.NewErrorf(ErrClassUser, msgCommitShaNotFound, commit.ID())
+	}
+
+	return c, nil
+}
+
+func (r *memoryRepo) resolveName(rev, name string) (*memoryCommit, error) {
+	if name == "HEAD" || name == "@" {
+		if head := r.head(); head != nil {
+			return head, nil
+		}
+	} else if name != "" {
+		if c, err := r.BranchCommit(name); err == nil {
+			return c.(*memoryCommit), nil
+		}
+
+		if isHex(name) && len(name) >= 4 {
+			var match *memoryCommit
+			for id, c := range r.commits {
+				if strings.HasPrefix(id, strings.ToLower(name)) {
+					if match != nil {
+						return nil, e.NewErrorf(ErrClassUser, msgAmbiguousRevision, rev)
+					}
+					match = c
+				}
+			}
+
+			if match != nil {
+				return match, nil
+			}
+		}
+	}
+
+	return nil, e.NewErrorf(ErrClassUser, msgUnknownRevision, rev)
+}
+
+// mergeBase returns the closest common ancestor of a and b.
+func (r *memoryRepo) mergeBase(a, b *memoryCommit) *memoryCommit {
+	ancestors := make(map[string]bool)
+	for queue := []*memoryCommit{a}; len(queue) > 0; queue = queue[1:] {
+		if !ancestors[queue[0].id] {
+			ancestors[queue[0].id] = true
+			queue = append(queue, queue[0].parents...)
+		}
+	}
+
+	visited := make(map[string]bool)
+	for queue := []*memoryCommit{b}; len(queue) > 0; queue = queue[1:] {
+		c := queue[0]
+		if ancestors[c.id] {
+			return c
+		}
+
+		if !visited[c.id] {
+			visited[c.id] = true
+			queue = append(queue, c.parents...)
+		}
+	}
+
+	return nil
+}
+
+// deltas returns the deltas between a and b. Similar to git, a file
+// deleted and added with the same contents is reported as a rename.
+func (r *memoryRepo) deltas(a, b memoryFiles) []*DiffDelta {
+	paths := r.diffFiles(a, b)
+	renamed := make(map[string]bool)
+	deltas := make([]*DiffDelta, 0, len(paths))
+	for _, p := range paths {
+		if renamed[p] {
+			continue
+		}
+
+		delta := &DiffDelta{OldFile: p, NewFile: p}
+		if deleted, ok := a[p]; ok {
+			if _, ok := b[p]; !ok {
+				for _, n := range paths {
+					added, ok := b[n]
+					if _, existing := a[n]; ok && !existing && !renamed[n] && string(added.contents) == string(deleted.contents) {
+						renamed[n] = true
+						delta.NewFile = n
+						break
+					}
+				}
+			}
+		}
+
+		deltas = append(deltas, delta)
+	}
+
+	return deltas
+}
+
+// diffFiles returns the sorted list of paths that differ between a and b.
+func (r *memoryRepo) diffFiles(a, b memoryFiles) []string {
+	var paths []string
+	for p := range a {
+		if !sameFile(a, b, p) {
+			paths = append(paths, p)
+		}
+	}
+
+	for p := range b {
+		if _, ok := a[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+
+	sort.Strings(paths)
+	return paths
+}
+
+func (f memoryFiles) clone() memoryFiles {
+	c := make(memoryFiles, len(f))
+	for p, file := range f {
+		c[p] = file
+	}
+
+	return c
+}
+
+func (f memoryFiles) paths() []string {
+	paths := make([]string, 0, len(f))
+	for p := range f {
+		paths = append(paths, p)
+	}
+
+	sort.Strings(paths)
+	return paths
+}
+
+// entryID returns the id of a file or a directory in the set.
+// Directory ids are computed from the paths and ids of the files
+// under it. Empty path refers to the root directory.
+func (f memoryFiles) entryID(path string) (string, bool) {
+	path = strings.Trim(path, "/")
+	if file, ok := f[path]; ok {
+		return blobID(file.contents), true
+	}
+
+	h := sha1.New()
+	found := false
+	for _, p := range f.paths() {
+		if path == "" || strings.HasPrefix(p, path+"/") {
+			found = true
+			fmt.Fprintf(h, "%s\x00%o\x00%s\n", p, f[p].mode, blobID(f[p].contents))
+		}
+	}
+
+	if !found {
+		return "", false
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), true
+}
+
+// blobs returns the blobs of the files in path order.
+func (f memoryFiles) blobs() []Blob {
+	blobs := make([]Blob, 0, len(f))
+	for _, p := range f.paths() {
+		dir := path.Dir(p)
+		if dir == "." {
+			dir = ""
+		} else {
+			dir += "/"
+		}
+
+		file := f[p]
+		blobs = append(blobs, &memoryBlob{path: dir, name: path.Base(p), id: blobID(file.contents), mode: file.gitMode(), contents: file.contents})
+	}
+
+	return blobs
+}
+
+// gitMode returns the mode git would record for the file.
+func (f *memoryFile) gitMode() uint32 {
+	switch {
+	case f.mode&os.ModeSymlink != 0:
+		return gitModeSymlink
+	case f.mode&0111 != 0:
+		return gitModeExecutable
+	default:
+		return gitModeFile
+	}
+}
+
+func sameFile(a, b memoryFiles, p string) bool {
+	fa, oka := a[p]
+	fb, okb := b[p]
+	if !oka || !okb {
+		return oka == okb
+	}
+
+	return fa.mode == fb.mode && string(fa.contents) == string(fb.contents)
+}
+
+func firstParent(c *memoryCommit) *memoryCommit {
+	if len(c.parents) == 0 {
+		return nil
+	}
+
+	return c.parents[0]
+}
+
+func toDeltas(paths []string) []*DiffDelta {
+	deltas := make([]*DiffDelta, 0, len(paths))
+	for _, p := range paths {
+		deltas = append(deltas, &DiffDelta{OldFile: p, NewFile: p})
+	}
+
+	return deltas
+}
+
+// blobID returns the git object id of a blob with the specified contents.
+func blobID(contents []byte) string {
+	return fmt.Sprintf("%x", sha1.Sum(append([]byte(fmt.Sprintf("blob %v\x00", len(contents))), contents...)))
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+
+	return true
+}
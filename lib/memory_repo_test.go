@@ -0,0 +1,470 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/mbtproject/mbt/e"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMemoryRepo(t *testing.T) (MemoryRepo, Commit, Commit) {
+	repo := NewMemoryRepo(".tmp/repo")
+	repo.WriteFile("app-a/.mbt.yml", "name: app-a\nbuild:\n  default:\n    cmd: echo\n")
+	repo.WriteFile("app-b/.mbt.yml", "name: app-b\nbuild:\n  default:\n    cmd: echo\n")
+	first, err := repo.Commit("first")
+	check(t, err)
+
+	repo.WriteFile("app-b/main.go", "package main")
+	second, err := repo.Commit("second")
+	check(t, err)
+
+	return repo, first, second
+}
+
+func TestMemoryRepoHistory(t *testing.T) {
+	repo, first, second := newTestMemoryRepo(t)
+
+	head, err := repo.CurrentBranchCommit()
+	check(t, err)
+	assert.Equal(t, second.ID(), head.ID())
+
+	for _, rev := range []string{"HEAD~1", "HEAD^", "master~", first.ID()[:7], first.ID()} {
+		c, err := repo.ResolveRevision(rev)
+		check(t, err)
+		assert.Equal(t, first.ID(), c.ID(), rev)
+	}
+
+	_, err = repo.ResolveRevision("HEAD~2")
+	assert.EqualError(t, err, fmt.Sprintf(msgUnknownRevision, "HEAD~2"))
+
+	delta, err := repo.Diff(first, second)
+	check(t, err)
+	assert.Len(t, delta, 1)
+	assert.Equal(t, "app-b/main.go", delta[0].NewFile)
+
+	delta, err = repo.Changes(first)
+	check(t, err)
+	assert.Len(t, delta, 0)
+
+	_, err = repo.BranchCommit("foo")
+	assert.EqualError(t, err, fmt.Sprintf(msgFailedBranchLookup, "foo"))
+	assert.EqualError(t, (err.(*e.E)).InnerError(), "no reference found for shorthand 'foo'")
+}
+
+func TestMemoryRepoBranchesAndMerges(t *testing.T) {
+	repo, first, second := newTestMemoryRepo(t)
+
+	check(t, repo.CreateBranch("feature", first))
+	check(t, repo.SwitchToBranch("feature"))
+	repo.WriteFile("app-a/main.go", "package main")
+	feature, err := repo.Commit("feature")
+	check(t, err)
+
+	base, err := repo.MergeBase(feature, second)
+	check(t, err)
+	assert.Equal(t, first.ID(), base.ID())
+
+	delta, err := repo.DiffMergeBase(second, feature)
+	check(t, err)
+	assert.Len(t, delta, 1)
+	assert.Equal(t, "app-a/main.go", delta[0].NewFile)
+
+	check(t, repo.SwitchToBranch("master"))
+	merge, err := repo.Merge("feature", "merge")
+	check(t, err)
+
+	contents, err := repo.BlobContentsFromTree(merge, "app-a/main.go")
+	check(t, err)
+	assert.Equal(t, "package main", string(contents))
+
+	parent, err := repo.ResolveRevision("HEAD^2")
+	check(t, err)
+	assert.Equal(t, feature.ID(), parent.ID())
+}
+
+func TestMemoryRepoMergeOfUnrelatedHistories(t *testing.T) {
+	repo, _, second := newTestMemoryRepo(t)
+
+	check(t, repo.CheckoutReference(&memoryReference{branch: "orphan"}))
+	repo.WriteFile("app-c/.mbt.yml", "name: app-c\n")
+	orphan, err := repo.Commit("orphan")
+	check(t, err)
+
+	check(t, repo.SwitchToBranch("master"))
+	_, err = repo.Merge("orphan", "merge")
+
+	assert.EqualError(t, err, fmt.Sprintf(msgFailedMergeBase, second, orphan))
+	assert.Equal(t, ErrClassUser, (err.(*e.E)).Class())
+}
+
+func TestMemoryRepoMergeConflict(t *testing.T) {
+	repo, first, _ := newTestMemoryRepo(t)
+
+	check(t, repo.CreateBranch("feature", first))
+	check(t, repo.SwitchToBranch("feature"))
+	repo.WriteFile("app-b/main.go", "package app")
+	_, err := repo.Commit("feature")
+	check(t, err)
+
+	check(t, repo.SwitchToBranch("master"))
+	_, err = repo.Merge("feature", "merge")
+
+	assert.EqualError(t, err, fmt.Sprintf(msgMergeConflict, "app-b/main.go"))
+	assert.Equal(t, ErrClassUser, (err.(*e.E)).Class())
+}
+
+func TestMemoryRepoExportPreservesFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not supported on windows")
+	}
+
+	repo := NewMemoryRepo(".tmp/repo")
+	repo.WriteFileWithMode("app-a/build.sh", "echo built app-a", 0755)
+	repo.WriteFile("app-a/.mbt.yml", "name: app-a\n")
+	c, err := repo.Commit("first")
+	check(t, err)
+
+	dir, err := ioutil.TempDir("", "mbt-test-")
+	check(t, err)
+	defer os.RemoveAll(dir)
+
+	check(t, repo.Export(c, dir))
+
+	script, err := os.Stat(filepath.Join(dir, "app-a", "build.sh"))
+	check(t, err)
+	assert.Equal(t, os.FileMode(0755), script.Mode().Perm())
+
+	spec, err := os.Stat(filepath.Join(dir, "app-a", ".mbt.yml"))
+	check(t, err)
+	assert.Equal(t, os.FileMode(0644), spec.Mode().Perm())
+}
+
+func TestMemoryRepoModeChangeIsAChange(t *testing.T) {
+	repo := NewMemoryRepo(".tmp/repo")
+	repo.WriteFile("app-a/build.sh", "echo built app-a")
+	first, err := repo.Commit("first")
+	check(t, err)
+
+	repo.WriteFileWithMode("app-a/build.sh", "echo built app-a", 0755)
+	assert.Error(t, repo.EnsureSafeWorkspace())
+
+	second, err := repo.Commit("second")
+	check(t, err)
+
+	delta, err := repo.Diff(first, second)
+	check(t, err)
+	assert.Len(t, delta, 1)
+	assert.Equal(t, "app-a/build.sh", delta[0].NewFile)
+}
+
+func TestMemoryRepoWorkspace(t *testing.T) {
+	repo, _, second := newTestMemoryRepo(t)
+	check(t, repo.EnsureSafeWorkspace())
+
+	repo.WriteFile("app-c/.mbt.yml", "name: app-c\n")
+	repo.RemoveFile("app-b/main.go")
+
+	assert.EqualError(t, repo.EnsureSafeWorkspace(), msgDirtyWorkingDir)
+
+	delta, err := repo.DiffWorkspace()
+	check(t, err)
+	assert.Len(t, delta, 2)
+	assert.Equal(t, "app-b/main.go", delta[0].NewFile)
+	assert.Equal(t, "app-c/.mbt.yml", delta[1].NewFile)
+
+	files, err := repo.FindAllFilesInWorkspace([]string{configFileName, "/**/" + configFileName})
+	check(t, err)
+	assert.Equal(t, []string{"app-a/.mbt.yml", "app-b/.mbt.yml", "app-c/.mbt.yml"}, files)
+
+	ref, err := repo.Checkout(second)
+	check(t, err)
+	_, err = repo.CurrentBranch()
+	assert.EqualError(t, err, msgDetachedHead)
+
+	check(t, repo.CheckoutReference(ref))
+	b, err := repo.CurrentBranch()
+	check(t, err)
+	assert.Equal(t, "master", b)
+	check(t, repo.EnsureSafeWorkspace())
+}
+
+func TestSystemWithMemoryRepo(t *testing.T) {
+	repo, first, second := newTestMemoryRepo(t)
+	system := NewSystemWith(repo)
+
+	m, err := system.ManifestByDiff(first.ID(), second.ID())
+	check(t, err)
+	assert.Len(t, m.Modules, 1)
+	assert.Equal(t, "app-b", m.Modules[0].Name())
+	assert.Equal(t, second.ID(), m.Sha)
+
+	m, err = system.ManifestByCurrentBranch()
+	check(t, err)
+	assert.Len(t, m.Modules, 2)
+
+	repo.WriteFile("app-a/main.go", "package main")
+	m, err = system.ManifestByWorkspaceChanges()
+	check(t, err)
+	assert.Len(t, m.Modules, 1)
+	assert.Equal(t, "app-a", m.Modules[0].Name())
+}
+
+func TestNewSystemWithOptions(t *testing.T) {
+	repo := NewMemoryRepo(".tmp/repo")
+	pm := NewProcessManager(NewStdLog(LogLevelNormal))
+
+	s := NewSystemWith(repo, WithProcessManager(pm)).(*stdSystem)
+
+	assert.Equal(t, pm, s.ProcessManager)
+	assert.Equal(t, repo, s.Repo)
+	assert.NotNil(t, s.Log)
+	assert.NotNil(t, s.MB)
+	assert.NotNil(t, s.WorkspaceManager)
+	assert.NotNil(t, s.IsolatedWorkspaceManager)
+}
+
+type testExportManager struct {
+	dir     string
+	commits []string
+}
+
+func (w *testExportManager) ExportAndRun(commit string, fn func(dir string) (interface{}, error)) (interface{}, error) {
+	w.commits = append(w.commits, commit)
+	return fn(w.dir)
+}
+
+type testDirProcessManager struct {
+	dirs []string
+}
+
+func (p *testDirProcessManager) Exec(ctx context.Context, manifest *Manifest, module *Module, options *CmdOptions, command string, args ...string) error {
+	p.dirs = append(p.dirs, manifest.Dir)
+	return nil
+}
+
+func TestIsolatedBuildWithMemoryRepo(t *testing.T) {
+	repo := NewMemoryRepo(".tmp/repo")
+	repo.WriteFile("app-a/.mbt.yml", "name: app-a\nbuild:\n  default:\n    cmd: make\n")
+	c, err := repo.Commit("first")
+	check(t, err)
+
+	iwm := &testExportManager{dir: "/exported"}
+	pm := &testDirProcessManager{}
+	system := NewSystemWith(repo, WithIsolatedWorkspaceManager(iwm), WithProcessManager(pm))
+
+	options := CmdOptionsWithStdIO(noopCb)
+	options.Isolated = true
+	summary, err := system.BuildCommit(c.ID(), NoFilter, options)
+	check(t, err)
+
+	repoDir, err := filepath.Abs(".tmp/repo")
+	check(t, err)
+	assert.Equal(t, []string{c.ID()}, iwm.commits)
+	assert.Equal(t, []string{"/exported"}, pm.dirs)
+	assert.Len(t, summary.Completed, 1)
+	assert.Equal(t, repoDir, summary.Manifest.Dir)
+}
+
+func TestReasonsWithMemoryRepo(t *testing.T) {
+	repo, first, _ := newTestMemoryRepo(t)
+	repo.WriteFile("app-c/.mbt.yml", "name: app-c\ndependencies: [app-b]\n")
+	repo.WriteFile("app-b/main.go", "package app")
+	head, err := repo.Commit("third")
+	check(t, err)
+
+	m, err := NewSystemWith(repo).ManifestByDiff(first.ID(), head.ID())
+	check(t, err)
+
+	mods := m.Modules.indexByName()
+	assert.Len(t, mods, 2)
+	assert.Equal(t, ReasonContent, mods["app-b"].Reason().Kind)
+	assert.Equal(t, []string{"app-b/main.go"}, mods["app-b"].Reason().Files)
+	assert.Equal(t, ReasonContent, mods["app-c"].Reason().Kind)
+	assert.Equal(t, "files changed in module: app-b/main.go", mods["app-b"].Reason().String())
+}
+
+func TestGlobFileDependenciesAreCaseSensitiveInDiffs(t *testing.T) {
+	repo := NewMemoryRepo(".tmp/repo")
+	repo.WriteFile("app-a/.mbt.yml", "name: app-a\nfileDependencies: [shared/**/*.proto]\n")
+	repo.WriteFile("shared/a/foo.proto", "a")
+	first, err := repo.Commit("first")
+	check(t, err)
+
+	repo.WriteFile("Shared/a/foo.proto", "b")
+	second, err := repo.Commit("second")
+	check(t, err)
+
+	system := NewSystemWith(repo)
+	m, err := system.ManifestByDiff(first.ID(), second.ID())
+	check(t, err)
+	assert.Len(t, m.Modules, 0)
+
+	repo.WriteFile("shared/a/foo.proto", "c")
+	third, err := repo.Commit("third")
+	check(t, err)
+
+	m, err = system.ManifestByDiff(second.ID(), third.ID())
+	check(t, err)
+	assert.Len(t, m.Modules, 1)
+	assert.Equal(t, "app-a", m.Modules[0].Name())
+}
+
+func TestPathsAndGlobsInFileDependencies(t *testing.T) {
+	repo := NewMemoryRepo(".tmp/repo")
+	repo.WriteFile("app-a/.mbt.yml", "name: app-a\nfileDependencies: [shared, 'proto/*.proto']\n")
+	repo.WriteFile("shared/config.yml", "a")
+	repo.WriteFile("proto/a.proto", "a")
+	first, err := repo.Commit("first")
+	check(t, err)
+
+	system := NewSystemWith(repo)
+	m, err := system.ManifestByCommit(first.ID())
+	check(t, err)
+
+	a := m.Modules[0]
+	hashes := a.metadata.dependentFileHashes
+	assert.Len(t, hashes, 2)
+	assert.Contains(t, hashes, "shared")
+	assert.Contains(t, hashes, "proto/a.proto")
+
+	// Paths are matched case insensitively in diffs regardless of the
+	// patterns in the same list
+	repo.WriteFile("Shared/other.yml", "b")
+	second, err := repo.Commit("second")
+	check(t, err)
+
+	m, err = system.ManifestByDiff(first.ID(), second.ID())
+	check(t, err)
+	assert.Equal(t, []string{"app-a"}, m.Modules.names())
+	assert.Equal(t, &Reason{Kind: ReasonFileDependency, Files: []string{"Shared/other.yml"}}, m.Modules[0].Reason())
+
+	repo.WriteFile("shared/config.yml", "b")
+	third, err := repo.Commit("third")
+	check(t, err)
+
+	m, err = system.ManifestByCommit(third.ID())
+	check(t, err)
+	assert.NotEqual(t, a.Version(), m.Modules[0].Version())
+
+	// Paths that do not exist are reported in workspace as well
+	repo.RemoveFile("shared/config.yml")
+	_, err = system.ManifestByWorkspace()
+	assert.EqualError(t, err, fmt.Sprintf(msgFileDependencyNotFound, "shared", "app-a", "app-a"))
+}
+
+func TestModeChangeVersionsModulesWithIgnore(t *testing.T) {
+	repo := NewMemoryRepo(".tmp/repo")
+	repo.WriteFile("app-a/.mbt.yml", "name: app-a\nignore: ['*.md']\n")
+	repo.WriteFile("app-a/build.sh", "echo")
+	first, err := repo.Commit("first")
+	check(t, err)
+
+	repo.WriteFileWithMode("app-a/build.sh", "echo", 0755)
+	second, err := repo.Commit("second")
+	check(t, err)
+
+	system := NewSystemWith(repo)
+	m1, err := system.ManifestByCommit(first.ID())
+	check(t, err)
+	m2, err := system.ManifestByCommit(second.ID())
+	check(t, err)
+	assert.NotEqual(t, m1.Modules[0].Version(), m2.Modules[0].Version())
+
+	w, err := system.ManifestByWorkspace()
+	check(t, err)
+	assert.Equal(t, m2.Modules[0].Version(), w.Modules[0].Version())
+}
+
+func TestDependencyReasonString(t *testing.T) {
+	r := &Reason{Kind: ReasonDependency, Chain: []string{"billing", "common", "proto"}}
+
+	assert.Equal(t, "dependency changed: billing -> common -> proto", r.String())
+}
+
+func TestWorkspaceVersionOfUnmodifiedModules(t *testing.T) {
+	repo := NewMemoryRepo(".tmp/repo")
+	repo.WriteFile(".mbt.yml", "name: root\n")
+	repo.WriteFile("app-a/.mbt.yml", "name: app-a\nignore: ['*.md']\n")
+	repo.WriteFile("app-b/.mbt.yml", "name: app-b\ndependencies: [app-a]\nfileDependencies: [shared/file]\n")
+	repo.WriteFile("app-c/.mbt.yml", "name: app-c\nfileDependencies: ['shared/*.proto']\n")
+	repo.WriteFile("shared/file", "a")
+	repo.WriteFile("shared/a.proto", "a")
+	_, err := repo.Commit("first")
+	check(t, err)
+
+	system := NewSystemWith(repo)
+	head, err := system.ManifestByCurrentBranch()
+	check(t, err)
+
+	m, err := system.ManifestByWorkspace()
+	check(t, err)
+	assert.Equal(t, WorkspaceSha, m.Sha)
+	assert.Equal(t, head.Modules.names(), m.Modules.names())
+	for i, mod := range m.Modules {
+		assert.Equal(t, head.Modules[i].Version(), mod.Version(), mod.Name())
+	}
+
+	m, err = system.ManifestByWorkspaceChanges()
+	check(t, err)
+	assert.Len(t, m.Modules, 0)
+}
+
+func TestWorkspaceVersionOfModifiedModules(t *testing.T) {
+	repo := NewMemoryRepo(".tmp/repo")
+	repo.WriteFile("app-a/.mbt.yml", "name: app-a\nignore: ['*.md']\n")
+	repo.WriteFile("app-b/.mbt.yml", "name: app-b\ndependencies: [app-a]\nfileDependencies: [shared/file]\n")
+	repo.WriteFile("app-c/.mbt.yml", "name: app-c\nfileDependencies: ['shared/*.proto']\n")
+	repo.WriteFile("shared/file", "a")
+	_, err := repo.Commit("first")
+	check(t, err)
+
+	system := NewSystemWith(repo)
+	head, err := system.ManifestByCurrentBranch()
+	check(t, err)
+	versions := make(map[string]string)
+	for _, mod := range head.Modules {
+		versions[mod.Name()] = mod.Version()
+	}
+
+	// Ignored files do not change the version
+	repo.WriteFile("app-a/README.md", "docs")
+	m, err := system.ManifestByWorkspace()
+	check(t, err)
+	for _, mod := range m.Modules {
+		assert.Equal(t, versions[mod.Name()], mod.Version(), mod.Name())
+	}
+
+	repo.WriteFile("shared/file", "b")
+	repo.WriteFile("shared/b.proto", "b")
+	m, err = system.ManifestByWorkspace()
+	check(t, err)
+	mods := m.Modules.indexByName()
+	assert.Equal(t, versions["app-a"], mods["app-a"].Version())
+	assert.NotEqual(t, versions["app-b"], mods["app-b"].Version())
+	assert.NotEqual(t, versions["app-c"], mods["app-c"].Version())
+
+	repo.RemoveFile("shared/file")
+	_, err = system.ManifestByWorkspace()
+	assert.EqualError(t, err, fmt.Sprintf(msgFileDependencyNotFound, "shared/file", "app-b", "app-b"))
+}
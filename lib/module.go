@@ -16,6 +16,10 @@ limitations under the License.
 package lib
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+
 	"github.com/mbtproject/mbt/e"
 	"github.com/mbtproject/mbt/graph"
 )
@@ -25,6 +29,12 @@ func (a *Module) Name() string {
 	return a.metadata.spec.Name
 }
 
+// Kind returns the kind of this module (empty if the module does
+// not specify one).
+func (a *Module) Kind() string {
+	return a.metadata.spec.Kind
+}
+
 // Path returns the relative path to module.
 func (a *Module) Path() string {
 	return a.metadata.dir
@@ -55,6 +65,28 @@ func (a *Module) RequiredBy() Modules {
 	return a.requiredBy
 }
 
+// Reason returns the reason for including this module in a manifest
+// created for a diff. Returns nil if the manifest is not based on a diff.
+func (a *Module) Reason() *Reason {
+	return a.reason
+}
+
+// String returns a human readable description of the reason.
+func (r *Reason) String() string {
+	switch r.Kind {
+	case ReasonContent:
+		return fmt.Sprintf("files changed in module: %s", strings.Join(r.Files, ", "))
+	case ReasonFileDependency:
+		return fmt.Sprintf("file dependencies changed: %s", strings.Join(r.Files, ", "))
+	case ReasonDefaults:
+		return fmt.Sprintf("repository defaults changed: %s", strings.Join(r.Files, ", "))
+	case ReasonDependency:
+		return fmt.Sprintf("dependency changed: %s", strings.Join(r.Chain, " -> "))
+	default:
+		return string(r.Kind)
+	}
+}
+
 // Version returns the content based version SHA for the module.
 func (a *Module) Version() string {
 	return a.version
@@ -70,6 +102,19 @@ func (a *Module) FileDependencies() []string {
 	return a.metadata.spec.FileDependencies
 }
 
+// Ignore returns the list of gitignore style patterns matching the
+// files that do not impact this module.
+// Patterns are relative to the module directory.
+func (a *Module) Ignore() []string {
+	return a.metadata.spec.Ignore
+}
+
+// Artifacts returns the list of glob patterns matching the build outputs
+// of this module. Patterns are relative to the module directory.
+func (a *Module) Artifacts() []string {
+	return a.metadata.spec.Artifacts
+}
+
 type requiredByNodeProvider struct{}
 
 func (p *requiredByNodeProvider) ID(vertex interface{}) interface{} {
@@ -132,6 +177,42 @@ func (l Modules) indexByPath() map[string]*Module {
 	return q
 }
 
+func (l Modules) names() []string {
+	q := make([]string, 0, len(l))
+	for _, a := range l {
+		q = append(q, a.Name())
+	}
+	return q
+}
+
+// GroupByKind returns the modules grouped by their kind.
+// Groups are sorted by kind with the modules without a kind
+// in the last group. Order of the modules is preserved within
+// each group.
+func (l Modules) GroupByKind() []*KindGroup {
+	groups := make([]*KindGroup, 0)
+	index := make(map[string]*KindGroup)
+	for _, a := range l {
+		g, ok := index[a.Kind()]
+		if !ok {
+			g = &KindGroup{Kind: a.Kind(), Modules: Modules{}}
+			index[a.Kind()] = g
+			groups = append(groups, g)
+		}
+		g.Modules = append(g.Modules, a)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		a, b := groups[i].Kind, groups[j].Kind
+		if a == "" || b == "" {
+			return b == "" && a != ""
+		}
+		return a < b
+	})
+
+	return groups
+}
+
 // expandRequiredByDependencies takes a list of Modules and
 // returns a new list of Modules including the ones in their
 // requiredBy (see below) dependency chain.
@@ -163,6 +244,33 @@ func (l Modules) expandRequiredByDependencies() (Modules, error) {
 		i--
 	}
 
+	// Step 4
+	// Explain the inclusion of modules added due to
+	// their dependencies.
+	// Modules are in topological order, therefore, the reasons of
+	// the dependencies are already known when we visit a module.
+	for _, m := range r {
+		if m.reason != nil {
+			continue
+		}
+
+		// Use the shortest chain to a changed module
+		for _, d := range m.Requires() {
+			if d.reason == nil {
+				continue
+			}
+
+			chain := []string{m.Name(), d.Name()}
+			if d.reason.Kind == ReasonDependency {
+				chain = append([]string{m.Name()}, d.reason.Chain...)
+			}
+
+			if m.reason == nil || len(chain) < len(m.reason.Chain) {
+				m.reason = &Reason{Kind: ReasonDependency, Chain: chain}
+			}
+		}
+	}
+
 	return r, nil
 }
 
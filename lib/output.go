@@ -0,0 +1,240 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mbtproject/mbt/e"
+)
+
+// prefixColors is the palette used to colour the module name prefixes.
+var prefixColors = []string{
+	"\x1b[36m", "\x1b[33m", "\x1b[32m", "\x1b[35m", "\x1b[34m",
+	"\x1b[96m", "\x1b[93m", "\x1b[92m", "\x1b[95m", "\x1b[94m",
+}
+
+const colorReset = "\x1b[0m"
+
+// moduleOutput contains the writers used for the output streams
+// of a module command.
+// Depending on CmdOptions, output lines are prefixed with the module name
+// and/or written to a log file in CmdOptions.LogDir.
+type moduleOutput struct {
+	Stdout, Stderr io.Writer
+	prefixWriters  []*prefixWriter
+	log            *os.File
+}
+
+func newModuleOutput(m *Manifest, mod *Module, options *CmdOptions, command string, args ...string) (*moduleOutput, error) {
+	o := &moduleOutput{Stdout: options.Stdout, Stderr: options.Stderr}
+	shared := sameWriter(options.Stdout, options.Stderr)
+
+	if options.PrefixOutput {
+		prefix := modulePrefix(m, mod, options.ColorOutput)
+		o.Stdout = o.prefix(prefix, options.Stdout)
+		if shared {
+			o.Stderr = o.Stdout
+		} else {
+			o.Stderr = o.prefix(prefix, options.Stderr)
+		}
+	}
+
+	if options.LogDir != "" {
+		log, err := openModuleLog(options.LogDir, mod, command, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		o.log = log
+		o.Stdout = teeWriter(o.Stdout, log)
+		if shared {
+			o.Stderr = o.Stdout
+		} else {
+			o.Stderr = teeWriter(o.Stderr, log)
+		}
+	}
+
+	if options.stdoutTail != nil {
+		// Writes to stdout and stderr happen concurrently once they are
+		// separated. Therefore, a shared writer must be synchronised.
+		if shared {
+			o.Stdout = &syncWriter{mu: &sync.Mutex{}, w: o.Stdout}
+			o.Stderr = o.Stdout
+		}
+
+		o.Stdout = teeWriter(o.Stdout, options.stdoutTail)
+		o.Stderr = teeWriter(o.Stderr, options.stderrTail)
+	}
+
+	return o, nil
+}
+
+func (o *moduleOutput) prefix(prefix string, w io.Writer) io.Writer {
+	if w == nil {
+		return nil
+	}
+
+	p := &prefixWriter{prefix: []byte(prefix), w: w}
+	o.prefixWriters = append(o.prefixWriters, p)
+	return p
+}
+
+// Close flushes the incomplete lines and closes the log file.
+func (o *moduleOutput) Close() error {
+	var err error
+	for _, p := range o.prefixWriters {
+		if ferr := p.Flush(); err == nil {
+			err = ferr
+		}
+	}
+
+	if o.log != nil {
+		if cerr := o.log.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// modulePrefix returns the prefix used for the output lines of mod.
+// Prefixes are padded to the length of the longest module name in the
+// manifest so that the output is aligned.
+func modulePrefix(m *Manifest, mod *Module, color bool) string {
+	width := 0
+	for _, a := range m.Modules {
+		if len(a.Name()) > width {
+			width = len(a.Name())
+		}
+	}
+
+	prefix := fmt.Sprintf("%-*s | ", width, mod.Name())
+	if !color {
+		return prefix
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(mod.Name()))
+	return prefixColors[h.Sum32()%uint32(len(prefixColors))] + prefix + colorReset
+}
+
+// openModuleLog opens the log file of mod in dir for appending and
+// writes a header describing the command being executed.
+func openModuleLog(dir string, mod *Module, command string, args ...string) (*os.File, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, e.Wrapf(ErrClassUser, err, msgFailedOpenModuleLog, mod.Name())
+	}
+
+	name := strings.NewReplacer("/", "_", "\\", "_").Replace(mod.Name()) + ".log"
+	f, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, e.Wrapf(ErrClassUser, err, msgFailedOpenModuleLog, mod.Name())
+	}
+
+	_, err = fmt.Fprintf(f, "==> %s (%s)\n", strings.Join(append([]string{command}, args...), " "), time.Now().Format(time.RFC3339))
+	if err != nil {
+		f.Close()
+		return nil, e.Wrapf(ErrClassUser, err, msgFailedOpenModuleLog, mod.Name())
+	}
+
+	return f, nil
+}
+
+// prefixWriter writes each line written to it with a prefix.
+// Incomplete lines are buffered until they are completed or flushed,
+// so that lines from concurrent commands are not mixed up.
+type prefixWriter struct {
+	mu     sync.Mutex
+	prefix []byte
+	w      io.Writer
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.buf = append(p.buf, b...)
+	var out []byte
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		out = append(out, p.prefix...)
+		out = append(out, p.buf[:i+1]...)
+		p.buf = p.buf[i+1:]
+	}
+
+	if len(out) > 0 {
+		if _, err := p.w.Write(out); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+// Flush writes the buffered incomplete line (if any).
+func (p *prefixWriter) Flush() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.buf) == 0 {
+		return nil
+	}
+
+	out := append(append(append([]byte{}, p.prefix...), p.buf...), '\n')
+	p.buf = nil
+	_, err := p.w.Write(out)
+	return err
+}
+
+// teeWriter returns a writer that duplicates its writes to w and tee.
+func teeWriter(w io.Writer, tee io.Writer) io.Writer {
+	if w == nil {
+		return tee
+	}
+
+	return io.MultiWriter(w, tee)
+}
+
+// sameWriter returns true if a and b are the same non-nil writer.
+func sameWriter(a, b io.Writer) (same bool) {
+	if a == nil || b == nil {
+		return false
+	}
+
+	// Comparing interfaces holding non-comparable values panics.
+	defer func() {
+		if recover() != nil {
+			same = false
+		}
+	}()
+
+	return a == b
+}
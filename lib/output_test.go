@@ -0,0 +1,103 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testOutputManifest() (*Manifest, *Module) {
+	appA := newModule(newModuleMetadata("app-a", "abc", &Spec{Name: "app-a"}, nil), nil)
+	libLong := newModule(newModuleMetadata("lib-long", "abc", &Spec{Name: "lib-long"}, nil), nil)
+	return &Manifest{Modules: Modules{appA, libLong}}, appA
+}
+
+func TestPrefixWriter(t *testing.T) {
+	buff := new(bytes.Buffer)
+	w := &prefixWriter{prefix: []byte("a | "), w: buff}
+
+	w.Write([]byte("hello"))
+	assert.Equal(t, "", buff.String())
+
+	w.Write([]byte(" world\nfoo\nba"))
+	assert.Equal(t, "a | hello world\na | foo\n", buff.String())
+
+	check(t, w.Flush())
+	assert.Equal(t, "a | hello world\na | foo\na | ba\n", buff.String())
+
+	check(t, w.Flush())
+	assert.Equal(t, "a | hello world\na | foo\na | ba\n", buff.String())
+}
+
+func TestModulePrefix(t *testing.T) {
+	m, appA := testOutputManifest()
+
+	assert.Equal(t, "app-a    | ", modulePrefix(m, appA, false))
+
+	colored := modulePrefix(m, appA, true)
+	assert.True(t, strings.HasPrefix(colored, "\x1b["))
+	assert.True(t, strings.HasSuffix(colored, "app-a    | "+colorReset))
+	assert.Equal(t, colored, modulePrefix(m, appA, true))
+}
+
+func TestModuleOutput(t *testing.T) {
+	clean()
+	m, appA := testOutputManifest()
+	buff := new(bytes.Buffer)
+	options := &CmdOptions{Stdout: buff, Stderr: buff, PrefixOutput: true, LogDir: ".tmp/logs"}
+
+	o, err := newModuleOutput(m, appA, options, "./build.sh", "--fast")
+	check(t, err)
+	assert.Equal(t, o.Stdout, o.Stderr)
+
+	o.Stdout.Write([]byte("out\n"))
+	o.Stderr.Write([]byte("err"))
+	check(t, o.Close())
+
+	assert.Equal(t, "app-a    | out\napp-a    | err\n", buff.String())
+
+	log, err := ioutil.ReadFile(filepath.Join(".tmp/logs", "app-a.log"))
+	check(t, err)
+	lines := strings.Split(string(log), "\n")
+	assert.True(t, strings.HasPrefix(lines[0], "==> ./build.sh --fast ("))
+	assert.Equal(t, "out", lines[1])
+	assert.Equal(t, "err", lines[2])
+}
+
+func TestModuleOutputTailIsNotPrefixed(t *testing.T) {
+	m, appA := testOutputManifest()
+	buff := new(bytes.Buffer)
+	stdout := &tailBuffer{size: 1024}
+	stderr := &tailBuffer{size: 1024}
+	options := &CmdOptions{Stdout: buff, Stderr: buff, PrefixOutput: true, stdoutTail: stdout, stderrTail: stderr}
+
+	o, err := newModuleOutput(m, appA, options, "./build.sh")
+	check(t, err)
+
+	o.Stdout.Write([]byte("out\n"))
+	o.Stderr.Write([]byte("err\n"))
+	check(t, o.Close())
+
+	assert.Equal(t, "app-a    | out\napp-a    | err\n", buff.String())
+	assert.Equal(t, "out\n", stdout.String())
+	assert.Equal(t, "err\n", stderr.String())
+}
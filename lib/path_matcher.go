@@ -0,0 +1,142 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"regexp"
+	"strings"
+)
+
+// pathMatcher matches repository paths against a list of entries.
+// An entry is an exact path, a directory (matching the files
+// underneath) or a glob pattern. Entries prefixed with ! exclude
+// the paths matched by the other entries.
+type pathMatcher struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// isGlob returns true if the entry is a pattern rather than a path.
+func isGlob(entry string) bool {
+	return strings.HasPrefix(entry, "!") || strings.ContainsAny(entry, "*?[")
+}
+
+// hasGlob returns true if any of the entries is a pattern.
+func hasGlob(entries []string) bool {
+	for _, entry := range entries {
+		if isGlob(entry) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitGlobs separates the paths and the patterns in entries.
+func splitGlobs(entries []string) (paths, globs []string) {
+	for _, entry := range entries {
+		if isGlob(entry) {
+			globs = append(globs, entry)
+		} else {
+			paths = append(paths, entry)
+		}
+	}
+
+	return
+}
+
+// newPathMatcher creates a pathMatcher for the specified entries.
+// Matching is case insensitive when foldCase is set.
+func newPathMatcher(entries []string, foldCase bool) (*pathMatcher, error) {
+	m := &pathMatcher{}
+	for _, entry := range entries {
+		exclude := strings.HasPrefix(entry, "!")
+		re, err := compileGlob(strings.TrimPrefix(entry, "!"), foldCase)
+		if err != nil {
+			return nil, err
+		}
+
+		if exclude {
+			m.exclude = append(m.exclude, re)
+		} else {
+			m.include = append(m.include, re)
+		}
+	}
+
+	return m, nil
+}
+
+// Match returns true if path is matched by any of the entries
+// and not excluded by a negated entry.
+func (m *pathMatcher) Match(path string) bool {
+	return matchAny(m.include, path) && !matchAny(m.exclude, path)
+}
+
+func matchAny(patterns []*regexp.Regexp, path string) bool {
+	for _, p := range patterns {
+		if p.MatchString(path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compileGlob converts a glob pattern to a regular expression.
+// * and ? do not match the directory separator while ** matches
+// any number of directories. A pattern matching a directory also
+// matches the files inside it.
+func compileGlob(pattern string, foldCase bool) (*regexp.Regexp, error) {
+	var b strings.Builder
+	if foldCase {
+		b.WriteString("(?i)")
+	}
+	b.WriteString("^")
+
+	pattern = strings.Trim(pattern, "/")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				b.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	b.WriteString("(?:/.*)?$")
+	return regexp.Compile(b.String())
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathMatcher(t *testing.T) {
+	m, err := newPathMatcher([]string{"shared/proto/**/*.proto", "build.sh", "lib", "!**/*_test.proto"}, false)
+	check(t, err)
+
+	assert.True(t, m.Match("shared/proto/foo.proto"))
+	assert.True(t, m.Match("shared/proto/a/b/foo.proto"))
+	assert.False(t, m.Match("shared/proto/a/foo_test.proto"))
+	assert.False(t, m.Match("shared/proto/a/foo.go"))
+	assert.False(t, m.Match("shared/protos/foo.proto"))
+	assert.True(t, m.Match("build.sh"))
+	assert.False(t, m.Match("build.sh.bak"))
+	assert.True(t, m.Match("lib/a/b"))
+	assert.False(t, m.Match("libs/a"))
+	assert.False(t, m.Match("Build.sh"))
+}
+
+func TestPathMatcherWildcards(t *testing.T) {
+	m, err := newPathMatcher([]string{"dir/*.txt", "file?.[ch]", "x[!a]"}, false)
+	check(t, err)
+
+	assert.True(t, m.Match("dir/a.txt"))
+	assert.False(t, m.Match("dir/sub/a.txt"))
+	assert.True(t, m.Match("file1.c"))
+	assert.False(t, m.Match("file1.go"))
+	assert.True(t, m.Match("xb"))
+	assert.False(t, m.Match("xa"))
+}
+
+func TestPathMatcherWithFoldCase(t *testing.T) {
+	m, err := newPathMatcher([]string{"Shared/**/*.Proto"}, true)
+	check(t, err)
+
+	assert.True(t, m.Match("shared/a/foo.proto"))
+}
+
+func TestIsGlob(t *testing.T) {
+	assert.False(t, isGlob("shared/file"))
+	assert.True(t, isGlob("shared/*"))
+	assert.True(t, isGlob("!shared/file"))
+	assert.True(t, hasGlob([]string{"a", "b/**"}))
+	assert.False(t, hasGlob([]string{"a", "b"}))
+}
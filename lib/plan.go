@@ -0,0 +1,184 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/mbtproject/mbt/e"
+)
+
+// planBuild returns the steps a build would execute for the modules in
+// the manifest.
+func (s *stdSystem) planBuild(m *Manifest, options *CmdOptions) *Plan {
+	plan := &Plan{Command: buildCommand, Manifest: m, Steps: make([]*PlanStep, 0, len(m.Modules))}
+	for _, a := range m.Modules {
+		cmd, ok := s.canBuildHere(a)
+		switch {
+		case !ok:
+			plan.Steps = append(plan.Steps, &PlanStep{Module: a, Action: PlanActionSkip, SkipReason: buildSkipReason(a)})
+		case s.hasCachedBuild(a, options):
+			plan.Steps = append(plan.Steps, &PlanStep{Module: a, Action: PlanActionCached})
+		default:
+			plan.Steps = append(plan.Steps, newRunStep(m, a, cmd.Cmd, cmd.Args, cmd.Timeout, cmd.Retries))
+		}
+	}
+
+	return plan
+}
+
+// planRun returns the steps running a user defined command would
+// execute for the modules in the manifest.
+func (s *stdSystem) planRun(command string, m *Manifest) *Plan {
+	plan := &Plan{Command: command, Manifest: m, Steps: make([]*PlanStep, 0, len(m.Modules))}
+	for _, a := range m.Modules {
+		cmd, ok := s.canRunHere(command, a)
+		if !ok {
+			plan.Steps = append(plan.Steps, &PlanStep{Module: a, Action: PlanActionSkip, SkipReason: runSkipReason(command, a)})
+			continue
+		}
+
+		plan.Steps = append(plan.Steps, newRunStep(m, a, cmd.Cmd, cmd.Args, cmd.Timeout, cmd.Retries))
+	}
+
+	return plan
+}
+
+func newRunStep(m *Manifest, mod *Module, cmd string, args []string, timeout time.Duration, retries int) *PlanStep {
+	return &PlanStep{
+		Module:  mod,
+		Action:  PlanActionRun,
+		Cmd:     cmd,
+		Args:    args,
+		Dir:     path.Join(m.Dir, mod.Path()),
+		Env:     moduleEnvironment(m, mod),
+		Timeout: timeout,
+		Retries: retries,
+	}
+}
+
+// hasCachedBuild returns true if the build cache contains a successful
+// build of the module's current version. Unlike isCached, artifacts are
+// not restored, therefore, it is also used in dry runs.
+func (s *stdSystem) hasCachedBuild(mod *Module, options *CmdOptions) bool {
+	if options.Cache == nil {
+		return false
+	}
+
+	ok, err := options.Cache.Has(mod.Name(), cacheVersion(mod))
+	if err != nil {
+		s.Log.Warnf(msgCacheLookupFailed, mod.Name(), err)
+		return false
+	}
+
+	return ok
+}
+
+// WritePlan writes a human readable description of a plan.
+func WritePlan(w io.Writer, plan *Plan) error {
+	b := new(strings.Builder)
+	fmt.Fprintf(b, "Plan for %s at %s (%v modules)\n", plan.Command, plan.Manifest.Sha, len(plan.Steps))
+	for i, step := range plan.Steps {
+		fmt.Fprintf(b, "\n%v. %s (path: %s version: %s)\n", i+1, step.Module.Name(), step.Module.Path(), step.Module.Version())
+		switch step.Action {
+		case PlanActionSkip:
+			fmt.Fprintf(b, "   skip: %s\n", step.SkipReason)
+		case PlanActionCached:
+			fmt.Fprintf(b, "   cached\n")
+		default:
+			fmt.Fprintf(b, "   run: %s\n", strings.Join(append([]string{step.Cmd}, step.Args...), " "))
+			fmt.Fprintf(b, "   dir: %s\n", step.Dir)
+			if step.Timeout > 0 {
+				fmt.Fprintf(b, "   timeout: %v\n", step.Timeout)
+			}
+			if step.Retries > 0 {
+				fmt.Fprintf(b, "   retries: %v\n", step.Retries)
+			}
+			fmt.Fprintf(b, "   env:\n")
+			for _, v := range step.Env {
+				fmt.Fprintf(b, "     %s\n", v)
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	if err != nil {
+		return e.Wrap(ErrClassInternal, err)
+	}
+
+	return nil
+}
+
+type jsonPlan struct {
+	Command string          `json:"command"`
+	Sha     string          `json:"sha"`
+	Dir     string          `json:"dir"`
+	Steps   []*jsonPlanStep `json:"steps"`
+}
+
+type jsonPlanStep struct {
+	Module     string     `json:"module"`
+	Path       string     `json:"path"`
+	Version    string     `json:"version"`
+	Action     PlanAction `json:"action"`
+	SkipReason SkipReason `json:"skipReason,omitempty"`
+	Cmd        string     `json:"cmd,omitempty"`
+	Args       []string   `json:"args,omitempty"`
+	Dir        string     `json:"dir,omitempty"`
+	Env        []string   `json:"env,omitempty"`
+	TimeoutMs  int64      `json:"timeoutMs,omitempty"`
+	Retries    int        `json:"retries,omitempty"`
+}
+
+// WriteJSONPlan writes a plan in json format.
+func WriteJSONPlan(w io.Writer, plan *Plan) error {
+	p := &jsonPlan{
+		Command: plan.Command,
+		Sha:     plan.Manifest.Sha,
+		Dir:     plan.Manifest.Dir,
+		Steps:   make([]*jsonPlanStep, 0, len(plan.Steps)),
+	}
+
+	for _, step := range plan.Steps {
+		p.Steps = append(p.Steps, &jsonPlanStep{
+			Module:     step.Module.Name(),
+			Path:       step.Module.Path(),
+			Version:    step.Module.Version(),
+			Action:     step.Action,
+			SkipReason: step.SkipReason,
+			Cmd:        step.Cmd,
+			Args:       step.Args,
+			Dir:        step.Dir,
+			Env:        step.Env,
+			TimeoutMs:  int64(step.Timeout / time.Millisecond),
+			Retries:    step.Retries,
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(p)
+	if err != nil {
+		return e.Wrap(ErrClassInternal, err)
+	}
+
+	return nil
+}
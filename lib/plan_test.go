@@ -0,0 +1,88 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testPlan() *Plan {
+	mod := func(name string) *Module {
+		m := newModule(newModuleMetadata(name, "abc", &Spec{Name: name, Properties: map[string]interface{}{"b": "2", "a": "1"}}, nil), nil)
+		m.version = "v-" + name
+		return m
+	}
+
+	m := &Manifest{Dir: "/repo", Sha: "sha"}
+	appA, appB := mod("app-a"), mod("app-b")
+	return &Plan{
+		Command:  "build",
+		Manifest: m,
+		Steps: []*PlanStep{
+			newRunStep(m, appA, "make", []string{"all"}, time.Second, 1),
+			{Module: appB, Action: PlanActionSkip, SkipReason: SkipReasonUnsupportedOS},
+		},
+	}
+}
+
+func TestModuleEnvironment(t *testing.T) {
+	plan := testPlan()
+	assert.Equal(t, []string{
+		"MBT_BUILD_COMMIT=sha",
+		"MBT_MODULE_VERSION=v-app-a",
+		"MBT_MODULE_NAME=app-a",
+		"MBT_MODULE_PATH=app-a",
+		"MBT_REPO_PATH=/repo",
+		"MBT_MODULE_PROPERTY_A=1",
+		"MBT_MODULE_PROPERTY_B=2",
+	}, plan.Steps[0].Env)
+}
+
+func TestWritePlan(t *testing.T) {
+	buff := new(bytes.Buffer)
+	check(t, WritePlan(buff, testPlan()))
+
+	out := buff.String()
+	assert.Contains(t, out, "Plan for build at sha (2 modules)")
+	assert.Contains(t, out, "run: make all")
+	assert.Contains(t, out, "timeout: 1s")
+	assert.Contains(t, out, "retries: 1")
+	assert.Contains(t, out, "skip: unsupported_os")
+}
+
+func TestJSONPlan(t *testing.T) {
+	buff := new(bytes.Buffer)
+	check(t, WriteJSONPlan(buff, testPlan()))
+
+	plan := &jsonPlan{}
+	check(t, json.Unmarshal(buff.Bytes(), plan))
+
+	assert.Equal(t, "build", plan.Command)
+	assert.Equal(t, "sha", plan.Sha)
+	assert.Len(t, plan.Steps, 2)
+	assert.Equal(t, "app-a", plan.Steps[0].Module)
+	assert.Equal(t, PlanActionRun, plan.Steps[0].Action)
+	assert.Equal(t, "/repo/app-a", plan.Steps[0].Dir)
+	assert.Equal(t, int64(1000), plan.Steps[0].TimeoutMs)
+	assert.Equal(t, PlanActionSkip, plan.Steps[1].Action)
+	assert.Equal(t, SkipReasonUnsupportedOS, plan.Steps[1].SkipReason)
+	assert.Empty(t, plan.Steps[1].Env)
+}
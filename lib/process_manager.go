@@ -16,29 +16,91 @@ limitations under the License.
 package lib
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path"
+	"sort"
 	"strings"
+	"time"
 )
 
+// killGracePeriod is the time given to a process group to exit
+// after being signalled, before it is killed.
+const killGracePeriod = 10 * time.Second
+
 type stdProcessManager struct {
 	Log Log
 }
 
-func (p *stdProcessManager) Exec(manifest *Manifest, module *Module, options *CmdOptions, command string, args ...string) error {
+func (p *stdProcessManager) Exec(ctx context.Context, manifest *Manifest, module *Module, options *CmdOptions, command string, args ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	output, err := newModuleOutput(manifest, module, options, command, args...)
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+
 	cmd := exec.Command(command)
-	cmd.Env = append(os.Environ(), p.setupModBuildEnvironment(manifest, module)...)
+	cmd.Env = append(os.Environ(), moduleEnvironment(manifest, module)...)
 	cmd.Dir = path.Join(manifest.Dir, module.Path())
 	cmd.Stdin = options.Stdin
-	cmd.Stdout = options.Stdout
-	cmd.Stderr = options.Stderr
+	cmd.Stdout = output.Stdout
+	cmd.Stderr = output.Stderr
 	cmd.Args = append(cmd.Args, args...)
-	return cmd.Run()
+	group := setProcessGroup(cmd)
+
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	go p.stopOnCancel(ctx, cmd, group, module, done)
+	err = cmd.Wait()
+	close(done)
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
+
+// stopOnCancel signals the process group of cmd (or cmd alone when it
+// is not in its own group) when ctx is done.
+// The signal received by mbt (if any) is forwarded, otherwise the
+// process group is terminated. Processes still running after
+// killGracePeriod are killed.
+func (p *stdProcessManager) stopOnCancel(ctx context.Context, cmd *exec.Cmd, group bool, module *Module, done chan struct{}) {
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+	}
+
+	sig := signalFromContext(ctx)
+	p.Log.Debug("Sending %v to %s (pid %v)", sig, module.Name(), cmd.Process.Pid)
+	err := signalProcessGroup(cmd.Process, group, sig)
+	if err != nil {
+		p.Log.Debug("Failed to signal %s: %v", module.Name(), err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(killGracePeriod):
+		p.Log.Warnf(msgKillingProcess, module.Name(), killGracePeriod)
+		killProcessGroup(cmd.Process, group)
+	}
 }
 
-func (p *stdProcessManager) setupModBuildEnvironment(manifest *Manifest, mod *Module) []string {
+// moduleEnvironment returns the environment variables set for the
+// commands executed in a module.
+func moduleEnvironment(manifest *Manifest, mod *Module) []string {
 	r := []string{
 		fmt.Sprintf("MBT_BUILD_COMMIT=%s", manifest.Sha),
 		fmt.Sprintf("MBT_MODULE_VERSION=%s", mod.Version()),
@@ -47,8 +109,14 @@ func (p *stdProcessManager) setupModBuildEnvironment(manifest *Manifest, mod *Mo
 		fmt.Sprintf("MBT_REPO_PATH=%s", manifest.Dir),
 	}
 
-	for k, v := range mod.Properties() {
-		if value, ok := v.(string); ok {
+	keys := make([]string, 0, len(mod.Properties()))
+	for k := range mod.Properties() {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if value, ok := mod.Properties()[k].(string); ok {
 			r = append(r, fmt.Sprintf("MBT_MODULE_PROPERTY_%s=%s", strings.ToUpper(k), value))
 		}
 	}
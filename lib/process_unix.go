@@ -0,0 +1,75 @@
+//go:build !windows
+// +build !windows
+
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup places cmd in a new process group so that signals
+// reach its child processes as well. Commands reading from a terminal
+// are kept in the foreground process group because background processes
+// are stopped (SIGTTIN) when they read from it. In that case, signals are
+// only forwarded to the command itself.
+// Returns true if cmd is placed in a new process group.
+func setProcessGroup(cmd *exec.Cmd) bool {
+	if isTerminal(cmd.Stdin) {
+		return false
+	}
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return true
+}
+
+// signalProcessGroup sends sig to the process group led by p or
+// just p if it is not in its own group.
+// Process group is terminated if sig is nil.
+func signalProcessGroup(p *os.Process, group bool, sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		s = syscall.SIGTERM
+	}
+
+	if !group {
+		return p.Signal(s)
+	}
+
+	return syscall.Kill(-p.Pid, s)
+}
+
+func killProcessGroup(p *os.Process, group bool) error {
+	if !group {
+		return p.Kill()
+	}
+
+	return syscall.Kill(-p.Pid, syscall.SIGKILL)
+}
+
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/mbtproject/mbt/e"
 	"github.com/mbtproject/mbt/trie"
 )
 
@@ -35,45 +36,176 @@ func (r *stdReducer) Reduce(modules Modules, deltas []*DiffDelta) (Modules, erro
 	t := trie.NewTrie()
 	filtered := make(Modules, 0)
 	for _, d := range deltas {
-		// Current comparison is case insensitive. This is problematic
-		// for case sensitive file systems.
-		// Perhaps we can read core.ignorecase configuration value
-		// in git and adjust accordingly.
-		nfp := strings.ToLower(d.NewFile)
-		r.Log.Debug("Index change %s", nfp)
-		t.Add(nfp, nfp)
+		// Both sides of the delta are indexed so that a file moved
+		// or deleted from a module impacts that module as well.
+		for _, p := range d.paths() {
+			// Current comparison is case insensitive. This is problematic
+			// for case sensitive file systems.
+			// Perhaps we can read core.ignorecase configuration value
+			// in git and adjust accordingly.
+			fp := strings.ToLower(p)
+			r.Log.Debug("Index change %s", fp)
+			t.Add(fp, fp)
+		}
 	}
 
 	for _, m := range modules {
-		mp := m.Path()
-
-		if mp == "" {
-			// Fast path for the root module if there's one.
-			// Root module should match any change.
-			if len(deltas) > 0 {
-				filtered = append(filtered, m)
-			}
+		if r.impactedByContent(m, t, deltas) {
+			m.reason = &Reason{Kind: ReasonContent, Files: changedFiles(deltas, contentMatcher(m))}
+			filtered = append(filtered, m)
 			continue
 		}
 
-		// Append / to the end of module path to make sure
-		// we restrict the search exactly for that path.
-		// for example, change in path a/bb should not
-		// match a module in a/b
-		mp = strings.ToLower(fmt.Sprintf("%s/", m.Path()))
-		r.Log.Debug("Filter by module path %s", mp)
-		if t.ContainsPrefix(mp) {
-			filtered = append(filtered, m)
-		} else {
-			for _, p := range m.FileDependencies() {
-				fdp := strings.ToLower(p)
-				r.Log.Debug("Filter by file dependency path %s", fdp)
-				if t.ContainsPrefix(fdp) {
-					filtered = append(filtered, m)
-				}
+		impacted, err := r.impactedByFileDependencies(m, t, deltas)
+		if err != nil {
+			return nil, err
+		}
+
+		if impacted {
+			match, err := fileDependencyMatcher(m)
+			if err != nil {
+				return nil, err
 			}
+
+			m.reason = &Reason{Kind: ReasonFileDependency, Files: changedFiles(deltas, match)}
+			filtered = append(filtered, m)
 		}
 	}
 
 	return filtered, nil
 }
+
+// impactedByContent checks whether any of the deltas modify
+// the files within the specified module.
+func (r *stdReducer) impactedByContent(m *Module, t *trie.Trie, deltas []*DiffDelta) bool {
+	if len(m.Ignore()) > 0 {
+		r.Log.Debug("Filter by module path %s ignoring %v", m.Path(), m.Ignore())
+		return len(changedFiles(deltas, contentMatcher(m))) > 0
+	}
+
+	if m.Path() == "" {
+		// Fast path for the root module if there's one.
+		// Root module should match any change.
+		return len(deltas) > 0
+	}
+
+	mp := modulePathPrefix(m)
+	r.Log.Debug("Filter by module path %s", mp)
+	return t.ContainsPrefix(mp)
+}
+
+// impactedByFileDependencies checks whether any of the deltas
+// match the file dependencies of the specified module.
+func (r *stdReducer) impactedByFileDependencies(m *Module, t *trie.Trie, deltas []*DiffDelta) (bool, error) {
+	paths, globs := splitGlobs(m.FileDependencies())
+	for _, p := range paths {
+		fdp := strings.ToLower(p)
+		r.Log.Debug("Filter by file dependency path %s", fdp)
+		if t.ContainsPrefix(fdp) {
+			return true, nil
+		}
+	}
+
+	if len(globs) == 0 {
+		return false, nil
+	}
+
+	r.Log.Debug("Filter by file dependency patterns %v", globs)
+	match, err := fileDependencyMatcher(m)
+	if err != nil {
+		return false, err
+	}
+
+	return len(changedFiles(deltas, match)) > 0, nil
+}
+
+// modulePathPrefix returns the lower case prefix of the paths
+// within a module.
+func modulePathPrefix(m *Module) string {
+	if m.Path() == "" {
+		return ""
+	}
+
+	// Append / to the end of module path to make sure
+	// we restrict the search exactly for that path.
+	// for example, change in path a/bb should not
+	// match a module in a/b
+	return strings.ToLower(fmt.Sprintf("%s/", m.Path()))
+}
+
+// contentMatcher returns a function matching the paths of the files
+// that are part of the module content.
+func contentMatcher(m *Module) func(string) bool {
+	mp := modulePathPrefix(m)
+	var ignore *ignoreMatcher
+	if len(m.Ignore()) > 0 {
+		ignore = newIgnoreMatcher(m.Ignore())
+	}
+
+	return func(p string) bool {
+		if !strings.HasPrefix(strings.ToLower(p), mp) {
+			return false
+		}
+
+		return ignore == nil || !ignore.Match(p[len(mp):])
+	}
+}
+
+// fileDependencyMatcher returns a function matching the paths of
+// the files the module has a file dependency on.
+// Paths are matched by prefix (case insensitive) and glob patterns
+// are matched independently (case sensitive).
+func fileDependencyMatcher(m *Module) (func(string) bool, error) {
+	paths, globs := splitGlobs(m.FileDependencies())
+	var matcher *pathMatcher
+	if len(globs) > 0 {
+		var err error
+		matcher, err = newPathMatcher(globs, false)
+		if err != nil {
+			return nil, e.Wrapf(ErrClassUser, err, msgInvalidFileDependency, m.Name(), m.Path())
+		}
+	}
+
+	return func(p string) bool {
+		for _, f := range paths {
+			if strings.HasPrefix(strings.ToLower(p), strings.ToLower(f)) {
+				return true
+			}
+		}
+
+		return matcher != nil && matcher.Match(p)
+	}, nil
+}
+
+// isDefaultsFile returns true if the path refers to the
+// repository defaults file.
+func isDefaultsFile(p string) bool {
+	return strings.ToLower(p) == defaultsFileName
+}
+
+// changedFiles returns the paths in deltas accepted by match.
+func changedFiles(deltas []*DiffDelta, match func(string) bool) []string {
+	files := make([]string, 0)
+	for _, d := range deltas {
+		for _, p := range d.paths() {
+			if match(p) {
+				files = append(files, p)
+			}
+		}
+	}
+
+	return files
+}
+
+// paths returns the distinct paths on both sides of a delta.
+func (d *DiffDelta) paths() []string {
+	if d.OldFile == "" || d.OldFile == d.NewFile {
+		return []string{d.NewFile}
+	}
+
+	if d.NewFile == "" {
+		return []string{d.OldFile}
+	}
+
+	return []string{d.OldFile, d.NewFile}
+}
@@ -1,3 +1,6 @@
+//go:build !nolibgit2
+// +build !nolibgit2
+
 /*
 Copyright 2018 MBT Authors.
 Licensed under the Apache License, Version 2.0 (the "License");
@@ -22,6 +25,10 @@ import (
 	"github.com/mbtproject/mbt/e"
 )
 
+var defaultCheckoutOptions = &git.CheckoutOpts{
+	Strategy: git.CheckoutSafe,
+}
+
 type libgitBlob struct {
 	path   string
 	commit *libgitCommit
@@ -40,6 +47,10 @@ func (b *libgitBlob) Path() string {
 	return b.path
 }
 
+func (b *libgitBlob) Mode() uint32 {
+	return uint32(b.entry.Filemode)
+}
+
 func (b *libgitBlob) String() string {
 	return fmt.Sprintf("%s%s", b.Path(), b.Name())
 }
@@ -116,6 +127,30 @@ func (r *libgitRepo) GetCommit(commitSha string) (Commit, error) {
 	return &libgitCommit{commit: commit}, nil
 }
 
+func (r *libgitRepo) ResolveRevision(rev string) (Commit, error) {
+	obj, err := r.Repo.RevparseSingle(rev)
+	if git.IsErrorCode(err, git.ErrorCodeAmbiguous) {
+		return nil, e.Wrapf(ErrClassUser, err, msgAmbiguousRevision, rev)
+	}
+
+	if err != nil {
+		return nil, e.Wrapf(ErrClassUser, err, msgUnknownRevision, rev)
+	}
+
+	// Annotated tags are peeled to the commit they point to.
+	obj, err = obj.Peel(git.ObjectCommit)
+	if err != nil {
+		return nil, e.Wrapf(ErrClassUser, err, msgRevisionNotCommit, rev)
+	}
+
+	commit, err := obj.AsCommit()
+	if err != nil {
+		return nil, e.Wrapf(ErrClassUser, err, msgRevisionNotCommit, rev)
+	}
+
+	return &libgitCommit{commit: commit}, nil
+}
+
 func (r *libgitRepo) Path() string {
 	return r.path
 }
@@ -193,6 +228,11 @@ func (r *libgitRepo) Changes(c Commit) ([]*DiffDelta, error) {
 		return nil, e.Wrap(ErrClassInternal, err)
 	}
 
+	err = detectRenames(d)
+	if err != nil {
+		return nil, err
+	}
+
 	return deltas(d)
 }
 
@@ -235,7 +275,7 @@ func (r *libgitRepo) WalkBlobs(commit Commit, callback BlobWalkCallback) error {
 func (r *libgitRepo) BlobContents(blob Blob) ([]byte, error) {
 	bl, err := r.Repo.LookupBlob(blob.(*libgitBlob).entry.Id)
 	if err != nil {
-		return nil, e.Wrapf(ErrClassInternal, err, "error while fetching the blob object for %s%s", blob.Path(), blob.Name())
+		return nil, e.Wrapf(ErrClassInternal, err, msgFailedBlobRead, blob.Path(), blob.Name())
 	}
 
 	return bl.Contents(), nil
@@ -247,9 +287,13 @@ func (r *libgitRepo) EntryID(commit Commit, path string) (string, error) {
 		return "", err
 	}
 
+	if path == "" {
+		return tree.Id().String(), nil
+	}
+
 	entry, err := tree.EntryByPath(path)
 	if err != nil {
-		return "", e.Wrapf(ErrClassInternal, err, "error while fetching the tree entry for %s", path)
+		return "", e.Wrapf(ErrClassInternal, err, msgFailedTreeEntryRead, path)
 	}
 
 	return entry.Id.String(), nil
@@ -338,6 +382,53 @@ func (r *libgitRepo) FindAllFilesInWorkspace(pathSpec []string) ([]string, error
 	return configPaths, nil
 }
 
+func (r *libgitRepo) WorkspaceFileContents(path string) ([]byte, error) {
+	return readWorkspaceFile(r.path, path)
+}
+
+func (r *libgitRepo) WorkspaceEntryIDs(paths []string) (map[string]string, error) {
+	h, err := r.workspaceHasher()
+	if err != nil {
+		return nil, err
+	}
+
+	return h.entryIDs(paths)
+}
+
+func (r *libgitRepo) WorkspaceBlobs() ([]Blob, error) {
+	h, err := r.workspaceHasher()
+	if err != nil {
+		return nil, err
+	}
+
+	return h.blobs()
+}
+
+func (r *libgitRepo) workspaceHasher() (*workspaceHasher, error) {
+	files, err := r.FindAllFilesInWorkspace([]string{"*"})
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := r.Repo.Index()
+	if err != nil {
+		return nil, e.Wrap(ErrClassInternal, err)
+	}
+
+	defer index.Free()
+
+	modes := make(map[string]uint32)
+	for i := uint(0); i < index.EntryCount(); i++ {
+		entry, err := index.EntryByIndex(i)
+		if err != nil {
+			return nil, e.Wrap(ErrClassInternal, err)
+		}
+		modes[entry.Path] = uint32(entry.Mode)
+	}
+
+	return newWorkspaceHasher(r.path, files, modes), nil
+}
+
 func (r *libgitRepo) EnsureSafeWorkspace() error {
 	status, err := r.Repo.StatusList(&git.StatusOptions{
 		Flags: git.StatusOptIncludeUntracked,
@@ -470,10 +561,29 @@ func (r *libgitRepo) CheckoutReference(reference Reference) error {
 	return nil
 }
 
+func (r *libgitRepo) Export(commit Commit, dir string) error {
+	tree, err := commit.(*libgitCommit).Tree()
+	if err != nil {
+		return err
+	}
+
+	options := &git.CheckoutOpts{
+		Strategy:        git.CheckoutForce | git.CheckoutDontUpdateIndex,
+		TargetDirectory: dir,
+	}
+
+	err = r.Repo.CheckoutTree(tree, options)
+	if err != nil {
+		return e.Wrap(ErrClassInternal, err)
+	}
+
+	return nil
+}
+
 func (r *libgitRepo) MergeBase(a, b Commit) (Commit, error) {
 	bid, err := r.Repo.MergeBase(a.(*libgitCommit).commit.Id(), b.(*libgitCommit).commit.Id())
 	if err != nil {
-		return nil, e.Wrap(ErrClassInternal, err)
+		return nil, e.Wrapf(ErrClassInternal, err, msgFailedMergeBase, a.ID(), b.ID())
 	}
 
 	return r.GetCommit(bid.String())
@@ -495,9 +605,32 @@ func diff(repo *git.Repository, ca, cb Commit) (*git.Diff, error) {
 		return nil, e.Wrap(ErrClassInternal, err)
 	}
 
+	err = detectRenames(diff)
+	if err != nil {
+		return nil, err
+	}
+
 	return diff, nil
 }
 
+// detectRenames updates the diff to pair up the files deleted and
+// added due to a rename. Renamed deltas have different old and new
+// file paths.
+func detectRenames(diff *git.Diff) error {
+	opts, err := git.DefaultDiffFindOptions()
+	if err != nil {
+		return e.Wrap(ErrClassInternal, err)
+	}
+
+	opts.Flags = git.DiffFindRenames
+	err = diff.FindSimilar(&opts)
+	if err != nil {
+		return e.Wrap(ErrClassInternal, err)
+	}
+
+	return nil
+}
+
 func deltas(diff *git.Diff) ([]*DiffDelta, error) {
 	count, err := diff.NumDeltas()
 	if err != nil {
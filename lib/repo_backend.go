@@ -0,0 +1,69 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mbtproject/mbt/e"
+)
+
+const (
+	// RepoBackendEnv is the environment variable used to select
+	// the Repo implementation.
+	RepoBackendEnv = "MBT_REPO_BACKEND"
+	// RepoBackendLibgit2 selects the libgit2 (cgo) implementation.
+	RepoBackendLibgit2 = "libgit2"
+	// RepoBackendGoGit selects the pure Go implementation.
+	RepoBackendGoGit = "go-git"
+)
+
+// NewRepo creates a Repo using the backend specified in
+// MBT_REPO_BACKEND environment variable.
+// When the variable is not set, the default backend of the
+// current build is used (libgit2 unless built with nolibgit2 tag).
+func NewRepo(path string, log Log) (Repo, error) {
+	return NewRepoWithBackend(os.Getenv(RepoBackendEnv), path, log)
+}
+
+// NewRepoWithBackend creates a Repo using the specified backend.
+func NewRepoWithBackend(backend, path string, log Log) (Repo, error) {
+	if backend == "" {
+		backend = defaultRepoBackend
+	}
+
+	switch backend {
+	case RepoBackendLibgit2:
+		return newLibgitBackend(path, log)
+	case RepoBackendGoGit:
+		return NewGoGitRepo(path, log)
+	default:
+		return nil, e.NewErrorf(ErrClassUser, msgUnknownRepoBackend, backend)
+	}
+}
+
+// readWorkspaceFile reads a file in the workspace of a repository
+// stored in disk.
+func readWorkspaceFile(repoPath, path string) ([]byte, error) {
+	contents, err := ioutil.ReadFile(filepath.Join(repoPath, filepath.FromSlash(path)))
+	if err != nil {
+		return nil, e.Wrap(ErrClassInternal, err)
+	}
+
+	return contents, nil
+}
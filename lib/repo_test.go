@@ -18,7 +18,9 @@ package lib
 import (
 	"fmt"
 	"testing"
+	"time"
 
+	git "github.com/libgit2/git2go/v28"
 	"github.com/mbtproject/mbt/e"
 	"github.com/stretchr/testify/assert"
 )
@@ -37,6 +39,52 @@ func TestInvalidBranch(t *testing.T) {
 	assert.Equal(t, ErrClassUser, (err.(*e.E)).Class())
 }
 
+func TestResolveRevision(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.InitModule("app-a"))
+	check(t, repo.Commit("first"))
+	c1 := repo.LastCommit
+
+	check(t, repo.WriteContent("app-a/foo", "bar"))
+	check(t, repo.Commit("second"))
+	c2 := repo.LastCommit
+
+	commit, err := repo.Repo.LookupCommit(c1)
+	check(t, err)
+	sig := &git.Signature{Name: "alice", Email: "alice@example.com", When: time.Now()}
+	_, err = repo.Repo.Tags.Create("v1.0", commit, sig, "release")
+	check(t, err)
+
+	r := NewWorld(t, ".tmp/repo").Repo
+	for rev, expected := range map[string]*git.Oid{
+		c2.String():     c2,
+		c2.String()[:7]: c2,
+		"HEAD":          c2,
+		"HEAD~1":        c1,
+		"master^":       c1,
+		"v1.0":          c1,
+	} {
+		c, err := r.ResolveRevision(rev)
+		check(t, err)
+		assert.Equal(t, expected.String(), c.ID(), rev)
+	}
+}
+
+func TestResolveUnknownRevision(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.InitModule("app-a"))
+	check(t, repo.Commit("first"))
+
+	_, err := NewWorld(t, ".tmp/repo").Repo.ResolveRevision("HEAD~5")
+
+	assert.EqualError(t, err, fmt.Sprintf(msgUnknownRevision, "HEAD~5"))
+	assert.Equal(t, ErrClassUser, (err.(*e.E)).Class())
+}
+
 func TestBranchName(t *testing.T) {
 	clean()
 
@@ -232,3 +280,98 @@ func TestGitIgnoreRulesInSafeWorkspace(t *testing.T) {
 	w := NewWorld(t, ".tmp/repo")
 	check(t, w.Repo.EnsureSafeWorkspace())
 }
+
+func TestUnknownRepoBackend(t *testing.T) {
+	_, err := NewRepoWithBackend("svn", ".tmp/repo", NewStdLog(LogLevelNormal))
+
+	assert.EqualError(t, err, fmt.Sprintf(msgUnknownRepoBackend, "svn"))
+	assert.Equal(t, ErrClassUser, (err.(*e.E)).Class())
+}
+
+func TestGoGitRepoMatchesLibgitRepo(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.InitModule("app-a"))
+	check(t, repo.WriteContent("app-b/sub/file", "a"))
+	check(t, repo.Commit("first"))
+	check(t, repo.InitModule("app-b"))
+	check(t, repo.WriteContent("app-b/sub/file", "b"))
+	check(t, repo.Commit("second"))
+
+	log := NewStdLog(LogLevelNormal)
+	libgit, err := NewRepoWithBackend(RepoBackendLibgit2, ".tmp/repo", log)
+	check(t, err)
+	gogit, err := NewRepoWithBackend(RepoBackendGoGit, ".tmp/repo", log)
+	check(t, err)
+
+	walk := func(r Repo, c Commit) []string {
+		var blobs []string
+		check(t, r.WalkBlobs(c, func(b Blob) error {
+			blobs = append(blobs, fmt.Sprintf("%s|%s|%s", b.Path(), b.Name(), b.ID()))
+			return nil
+		}))
+		return blobs
+	}
+
+	for _, r := range []Repo{libgit, gogit} {
+		head, err := r.CurrentBranchCommit()
+		check(t, err)
+		assert.Equal(t, repo.LastCommit.String(), head.ID())
+
+		parent, err := r.ResolveRevision("HEAD~1")
+		check(t, err)
+
+		delta, err := r.Diff(parent, head)
+		check(t, err)
+		assert.Len(t, delta, 2)
+		assert.Equal(t, "app-b/.mbt.yml", delta[0].NewFile)
+		assert.Equal(t, "app-b/sub/file", delta[1].NewFile)
+
+		id, err := r.EntryID(head, "app-b")
+		check(t, err)
+		libgitHead, err := libgit.CurrentBranchCommit()
+		check(t, err)
+		libgitID, err := libgit.EntryID(libgitHead, "app-b")
+		check(t, err)
+		assert.Equal(t, libgitID, id)
+		assert.Equal(t, walk(libgit, libgitHead), walk(r, head))
+	}
+}
+
+func TestMatchPathSpec(t *testing.T) {
+	spec := []string{".mbt.yml", "/**/.mbt.yml"}
+
+	assert.True(t, matchPathSpec(spec, ".mbt.yml"))
+	assert.True(t, matchPathSpec(spec, "app-a/.mbt.yml"))
+	assert.True(t, matchPathSpec(spec, "app-a/b/.mbt.yml"))
+	assert.False(t, matchPathSpec(spec, "app-a/mbt.yml"))
+	assert.True(t, matchPathSpec([]string{"app-a"}, "app-a/foo"))
+	assert.False(t, matchPathSpec([]string{"app-a"}, "app-ab/foo"))
+}
+
+func TestDiffWithRenames(t *testing.T) {
+	clean()
+	repo := NewTestRepo(t, ".tmp/repo")
+
+	check(t, repo.InitModule("app-a"))
+	check(t, repo.WriteContent("app-a/foo", "hello world"))
+	check(t, repo.Commit("first"))
+	c1 := repo.LastCommit.String()
+
+	check(t, repo.Rename("app-a/foo", "app-a/bar"))
+	check(t, repo.Commit("second"))
+	c2 := repo.LastCommit.String()
+
+	r := NewWorld(t, ".tmp/repo").Repo
+	from, err := r.GetCommit(c1)
+	check(t, err)
+	to, err := r.GetCommit(c2)
+	check(t, err)
+	delta, err := r.Diff(from, to)
+	check(t, err)
+
+	assert.Len(t, delta, 1)
+	assert.Equal(t, "app-a/foo", delta[0].OldFile)
+	assert.Equal(t, "app-a/bar", delta[0].NewFile)
+}
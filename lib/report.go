@@ -0,0 +1,191 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mbtproject/mbt/e"
+)
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Errors     int             `xml:"errors,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	TestCases  []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+	SystemErr string        `xml:"system-err,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Content string `xml:",chardata"`
+}
+
+// WriteJUnitReport writes the results of running a command (e.g. build) in
+// the modules of a manifest in JUnit xml format.
+// Each module is reported as a test case. Skipped, cached and cancelled
+// modules are reported as skipped test cases.
+func WriteJUnitReport(w io.Writer, command string, m *Manifest, results []*ModuleResult) error {
+	suite := junitTestSuite{
+		Name:       "mbt " + command,
+		Properties: []junitProperty{{Name: "sha", Value: m.Sha}},
+		TestCases:  make([]junitTestCase, 0, len(results)),
+	}
+
+	var total time.Duration
+	for _, r := range results {
+		total += r.Duration
+		c := junitTestCase{
+			Name:      r.Module.Name(),
+			ClassName: r.Module.Path(),
+			Time:      seconds(r.Duration),
+			SystemOut: r.Stdout,
+			SystemErr: r.Stderr,
+		}
+
+		switch r.Status {
+		case ModuleStatusFailed:
+			suite.Failures++
+			c.Failure = &junitMessage{Message: errorMessage(r.Err), Content: errorMessage(r.Err)}
+		case ModuleStatusSkipped:
+			suite.Skipped++
+			c.Skipped = &junitMessage{Message: string(r.SkipReason)}
+		case ModuleStatusCached, ModuleStatusCancelled:
+			suite.Skipped++
+			c.Skipped = &junitMessage{Message: string(r.Status)}
+		}
+
+		suite.TestCases = append(suite.TestCases, c)
+	}
+
+	suite.Tests = len(suite.TestCases)
+	suite.Time = seconds(total)
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(&junitTestSuites{Suites: []junitTestSuite{suite}})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+type jsonReport struct {
+	Command string              `json:"command"`
+	Sha     string              `json:"sha"`
+	Modules []*jsonModuleResult `json:"modules"`
+}
+
+type jsonModuleResult struct {
+	Name       string       `json:"name"`
+	Path       string       `json:"path"`
+	Version    string       `json:"version"`
+	Status     ModuleStatus `json:"status"`
+	SkipReason SkipReason   `json:"skipReason,omitempty"`
+	DurationMs int64        `json:"durationMs"`
+	Stdout     string       `json:"stdout,omitempty"`
+	Stderr     string       `json:"stderr,omitempty"`
+	Error      string       `json:"error,omitempty"`
+}
+
+// WriteJSONReport writes the results of running a command (e.g. build) in
+// the modules of a manifest in json format.
+func WriteJSONReport(w io.Writer, command string, m *Manifest, results []*ModuleResult) error {
+	report := &jsonReport{
+		Command: command,
+		Sha:     m.Sha,
+		Modules: make([]*jsonModuleResult, 0, len(results)),
+	}
+
+	for _, r := range results {
+		report.Modules = append(report.Modules, &jsonModuleResult{
+			Name:       r.Module.Name(),
+			Path:       r.Module.Path(),
+			Version:    r.Module.Version(),
+			Status:     r.Status,
+			SkipReason: r.SkipReason,
+			DurationMs: int64(r.Duration / time.Millisecond),
+			Stdout:     r.Stdout,
+			Stderr:     r.Stderr,
+			Error:      errorMessage(r.Err),
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// errorMessage returns the messages of err and its inner errors
+// (e.g. Failed to build module 'app-a': exit status 1).
+func errorMessage(err error) string {
+	msg := ""
+	for err != nil {
+		m := err.Error()
+		if msg == "" {
+			msg = m
+		} else if !strings.HasSuffix(msg, m) {
+			msg += ": " + m
+		}
+
+		ee, ok := err.(*e.E)
+		if !ok {
+			break
+		}
+		err = ee.InnerError()
+	}
+
+	return msg
+}
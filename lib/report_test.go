@@ -0,0 +1,111 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testModuleResults() (*Manifest, []*ModuleResult) {
+	mod := func(name string) *Module {
+		m := newModule(newModuleMetadata(name, "abc", &Spec{Name: name}, nil), nil)
+		m.version = "v-" + name
+		return m
+	}
+
+	appA, appB, appC, appD := mod("app-a"), mod("app-b"), mod("app-c"), mod("app-d")
+	m := &Manifest{Sha: "sha", Modules: Modules{appA, appB, appC, appD}}
+	return m, []*ModuleResult{
+		{Module: appA, Status: ModuleStatusCompleted, Duration: 1500 * time.Millisecond, Stdout: "built app-a\n"},
+		{Module: appB, Status: ModuleStatusFailed, Duration: 250 * time.Millisecond, Stderr: "oops\n", Err: errors.New("exit status 1")},
+		{Module: appC, Status: ModuleStatusSkipped, SkipReason: SkipReasonUnsupportedOS},
+		{Module: appD, Status: ModuleStatusCancelled},
+	}
+}
+
+func TestJUnitReport(t *testing.T) {
+	m, results := testModuleResults()
+	buff := new(bytes.Buffer)
+	check(t, WriteJUnitReport(buff, "build", m, results))
+
+	report := &junitTestSuites{}
+	check(t, xml.Unmarshal(buff.Bytes(), report))
+
+	assert.Len(t, report.Suites, 1)
+	suite := report.Suites[0]
+	assert.Equal(t, "mbt build", suite.Name)
+	assert.Equal(t, 4, suite.Tests)
+	assert.Equal(t, 1, suite.Failures)
+	assert.Equal(t, 2, suite.Skipped)
+	assert.Equal(t, "1.750", suite.Time)
+	assert.Equal(t, []junitProperty{{Name: "sha", Value: "sha"}}, suite.Properties)
+
+	assert.Len(t, suite.TestCases, 4)
+	assert.Equal(t, "app-a", suite.TestCases[0].Name)
+	assert.Equal(t, "1.500", suite.TestCases[0].Time)
+	assert.Equal(t, "built app-a\n", suite.TestCases[0].SystemOut)
+	assert.Nil(t, suite.TestCases[0].Failure)
+	assert.Nil(t, suite.TestCases[0].Skipped)
+
+	assert.Equal(t, "exit status 1", suite.TestCases[1].Failure.Message)
+	assert.Equal(t, "oops\n", suite.TestCases[1].SystemErr)
+	assert.Equal(t, "unsupported_os", suite.TestCases[2].Skipped.Message)
+	assert.Equal(t, "cancelled", suite.TestCases[3].Skipped.Message)
+}
+
+func TestJSONReport(t *testing.T) {
+	m, results := testModuleResults()
+	buff := new(bytes.Buffer)
+	check(t, WriteJSONReport(buff, "deploy", m, results))
+
+	report := &jsonReport{}
+	check(t, json.Unmarshal(buff.Bytes(), report))
+
+	assert.Equal(t, "deploy", report.Command)
+	assert.Equal(t, "sha", report.Sha)
+	assert.Len(t, report.Modules, 4)
+	assert.Equal(t, &jsonModuleResult{
+		Name:       "app-a",
+		Path:       "app-a",
+		Version:    "v-app-a",
+		Status:     ModuleStatusCompleted,
+		DurationMs: 1500,
+		Stdout:     "built app-a\n",
+	}, report.Modules[0])
+	assert.Equal(t, ModuleStatusFailed, report.Modules[1].Status)
+	assert.Equal(t, "exit status 1", report.Modules[1].Error)
+	assert.Equal(t, SkipReasonUnsupportedOS, report.Modules[2].SkipReason)
+	assert.Equal(t, ModuleStatusCancelled, report.Modules[3].Status)
+}
+
+func TestTailBuffer(t *testing.T) {
+	b := &tailBuffer{size: 5}
+	b.Write([]byte("abc"))
+	assert.Equal(t, "abc", b.String())
+
+	b.Write([]byte("defg"))
+	assert.Equal(t, "cdefg", b.String())
+
+	b.Write([]byte("hijklmn"))
+	assert.Equal(t, "jklmn", b.String())
+}
@@ -18,21 +18,59 @@ package lib
 const (
 	msgInvalidSha                          = "Invalid commit sha '%v'"
 	msgCommitShaNotFound                   = "Failed to find commit sha '%v'"
+	msgUnknownRevision                     = "Failed to resolve revision '%v'"
+	msgAmbiguousRevision                   = "Revision '%v' is ambiguous, use a longer sha or the full reference name"
+	msgRevisionNotCommit                   = "Revision '%v' does not point to a commit"
+	msgInvalidRevisionRange                = "Invalid revision range '%v'"
 	msgFailedOpenRepo                      = "Failed to open a git repository in dir - '%v'"
+	msgUnknownRepoBackend                  = "Unknown repository backend '%v' (available options are 'libgit2' and 'go-git')"
+	msgLibgit2Unavailable                  = "This build of mbt does not include libgit2, use the 'go-git' repository backend instead"
 	msgFailedTemplatePath                  = "Failed to read the template in file '%v'"
 	msgFailedReadFile                      = "Failed to read file '%v'"
 	msgFailedLocalPath                     = "Failed to read the path '%v'"
 	msgFailedTemplateParse                 = "Failed to parse the template"
 	msgFailedBuild                         = "Failed to build module '%v'"
+	msgBuildCancelled                      = "Build cancelled before building %v module(s)"
+	msgRunCancelled                        = "Run cancelled before running %v module(s)"
 	msgTemplateNotFound                    = "Specified template %v is not found in git tree %v"
 	msgFailedSpecParse                     = "Failed to parse the spec file"
 	msgFailedBranchLookup                  = "Failed to find the branch '%v'"
 	msgFailedTreeWalk                      = "Failed to walk to the tree object '%v'"
 	msgFailedTreeLoad                      = "Failed to read commit tree '%v'"
+	msgFailedBlobRead                      = "error while fetching the blob object for %s%s"
+	msgFailedTreeEntryRead                 = "error while fetching the tree entry for %s"
+	msgFailedMergeBase                     = "Failed to find the merge base of %v and %v"
+	msgMergeConflict                       = "Merge conflict in %v"
+	msgInvalidFileDependency               = "Invalid file dependency pattern in module %v in %v"
 	msgFileDependencyNotFound              = "Failed to find the file dependency %v in module %v in %v - File dependencies are case sensitive"
 	msgFailedRestorationOfOldReference     = "Restoration of reference %v failed %v"
 	msgSuccessfulRestorationOfOldReference = "Successfully restored reference %v"
 	msgSuccessfulCheckout                  = "Successfully checked out commit %v"
+	msgSuccessfulExport                    = "Successfully exported commit %v into %v"
+	msgFailedRemovalOfExport               = "Removal of exported commit in %v failed %v"
 	msgDirtyWorkingDir                     = "Dirty working dir"
 	msgDetachedHead                        = "Head is currently detached"
+	msgFailedCacheRead                     = "Failed to read the cache entry for module %v version %v"
+	msgFailedCacheWrite                    = "Failed to write the cache entry for module %v version %v"
+	msgCacheEntryNotFound                  = "Cache entry for module %v version %v is not found"
+	msgUnexpectedCacheResponse             = "Unexpected response from cache server %v %v: %v"
+	msgInvalidCacheKey                     = "Module %v version %v cannot be stored in the cache"
+	msgCacheLookupFailed                   = "Build cache lookup failed for %s: %v"
+	msgCacheRestoreFailed                  = "Build cache restore failed for %s: %v"
+	msgCacheUpdateFailed                   = "Build cache update failed for %s: %v"
+	msgFailedArtifactsArchive              = "Failed to archive the artifacts in %v"
+	msgFailedArtifactsRestore              = "Failed to restore the artifacts in %v"
+	msgInvalidArtifactPath                 = "Invalid path in artifacts archive %v"
+	msgRetryingCommand                     = "Retrying %v (%v of %v) after failure: %v"
+	msgCommandTimedOut                     = "Command timed out after %v"
+	msgKillingProcess                      = "Killing %v since it did not exit within %v"
+	msgFailedEmitEvent                     = "Failed to emit %v event: %v"
+	msgFailedOpenModuleLog                 = "Failed to open the log file of module %v"
+	msgInvalidSpecKey                      = "line %v, column %v: %v"
+	msgInvalidFilter                       = "Invalid filter expression '%v': %v"
+	msgKindNotFound                        = "Kind '%v' of module %v is not defined in .mbt-defaults.yml"
+	msgFailedManifestRead                  = "Failed to read the manifest in file '%v'"
+	msgUnsupportedManifestVersion          = "Unsupported manifest format version %v in file '%v' (expected %v)"
+	msgManifestModuleNotFound              = "Module %v in the manifest is not found in commit %v"
+	msgManifestModuleVersionMismatch       = "Version of module %v in the manifest (%v) does not match the version in commit %v (%v)"
 )
@@ -0,0 +1,82 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"strings"
+
+	"github.com/mbtproject/mbt/e"
+)
+
+// resolveDiff resolves the commits at both ends of a diff.
+// When to is empty, from may be a revision range in A..B or A...B form.
+func (s *stdSystem) resolveDiff(from, to string) (Commit, Commit, error) {
+	if to == "" && strings.Contains(from, "..") {
+		return s.resolveRange(from)
+	}
+
+	f, err := s.Repo.ResolveRevision(from)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t, err := s.Repo.ResolveRevision(to)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return f, t, nil
+}
+
+// resolveRange resolves a revision range.
+// A..B resolves to A and B while A...B resolves to the merge base
+// of A and B, and B. Omitted ends of a range default to HEAD.
+func (s *stdSystem) resolveRange(spec string) (Commit, Commit, error) {
+	separator := ".."
+	if strings.Contains(spec, "...") {
+		separator = "..."
+	}
+
+	parts := strings.SplitN(spec, separator, 2)
+	if strings.Contains(parts[1], "..") {
+		return nil, nil, e.NewErrorf(ErrClassUser, msgInvalidRevisionRange, spec)
+	}
+
+	for i, p := range parts {
+		if p == "" {
+			parts[i] = "HEAD"
+		}
+	}
+
+	from, err := s.Repo.ResolveRevision(parts[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	to, err := s.Repo.ResolveRevision(parts[1])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if separator == "..." {
+		from, err = s.Repo.MergeBase(from, to)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return from, to, nil
+}
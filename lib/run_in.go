@@ -35,21 +35,31 @@ func (s *stdSystem) RunInBranch(command, name string, filterOptions *FilterOptio
 	return s.checkoutAndRunManifest(command, m, options)
 }
 
-func (s *stdSystem) RunInPr(command, src, dst string, options *CmdOptions) (*RunResult, error) {
+func (s *stdSystem) RunInPr(command, src, dst string, filterOptions *FilterOptions, options *CmdOptions) (*RunResult, error) {
 	m, err := s.ManifestByPr(src, dst)
 	if err != nil {
 		return nil, err
 	}
 
+	m, err = m.ApplyFilters(filterOptions)
+	if err != nil {
+		return nil, err
+	}
+
 	return s.checkoutAndRunManifest(command, m, options)
 }
 
-func (s *stdSystem) RunInDiff(command, from, to string, options *CmdOptions) (*RunResult, error) {
+func (s *stdSystem) RunInDiff(command, from, to string, filterOptions *FilterOptions, options *CmdOptions) (*RunResult, error) {
 	m, err := s.ManifestByDiff(from, to)
 	if err != nil {
 		return nil, err
 	}
 
+	m, err = m.ApplyFilters(filterOptions)
+	if err != nil {
+		return nil, err
+	}
+
 	return s.checkoutAndRunManifest(command, m, options)
 }
 
@@ -81,12 +91,17 @@ func (s *stdSystem) RunInCommit(command, commit string, filterOptions *FilterOpt
 	return s.checkoutAndRunManifest(command, m, options)
 }
 
-func (s *stdSystem) RunInCommitContent(command, commit string, options *CmdOptions) (*RunResult, error) {
+func (s *stdSystem) RunInCommitContent(command, commit string, filterOptions *FilterOptions, options *CmdOptions) (*RunResult, error) {
 	m, err := s.ManifestByCommitContent(commit)
 	if err != nil {
 		return nil, err
 	}
 
+	m, err = m.ApplyFilters(filterOptions)
+	if err != nil {
+		return nil, err
+	}
+
 	return s.checkoutAndRunManifest(command, m, options)
 }
 
@@ -104,63 +119,120 @@ func (s *stdSystem) RunInWorkspace(command string, filterOptions *FilterOptions,
 	return s.runManifest(command, m, options)
 }
 
-func (s *stdSystem) RunInWorkspaceChanges(command string, options *CmdOptions) (*RunResult, error) {
+func (s *stdSystem) RunInWorkspaceChanges(command string, filterOptions *FilterOptions, options *CmdOptions) (*RunResult, error) {
 	m, err := s.ManifestByWorkspaceChanges()
 	if err != nil {
 		return nil, err
 	}
 
+	m, err = m.ApplyFilters(filterOptions)
+	if err != nil {
+		return nil, err
+	}
+
 	return s.runManifest(command, m, options)
 }
 
-func (s *stdSystem) checkoutAndRunManifest(command string, m *Manifest, options *CmdOptions) (*RunResult, error) {
-	r, err := s.WorkspaceManager.CheckoutAndRun(m.Sha, func() (interface{}, error) {
-		return s.runManifest(command, m, options)
-	})
-
+func (s *stdSystem) RunInManifestFile(command, path string, options *CmdOptions) (*RunResult, error) {
+	m, err := s.ManifestByFile(path)
 	if err != nil {
 		return nil, err
 	}
 
-	return r.(*RunResult), nil
+	if m.Sha == WorkspaceSha {
+		return s.runManifest(command, m, options)
+	}
+
+	return s.checkoutAndRunManifest(command, m, options)
+}
+
+func (s *stdSystem) checkoutAndRunManifest(command string, m *Manifest, options *CmdOptions) (*RunResult, error) {
+	if options.DryRun {
+		// Plans are derived from the manifest, there's no need to checkout.
+		return s.runManifest(command, m, options)
+	}
+
+	r, err := s.checkoutAndRun(m, options, func(m *Manifest) (interface{}, error) {
+		return s.runManifest(command, m, options)
+	})
+
+	// Cancelled runs return the result along with the error
+	// so that callers could report the skipped modules.
+	result, _ := r.(*RunResult)
+	return result, err
 }
 
 func (s *stdSystem) runManifest(command string, m *Manifest, options *CmdOptions) (*RunResult, error) {
+	if options.DryRun {
+		return &RunResult{Manifest: m, Plan: s.planRun(command, m)}, nil
+	}
+
 	completed := make([]*Module, 0)
 	skipped := make([]*Module, 0)
 	failed := make([]*CmdFailure, 0)
 
+	t := s.newStageTracker(command, m, options)
+	t.begin()
+
 	var err error
+	cancelled := 0
 	for _, a := range m.Modules {
+		var reason SkipReason
 		cmd, canRun := s.canRunHere(command, a)
-		if !canRun || (err != nil && options.FailFast) {
+		switch {
+		case !canRun:
+			reason = runSkipReason(command, a)
+		case err != nil && options.FailFast:
+			reason = SkipReasonFailFast
+		case options.context().Err() != nil:
+			reason = SkipReasonCancelled
+			cancelled++
+		}
+
+		if reason != "" {
 			skipped = append(skipped, a)
-			options.Callback(a, CmdStageSkipBuild, nil)
+			t.skipped(a, reason)
 			continue
 		}
 
-		options.Callback(a, CmdStageBeforeBuild, nil)
-		err = s.execCommand(cmd, m, a, options)
+		t.notify(a, CmdStageBeforeBuild, nil)
+		err = s.execCommand(cmd, m, a, t.capture(a, options))
 		if err != nil {
 			failed = append(failed, &CmdFailure{Err: err, Module: a})
-			options.Callback(a, CmdStageFailedBuild, err)
+			t.notify(a, CmdStageFailedBuild, err)
 		} else {
 			completed = append(completed, a)
-			options.Callback(a, CmdStageAfterBuild, nil)
+			t.notify(a, CmdStageAfterBuild, nil)
 		}
 	}
 
-	return &RunResult{Manifest: m, Failures: failed, Completed: completed, Skipped: skipped}, nil
+	result := &RunResult{Manifest: m, Failures: failed, Completed: completed, Skipped: skipped, Results: t.moduleResults()}
+	if cerr := options.context().Err(); cerr != nil {
+		err = e.Wrapf(ErrClassUser, cerr, msgRunCancelled, cancelled)
+		t.end(err)
+		return result, err
+	}
+
+	t.end(nil)
+	return result, nil
 }
 
 func (s *stdSystem) execCommand(command *UserCmd, manifest *Manifest, module *Module, options *CmdOptions) error {
-	err := s.ProcessManager.Exec(manifest, module, options, command.Cmd, command.Args...)
+	err := s.execWithRetries(manifest, module, options, command.Timeout, command.Retries, command.Cmd, command.Args...)
 	if err != nil {
 		return e.Wrap(ErrClassUser, err)
 	}
 	return nil
 }
 
+func runSkipReason(command string, mod *Module) SkipReason {
+	if _, ok := mod.Commands()[command]; !ok {
+		return SkipReasonNoCommand
+	}
+
+	return SkipReasonUnsupportedOS
+}
+
 func (s *stdSystem) canRunHere(command string, mod *Module) (*UserCmd, bool) {
 	c, ok := mod.Commands()[command]
 	if !ok {
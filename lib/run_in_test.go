@@ -17,9 +17,12 @@ package lib
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"runtime"
 	"testing"
 
+	"github.com/mbtproject/mbt/e"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -49,7 +52,7 @@ func TestCmdExecution(t *testing.T) {
 
 	// Test new workspace diff
 	buff = new(bytes.Buffer)
-	result, err = w.System.RunInWorkspaceChanges("echo", stdTestCmdOptions(buff))
+	result, err = w.System.RunInWorkspaceChanges("echo", NoFilter, stdTestCmdOptions(buff))
 
 	check(t, err)
 	assert.Len(t, result.Completed, 1)
@@ -151,7 +154,7 @@ func TestRunInPr(t *testing.T) {
 	w := NewWorld(t, ".tmp/repo")
 
 	buff := new(bytes.Buffer)
-	result, err := w.System.RunInPr("echo", "feature", "master", stdTestCmdOptions(buff))
+	result, err := w.System.RunInPr("echo", "feature", "master", NoFilter, stdTestCmdOptions(buff))
 
 	check(t, err)
 	assert.Len(t, result.Completed, 1)
@@ -161,7 +164,7 @@ func TestRunInPr(t *testing.T) {
 	assert.Equal(t, "hello-app-b\n", buff.String())
 
 	buff = new(bytes.Buffer)
-	result, err = w.System.RunInPr("echo", "master", "feature", stdTestCmdOptions(buff))
+	result, err = w.System.RunInPr("echo", "master", "feature", NoFilter, stdTestCmdOptions(buff))
 
 	check(t, err)
 	assert.Len(t, result.Completed, 0)
@@ -170,6 +173,73 @@ func TestRunInPr(t *testing.T) {
 	assert.Equal(t, "", buff.String())
 }
 
+func TestRunInPrWithNameFilter(t *testing.T) {
+	clean()
+	r := NewTestRepo(t, ".tmp/repo")
+
+	r.InitModuleWithOptions("app-a", &Spec{
+		Name: "app-a",
+		Commands: map[string]*UserCmd{
+			"echo": {Cmd: "echo", Args: []string{"hello-app-a"}},
+		},
+	})
+
+	r.Commit("first")
+
+	r.SwitchToBranch("feature")
+	r.InitModuleWithOptions("app-b", &Spec{
+		Name: "app-b",
+		Commands: map[string]*UserCmd{
+			"echo": {Cmd: "echo", Args: []string{"hello-app-b"}},
+		},
+	})
+
+	r.InitModuleWithOptions("app-c", &Spec{
+		Name: "app-c",
+		Commands: map[string]*UserCmd{
+			"echo": {Cmd: "echo", Args: []string{"hello-app-c"}},
+		},
+	})
+
+	r.Commit("second")
+
+	w := NewWorld(t, ".tmp/repo")
+
+	buff := new(bytes.Buffer)
+	result, err := w.System.RunInPr("echo", "feature", "master", ExactMatchFilter("app-c"), stdTestCmdOptions(buff))
+
+	check(t, err)
+	assert.Len(t, result.Completed, 1)
+	assert.Len(t, result.Skipped, 0)
+	assert.Len(t, result.Failures, 0)
+	assert.Equal(t, "app-c", result.Completed[0].Name())
+	assert.Equal(t, "hello-app-c\n", buff.String())
+}
+
+func TestRunInPrWithInvalidFilterExpression(t *testing.T) {
+	clean()
+	r := NewTestRepo(t, ".tmp/repo")
+
+	r.InitModuleWithOptions("app-a", &Spec{
+		Name: "app-a",
+		Commands: map[string]*UserCmd{
+			"echo": {Cmd: "echo", Args: []string{"hello-app-a"}},
+		},
+	})
+
+	r.Commit("first")
+	r.SwitchToBranch("feature")
+	r.WriteContent("app-a/foo", "bar")
+	r.Commit("second")
+
+	w := NewWorld(t, ".tmp/repo")
+
+	_, err := w.System.RunInPr("echo", "feature", "master", &FilterOptions{Expression: "name="}, stdTestCmdOptions(nil))
+
+	assert.Error(t, err)
+	assert.Equal(t, ErrClassUser, (err.(*e.E)).Class())
+}
+
 func TestRunInDiff(t *testing.T) {
 	clean()
 	r := NewTestRepo(t, ".tmp/repo")
@@ -197,7 +267,7 @@ func TestRunInDiff(t *testing.T) {
 	w := NewWorld(t, ".tmp/repo")
 
 	buff := new(bytes.Buffer)
-	result, err := w.System.RunInDiff("echo", c1.String(), c2.String(), stdTestCmdOptions(buff))
+	result, err := w.System.RunInDiff("echo", c1.String(), c2.String(), NoFilter, stdTestCmdOptions(buff))
 
 	check(t, err)
 	assert.Len(t, result.Completed, 1)
@@ -207,7 +277,7 @@ func TestRunInDiff(t *testing.T) {
 	assert.Equal(t, "hello-app-b\n", buff.String())
 
 	buff = new(bytes.Buffer)
-	result, err = w.System.RunInDiff("echo", c2.String(), c1.String(), stdTestCmdOptions(buff))
+	result, err = w.System.RunInDiff("echo", c2.String(), c1.String(), NoFilter, stdTestCmdOptions(buff))
 
 	check(t, err)
 	assert.Len(t, result.Completed, 0)
@@ -313,7 +383,7 @@ func TestRunInCommitContent(t *testing.T) {
 	w := NewWorld(t, ".tmp/repo")
 
 	buff := new(bytes.Buffer)
-	result, err := w.System.RunInCommitContent("echo", r.LastCommit.String(), stdTestCmdOptions(buff))
+	result, err := w.System.RunInCommitContent("echo", r.LastCommit.String(), NoFilter, stdTestCmdOptions(buff))
 
 	check(t, err)
 	assert.Len(t, result.Completed, 1)
@@ -449,3 +519,144 @@ func TestFailFast(t *testing.T) {
 	assert.Equal(t, "app-c", result.Skipped[0].Name())
 	assert.Equal(t, "app-a\n", buff.String())
 }
+
+func TestRunInWithCancelledContext(t *testing.T) {
+	clean()
+	r := NewTestRepo(t, ".tmp/repo")
+
+	r.InitModuleWithOptions("app-a", &Spec{
+		Name: "app-a",
+		Commands: map[string]*UserCmd{
+			"echo": {Cmd: "echo", Args: []string{"app-a"}},
+		},
+	})
+	r.InitModuleWithOptions("app-b", &Spec{
+		Name: "app-b",
+		Commands: map[string]*UserCmd{
+			"echo": {Cmd: "echo", Args: []string{"app-b"}},
+		},
+	})
+
+	r.Commit("first")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	buff := new(bytes.Buffer)
+	options := stdTestCmdOptions(buff)
+	options.Context = ctx
+	result, err := NewWorld(t, ".tmp/repo").System.RunInCurrentBranch("echo", NoFilter, options)
+
+	assert.EqualError(t, err, fmt.Sprintf(msgRunCancelled, 2))
+	assert.Equal(t, context.Canceled, err.(*e.E).InnerError())
+	assert.Len(t, result.Completed, 0)
+	assert.Len(t, result.Skipped, 2)
+	assert.Len(t, result.Failures, 0)
+	assert.Equal(t, "", buff.String())
+}
+
+func TestRunInWithDependencies(t *testing.T) {
+	clean()
+	r := NewTestRepo(t, ".tmp/repo")
+
+	check(t, r.InitModuleWithOptions("lib-a", &Spec{
+		Name: "lib-a",
+		Commands: map[string]*UserCmd{
+			"echo": {Cmd: "echo", Args: []string{"lib-a"}},
+		},
+	}))
+	check(t, r.InitModuleWithOptions("app-a", &Spec{
+		Name:         "app-a",
+		Dependencies: []string{"lib-a"},
+		Commands: map[string]*UserCmd{
+			"echo": {Cmd: "echo", Args: []string{"app-a"}},
+		},
+	}))
+	check(t, r.InitModuleWithOptions("app-b", &Spec{
+		Name: "app-b",
+		Commands: map[string]*UserCmd{
+			"echo": {Cmd: "echo", Args: []string{"app-b"}},
+		},
+	}))
+	check(t, r.Commit("first"))
+
+	buff := new(bytes.Buffer)
+	result, err := NewWorld(t, ".tmp/repo").System.RunInCurrentBranch("echo", ExactMatchDependenciesFilter("app-a"), stdTestCmdOptions(buff))
+	check(t, err)
+
+	assert.Len(t, result.Completed, 2)
+	assert.Equal(t, "lib-a", result.Completed[0].Name())
+	assert.Equal(t, "app-a", result.Completed[1].Name())
+	assert.Equal(t, "lib-a\napp-a\n", buff.String())
+}
+
+func TestRunInResults(t *testing.T) {
+	clean()
+	r := NewTestRepo(t, ".tmp/repo")
+
+	check(t, r.InitModuleWithOptions("app-a", &Spec{
+		Name: "app-a",
+		Commands: map[string]*UserCmd{
+			"echo": {Cmd: "bad_command"},
+		},
+	}))
+	check(t, r.InitModuleWithOptions("app-b", &Spec{Name: "app-b"}))
+	check(t, r.InitModuleWithOptions("app-c", &Spec{
+		Name: "app-c",
+		Commands: map[string]*UserCmd{
+			"echo": {Cmd: "echo", OS: []string{"unknown"}},
+		},
+	}))
+	check(t, r.InitModuleWithOptions("app-d", &Spec{
+		Name: "app-d",
+		Commands: map[string]*UserCmd{
+			"echo": {Cmd: "echo", Args: []string{"app-d"}},
+		},
+	}))
+	check(t, r.Commit("first"))
+
+	buff := new(bytes.Buffer)
+	options := stdTestCmdOptions(buff)
+	options.FailFast = true
+	result, err := NewWorld(t, ".tmp/repo").System.RunInCurrentBranch("echo", NoFilter, options)
+	check(t, err)
+
+	assert.Len(t, result.Results, 4)
+	assert.Equal(t, ModuleStatusFailed, result.Results[0].Status)
+	assert.Equal(t, SkipReasonNoCommand, result.Results[1].SkipReason)
+	assert.Equal(t, SkipReasonUnsupportedOS, result.Results[2].SkipReason)
+	assert.Equal(t, SkipReasonFailFast, result.Results[3].SkipReason)
+}
+
+func TestRunInDryRun(t *testing.T) {
+	clean()
+	r := NewTestRepo(t, ".tmp/repo")
+
+	check(t, r.InitModuleWithOptions("app-a", &Spec{
+		Name: "app-a",
+		Commands: map[string]*UserCmd{
+			"echo": {Cmd: "echo", Args: []string{"app-a"}},
+		},
+	}))
+	check(t, r.InitModuleWithOptions("app-b", &Spec{
+		Name: "app-b",
+		Commands: map[string]*UserCmd{
+			"echo": {Cmd: "echo", OS: []string{"unknown"}},
+		},
+	}))
+	check(t, r.Commit("first"))
+
+	buff := new(bytes.Buffer)
+	options := stdTestCmdOptions(buff)
+	options.DryRun = true
+	result, err := NewWorld(t, ".tmp/repo").System.RunInCurrentBranch("echo", NoFilter, options)
+	check(t, err)
+
+	assert.Empty(t, buff.String())
+	assert.Equal(t, "echo", result.Plan.Command)
+	assert.Len(t, result.Plan.Steps, 2)
+	assert.Equal(t, PlanActionRun, result.Plan.Steps[0].Action)
+	assert.Equal(t, []string{"app-a"}, result.Plan.Steps[0].Args)
+	assert.Equal(t, PlanActionSkip, result.Plan.Steps[1].Action)
+	assert.Equal(t, SkipReasonUnsupportedOS, result.Plan.Steps[1].SkipReason)
+}
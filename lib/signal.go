@@ -0,0 +1,69 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+type signalKey struct{}
+
+type receivedSignal struct {
+	mu  sync.Mutex
+	sig os.Signal
+}
+
+// WithSignals returns a copy of parent that is cancelled when the
+// current process receives one of the specified signals.
+// Commands running with the returned context receive the same signal.
+// Signals are only handled once. Subsequent signals take
+// their default action (e.g. terminate mbt immediately).
+func WithSignals(parent context.Context, signals ...os.Signal) (context.Context, context.CancelFunc) {
+	received := &receivedSignal{}
+	ctx, cancel := context.WithCancel(context.WithValue(parent, signalKey{}, received))
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	go func() {
+		defer signal.Stop(ch)
+		select {
+		case sig := <-ch:
+			received.mu.Lock()
+			received.sig = sig
+			received.mu.Unlock()
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// signalFromContext returns the signal that cancelled ctx or nil
+// if it was cancelled for some other reason (e.g. a timeout).
+func signalFromContext(ctx context.Context) os.Signal {
+	received, ok := ctx.Value(signalKey{}).(*receivedSignal)
+	if !ok {
+		return nil
+	}
+
+	received.mu.Lock()
+	defer received.mu.Unlock()
+	return received.sig
+}
@@ -0,0 +1,221 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"crypto/sha1"
+	"fmt"
+
+	yaml "github.com/go-yaml/yaml"
+	"github.com/mbtproject/mbt/e"
+)
+
+const defaultsFileName = ".mbt-defaults.yml"
+
+// specTemplate is the configuration inherited by modules from
+// the repository defaults and kinds.
+type specTemplate struct {
+	Build      map[string]*Cmd        `yaml:"build"`
+	Commands   map[string]*UserCmd    `yaml:"commands"`
+	Properties map[string]interface{} `yaml:"properties"`
+}
+
+// specKind is a named template referenced by the kind key in
+// a spec (e.g. go-service).
+type specKind struct {
+	specTemplate     `yaml:",inline"`
+	FileDependencies []string `yaml:"fileDependencies"`
+	Artifacts        []string `yaml:"artifacts"`
+	Ignore           []string `yaml:"ignore"`
+}
+
+// specDefaults represents the repository level configuration in
+// .mbt-defaults.yml that is inherited by every module.
+type specDefaults struct {
+	specTemplate `yaml:",inline"`
+	Kinds        map[string]*specKind `yaml:"kinds"`
+}
+
+func newSpecDefaults(content []byte) (*specDefaults, error) {
+	d := &specDefaults{}
+	err := yaml.Unmarshal(content, d)
+	if err != nil {
+		return nil, err
+	}
+
+	problems := checkDefaultsKeys(parseSpecNode(content))
+	if len(problems) > 0 {
+		p := problems[0]
+		return nil, e.NewErrorf(ErrClassUser, msgInvalidSpecKey, p.Line, p.Column, p.Message)
+	}
+
+	d.Properties, err = transformProps(d.Properties)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, k := range d.Kinds {
+		if k == nil {
+			continue
+		}
+
+		k.Properties, err = transformProps(k.Properties)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// apply merges the kind of the spec (if any) and the defaults
+// into a spec. Values in the spec take precedence over the kind
+// and the kind takes precedence over the defaults.
+func (d *specDefaults) apply(spec *Spec) error {
+	if spec.Kind != "" {
+		k, ok := d.Kinds[spec.Kind]
+		if !ok {
+			return e.NewErrorf(ErrClassUser, msgKindNotFound, spec.Kind, spec.Name)
+		}
+
+		if k != nil {
+			k.apply(spec)
+		}
+	}
+
+	d.specTemplate.apply(spec)
+	return nil
+}
+
+// apply merges the kind into a spec. Lists in the kind are
+// prepended to the lists in the spec.
+func (k *specKind) apply(spec *Spec) {
+	k.specTemplate.apply(spec)
+	spec.FileDependencies = mergeStrings(k.FileDependencies, spec.FileDependencies)
+	spec.Artifacts = mergeStrings(k.Artifacts, spec.Artifacts)
+	spec.Ignore = mergeStrings(k.Ignore, spec.Ignore)
+}
+
+// apply merges the template into a spec.
+// Build and command entries in the spec override the entries
+// with the same name in the template. Properties are merged recursively
+// with the values in the spec taking precedence.
+func (t *specTemplate) apply(spec *Spec) {
+	if len(t.Build) > 0 && spec.Build == nil {
+		spec.Build = make(map[string]*Cmd)
+	}
+
+	for os, cmd := range t.Build {
+		if _, ok := spec.Build[os]; !ok && cmd != nil {
+			c := *cmd
+			c.Args = copyStrings(cmd.Args)
+			spec.Build[os] = &c
+		}
+	}
+
+	if len(t.Commands) > 0 && spec.Commands == nil {
+		spec.Commands = make(map[string]*UserCmd)
+	}
+
+	for name, cmd := range t.Commands {
+		if _, ok := spec.Commands[name]; !ok && cmd != nil {
+			c := *cmd
+			c.Args = copyStrings(cmd.Args)
+			c.OS = copyStrings(cmd.OS)
+			spec.Commands[name] = &c
+		}
+	}
+
+	spec.Properties = mergeProps(t.Properties, spec.Properties)
+}
+
+// mergeStrings returns the distinct items of both lists
+// preserving their order.
+func mergeStrings(a, b []string) []string {
+	if len(a) == 0 {
+		return b
+	}
+
+	merged := make([]string, 0, len(a)+len(b))
+	seen := make(map[string]bool)
+	for _, l := range [][]string{a, b} {
+		for _, s := range l {
+			if !seen[s] {
+				seen[s] = true
+				merged = append(merged, s)
+			}
+		}
+	}
+
+	return merged
+}
+
+// mergeProps returns a new map containing the entries of both
+// defaults and props. When both contain a map for the same key,
+// they are merged recursively. Otherwise, the value in props is used.
+func mergeProps(defaults, props map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(defaults)+len(props))
+	for k, v := range defaults {
+		merged[k] = copyProp(v)
+	}
+
+	for k, v := range props {
+		dm, dok := merged[k].(map[string]interface{})
+		pm, pok := v.(map[string]interface{})
+		if dok && pok {
+			merged[k] = mergeProps(dm, pm)
+		} else {
+			merged[k] = v
+		}
+	}
+
+	return merged
+}
+
+// copyProp returns a deep copy of a property value so that modules
+// do not share the mutable values inherited from defaults.
+func copyProp(v interface{}) interface{} {
+	switch c := v.(type) {
+	case map[string]interface{}:
+		return mergeProps(c, nil)
+	case []interface{}:
+		a := make([]interface{}, len(c))
+		for i, item := range c {
+			a[i] = copyProp(item)
+		}
+		return a
+	default:
+		return v
+	}
+}
+
+// specHash returns a hash of the contents of a spec.
+func specHash(spec *Spec) (string, error) {
+	b, err := yaml.Marshal(spec)
+	if err != nil {
+		return "", e.Wrap(ErrClassInternal, err)
+	}
+
+	return fmt.Sprintf("%x", sha1.Sum(b)), nil
+}
+
+func copyStrings(a []string) []string {
+	if a == nil {
+		return nil
+	}
+
+	return append([]string{}, a...)
+}
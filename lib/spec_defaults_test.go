@@ -0,0 +1,307 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mbtproject/mbt/e"
+	"github.com/stretchr/testify/assert"
+)
+
+const testDefaults = `build:
+  default:
+    cmd: make
+    args: [build]
+  windows:
+    cmd: make.exe
+commands:
+  test:
+    cmd: make
+    args: [test]
+properties:
+  owner: platform
+  docker:
+    registry: example.com
+    tags: [latest]
+`
+
+func TestApplyDefaults(t *testing.T) {
+	d, err := newSpecDefaults([]byte(testDefaults))
+	check(t, err)
+
+	spec, err := newSpec([]byte(`name: app-a
+build:
+  windows:
+    cmd: build.bat
+properties:
+  docker:
+    image: app-a
+    tags: [stable]
+`))
+	check(t, err)
+
+	d.apply(spec)
+
+	assert.Equal(t, &Cmd{Cmd: "make", Args: []string{"build"}}, spec.Build["default"])
+	assert.Equal(t, &Cmd{Cmd: "build.bat"}, spec.Build["windows"])
+	assert.Equal(t, "make", spec.Commands["test"].Cmd)
+	assert.Equal(t, map[string]interface{}{
+		"owner": "platform",
+		"docker": map[string]interface{}{
+			"registry": "example.com",
+			"image":    "app-a",
+			"tags":     []interface{}{"stable"},
+		},
+	}, spec.Properties)
+
+	// Inherited values are not shared between modules
+	spec.Properties["docker"].(map[string]interface{})["registry"] = "changed"
+	spec.Build["default"].Args[0] = "changed"
+	other, err := newSpec([]byte("name: app-b\n"))
+	check(t, err)
+	d.apply(other)
+	assert.Equal(t, "example.com", other.Properties["docker"].(map[string]interface{})["registry"])
+	assert.Equal(t, "build", d.Build["default"].Args[0])
+}
+
+func TestStrictDefaultsParsing(t *testing.T) {
+	_, err := newSpecDefaults([]byte("name: app-a\n"))
+
+	assert.EqualError(t, err, "line 1, column 1: unknown key 'name'")
+	assert.Equal(t, ErrClassUser, (err.(*e.E)).Class())
+}
+
+func TestDefaultsInDiscovery(t *testing.T) {
+	repo := NewMemoryRepo(".tmp/repo")
+	repo.WriteFile(defaultsFileName, testDefaults)
+	repo.WriteFile("app-a/.mbt.yml", "name: app-a\n")
+	repo.WriteFile("app-b/.mbt.yml", "name: app-b\nbuild:\n  default:\n    cmd: go\n")
+	c, err := repo.Commit("first")
+	check(t, err)
+
+	discover := NewDiscover(repo, NewStdLog(LogLevelNormal))
+	for _, find := range []func() (Modules, error){
+		func() (Modules, error) { return discover.ModulesInCommit(c) },
+		discover.ModulesInWorkspace,
+	} {
+		mods, err := find()
+		check(t, err)
+
+		m := mods.indexByName()
+		assert.Equal(t, "make", m["app-a"].Build()["default"].Cmd)
+		assert.Equal(t, "go", m["app-b"].Build()["default"].Cmd)
+		assert.Equal(t, "platform", m["app-b"].Properties()["owner"])
+		assert.NotEqual(t, m["app-a"].Hash(), m["app-a"].Version())
+	}
+}
+
+func TestDefaultsChangeImpactsAllModules(t *testing.T) {
+	repo := NewMemoryRepo(".tmp/repo")
+	repo.WriteFile("app-a/.mbt.yml", "name: app-a\n")
+	repo.WriteFile("app-b/.mbt.yml", "name: app-b\n")
+	first, err := repo.Commit("first")
+	check(t, err)
+
+	repo.WriteFile(defaultsFileName, testDefaults)
+	second, err := repo.Commit("second")
+	check(t, err)
+
+	system := NewSystemWith(repo)
+	before, err := system.ManifestByCommit(first.ID())
+	check(t, err)
+
+	versions := before.Modules.indexByName()
+
+	m, err := system.ManifestByDiff(first.ID(), second.ID())
+	check(t, err)
+	assert.ElementsMatch(t, []string{"app-a", "app-b"}, m.Modules.names())
+	for _, mod := range m.Modules {
+		assert.NotEqual(t, versions[mod.Name()].Version(), mod.Version())
+		assert.Equal(t, &Reason{Kind: ReasonDefaults, Files: []string{defaultsFileName}}, mod.Reason())
+	}
+
+	repo.WriteFile(defaultsFileName, "properties:\n  owner: web\n")
+	m, err = system.ManifestByWorkspaceChanges()
+	check(t, err)
+	assert.ElementsMatch(t, []string{"app-a", "app-b"}, m.Modules.names())
+	assert.Equal(t, "web", m.Modules[0].Properties()["owner"])
+}
+
+func TestDefaultsChangeImpactsOnlyInheritingModules(t *testing.T) {
+	repo := NewMemoryRepo(".tmp/repo")
+	repo.WriteFile(defaultsFileName, testKinds)
+	repo.WriteFile("go.mod", "module example.com/repo")
+	repo.WriteFile("app-a/.mbt.yml", "name: app-a\nkind: go-service\n")
+	repo.WriteFile("app-b/.mbt.yml", "name: app-b\nkind: npm-package\n")
+	repo.WriteFile("app-c/.mbt.yml", "name: app-c\n")
+	// app-d overrides the build inherited from its kind
+	repo.WriteFile("app-d/.mbt.yml", "name: app-d\nkind: npm-package\nbuild:\n  default:\n    cmd: npm\n")
+	first, err := repo.Commit("first")
+	check(t, err)
+
+	defaults := strings.Replace(testKinds, "cmd: npm", "cmd: yarn", 1)
+	repo.WriteFile(defaultsFileName, defaults)
+	second, err := repo.Commit("second")
+	check(t, err)
+
+	system := NewSystemWith(repo)
+	before, err := system.ManifestByCommit(first.ID())
+	check(t, err)
+
+	after, err := system.ManifestByCommit(second.ID())
+	check(t, err)
+
+	versions := before.Modules.indexByName()
+	for _, mod := range after.Modules {
+		if mod.Name() == "app-b" {
+			assert.NotEqual(t, versions[mod.Name()].Version(), mod.Version())
+		} else {
+			assert.Equal(t, versions[mod.Name()].Version(), mod.Version())
+		}
+	}
+
+	m, err := system.ManifestByDiff(first.ID(), second.ID())
+	check(t, err)
+	assert.Equal(t, []string{"app-b"}, m.Modules.names())
+	assert.Equal(t, &Reason{Kind: ReasonDefaults, Files: []string{defaultsFileName}}, m.Modules[0].Reason())
+
+	m, err = system.ManifestByCommitContent(second.ID())
+	check(t, err)
+	assert.Equal(t, []string{"app-b"}, m.Modules.names())
+
+	repo.WriteFile(defaultsFileName, strings.Replace(defaults, "owner: backend", "owner: web", 1))
+	m, err = system.ManifestByWorkspaceChanges()
+	check(t, err)
+	assert.Equal(t, []string{"app-a"}, m.Modules.names())
+	assert.Equal(t, "web", m.Modules[0].Properties()["owner"])
+}
+
+func TestInvalidDefaultsInDiscovery(t *testing.T) {
+	repo := NewMemoryRepo(".tmp/repo")
+	repo.WriteFile(defaultsFileName, "build:\n  default:\n    cmdd: make\n")
+	repo.WriteFile("app-a/.mbt.yml", "name: app-a\n")
+	c, err := repo.Commit("first")
+	check(t, err)
+
+	_, err = NewDiscover(repo, NewStdLog(LogLevelNormal)).ModulesInCommit(c)
+
+	assert.EqualError(t, err, "error while parsing the defaults at .mbt-defaults.yml")
+	assert.EqualError(t, (err.(*e.E)).InnerError(), "line 3, column 5: unknown key 'cmdd' in 'build/default'")
+}
+
+const testKinds = `build:
+  default:
+    cmd: make
+properties:
+  owner: platform
+kinds:
+  go-service:
+    build:
+      default:
+        cmd: go
+        args: [build]
+    commands:
+      test:
+        cmd: go
+        args: [test]
+    properties:
+      owner: backend
+    fileDependencies: [go.mod]
+    ignore: ["*.md"]
+  npm-package:
+    build:
+      default:
+        cmd: npm
+`
+
+func TestApplyKind(t *testing.T) {
+	d, err := newSpecDefaults([]byte(testKinds))
+	check(t, err)
+
+	spec, err := newSpec([]byte("name: app-a\nkind: go-service\nfileDependencies: [shared, go.mod]\nproperties:\n  port: 80\n"))
+	check(t, err)
+	check(t, d.apply(spec))
+
+	assert.Equal(t, &Cmd{Cmd: "go", Args: []string{"build"}}, spec.Build["default"])
+	assert.Equal(t, "go", spec.Commands["test"].Cmd)
+	assert.Equal(t, map[string]interface{}{"owner": "backend", "port": 80}, spec.Properties)
+	assert.Equal(t, []string{"go.mod", "shared"}, spec.FileDependencies)
+	assert.Equal(t, []string{"*.md"}, spec.Ignore)
+
+	// Modules without a kind only inherit the defaults
+	spec, err = newSpec([]byte("name: app-b\n"))
+	check(t, err)
+	check(t, d.apply(spec))
+	assert.Equal(t, &Cmd{Cmd: "make"}, spec.Build["default"])
+	assert.Empty(t, spec.FileDependencies)
+
+	spec, err = newSpec([]byte("name: app-c\nkind: terraform\n"))
+	check(t, err)
+	err = d.apply(spec)
+	assert.EqualError(t, err, fmt.Sprintf(msgKindNotFound, "terraform", "app-c"))
+	assert.Equal(t, ErrClassUser, (err.(*e.E)).Class())
+}
+
+func TestKindsInDiscovery(t *testing.T) {
+	repo := NewMemoryRepo(".tmp/repo")
+	repo.WriteFile(defaultsFileName, testKinds)
+	repo.WriteFile("go.mod", "module example.com/repo")
+	repo.WriteFile("app-a/.mbt.yml", "name: app-a\nkind: go-service\n")
+	repo.WriteFile("app-b/.mbt.yml", "name: app-b\nkind: npm-package\n")
+	repo.WriteFile("app-c/.mbt.yml", "name: app-c\n")
+	first, err := repo.Commit("first")
+	check(t, err)
+
+	repo.WriteFile("go.mod", "module example.com/repo\n\ngo 1.15")
+	second, err := repo.Commit("second")
+	check(t, err)
+
+	system := NewSystemWith(repo)
+	m, err := system.ManifestByDiff(first.ID(), second.ID())
+	check(t, err)
+	assert.Equal(t, []string{"app-a"}, m.Modules.names())
+	assert.Equal(t, "go-service", m.Modules[0].Kind())
+	assert.Equal(t, ReasonFileDependency, m.Modules[0].Reason().Kind)
+
+	m, err = system.ManifestByCurrentBranch()
+	check(t, err)
+
+	f, err := m.ApplyFilters(&FilterOptions{Kind: "GO-SERVICE,npm-package"})
+	check(t, err)
+	assert.ElementsMatch(t, []string{"app-a", "app-b"}, f.Modules.names())
+
+	groups := m.Modules.GroupByKind()
+	assert.Len(t, groups, 3)
+	assert.Equal(t, "go-service", groups[0].Kind)
+	assert.Equal(t, []string{"app-a"}, groups[0].Modules.names())
+	assert.Equal(t, "npm-package", groups[1].Kind)
+	assert.Equal(t, "", groups[2].Kind)
+	assert.Equal(t, []string{"app-c"}, groups[2].Modules.names())
+}
+
+func TestKindWithoutDefaultsFile(t *testing.T) {
+	repo := NewMemoryRepo(".tmp/repo")
+	repo.WriteFile("app-a/.mbt.yml", "name: app-a\nkind: go-service\n")
+	c, err := repo.Commit("first")
+	check(t, err)
+
+	_, err = NewDiscover(repo, NewStdLog(LogLevelNormal)).ModulesInCommit(c)
+
+	assert.EqualError(t, err, fmt.Sprintf(msgKindNotFound, "go-service", "app-a"))
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+// SpecSchema is the JSON Schema of .mbt.yml.
+// It can be used to validate specs and enable completion in editors
+// supporting JSON Schema for yaml documents.
+const SpecSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "$id": "https://github.com/mbtproject/mbt/mbt.schema.json",
+  "title": "mbt module spec (.mbt.yml)",
+  "type": "object",
+  "additionalProperties": false,
+  "required": ["name"],
+  "properties": {
+    "name": {
+      "description": "Name of the module. Must be unique within the repository.",
+      "type": "string",
+      "minLength": 1
+    },
+    "kind": {
+      "description": "Name of a kind defined in .mbt-defaults.yml. Build, commands, properties and file dependencies of the kind are inherited by the module.",
+      "type": "string"
+    },
+    "build": {
+      "description": "Build command for each operating system. Use default for all other operating systems.",
+      "type": "object",
+      "propertyNames": { "$ref": "#/definitions/osOrDefault" },
+      "additionalProperties": { "$ref": "#/definitions/cmd" }
+    },
+    "commands": {
+      "description": "User defined commands executed with mbt run-in.",
+      "type": "object",
+      "additionalProperties": { "$ref": "#/definitions/userCmd" }
+    },
+    "properties": {
+      "description": "Arbitrary properties available in templates and build environment.",
+      "type": "object"
+    },
+    "dependencies": {
+      "description": "Names of the modules this module depends on.",
+      "type": "array",
+      "items": { "type": "string" }
+    },
+    "fileDependencies": {
+      "description": "Files, directories or glob patterns outside the module directory that the module depends on.",
+      "type": "array",
+      "items": { "type": "string" }
+    },
+    "artifacts": {
+      "description": "Glob patterns of the build outputs stored in the build cache.",
+      "type": "array",
+      "items": { "type": "string" }
+    },
+    "ignore": {
+      "description": "gitignore style patterns of files that do not change the module version.",
+      "type": "array",
+      "items": { "type": "string" }
+    }
+  },
+  "definitions": {
+    "os": {
+      "enum": ["aix", "android", "darwin", "dragonfly", "freebsd", "illumos", "ios", "js", "linux", "netbsd", "openbsd", "plan9", "solaris", "windows"]
+    },
+    "osOrDefault": {
+      "anyOf": [{ "$ref": "#/definitions/os" }, { "const": "default" }]
+    },
+    "args": {
+      "type": "array",
+      "items": { "type": "string" }
+    },
+    "duration": {
+      "description": "Duration such as 30s or 10m.",
+      "type": "string"
+    },
+    "cmd": {
+      "type": "object",
+      "additionalProperties": false,
+      "required": ["cmd"],
+      "properties": {
+        "cmd": { "type": "string", "minLength": 1 },
+        "args": { "$ref": "#/definitions/args" },
+        "timeout": { "$ref": "#/definitions/duration" },
+        "retries": { "type": "integer", "minimum": 0 }
+      }
+    },
+    "userCmd": {
+      "type": "object",
+      "additionalProperties": false,
+      "required": ["cmd"],
+      "properties": {
+        "cmd": { "type": "string", "minLength": 1 },
+        "args": { "$ref": "#/definitions/args" },
+        "os": {
+          "type": "array",
+          "items": { "$ref": "#/definitions/os" }
+        },
+        "timeout": { "$ref": "#/definitions/duration" },
+        "retries": { "type": "integer", "minimum": 0 }
+      }
+    }
+  }
+}
+`
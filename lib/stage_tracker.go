@@ -0,0 +1,153 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import "time"
+
+// buildCommand is the command name used in the events emitted
+// while building a manifest.
+const buildCommand = "build"
+
+// stageTracker follows the stages of the modules in a manifest.
+// It notifies CmdOptions.Callback, emits the corresponding events to
+// CmdOptions.Events and records the outcome of each module.
+// It is not safe for concurrent use. Parallel builds notify the
+// stages from the scheduling goroutine.
+type stageTracker struct {
+	log      Log
+	options  *CmdOptions
+	manifest *Manifest
+	command  string
+	start    time.Time
+	starts   map[string]time.Time
+	results  map[string]*ModuleResult
+	outputs  map[string][2]*tailBuffer
+}
+
+func (s *stdSystem) newStageTracker(command string, m *Manifest, options *CmdOptions) *stageTracker {
+	return &stageTracker{
+		log:      s.Log,
+		options:  options,
+		manifest: m,
+		command:  command,
+		starts:   make(map[string]time.Time),
+		results:  make(map[string]*ModuleResult),
+		outputs:  make(map[string][2]*tailBuffer),
+	}
+}
+
+func (t *stageTracker) begin() {
+	t.start = time.Now()
+	t.emit(&Event{Type: EventBuildStarted})
+}
+
+// capture returns a copy of options retaining the tail of the
+// output written by mod (if CmdOptions.OutputTail is set).
+func (t *stageTracker) capture(mod *Module, options *CmdOptions) *CmdOptions {
+	if t.options.OutputTail <= 0 {
+		return options
+	}
+
+	stdout := &tailBuffer{size: t.options.OutputTail}
+	stderr := &tailBuffer{size: t.options.OutputTail}
+	t.outputs[mod.Name()] = [2]*tailBuffer{stdout, stderr}
+
+	o := *options
+	o.stdoutTail = stdout
+	o.stderrTail = stderr
+	return &o
+}
+
+func (t *stageTracker) notify(mod *Module, stage CmdStage, err error) {
+	t.options.Callback(mod, stage, err)
+
+	event := &Event{Module: mod, Err: err}
+	switch stage {
+	case CmdStageBeforeBuild:
+		t.starts[mod.Name()] = time.Now()
+		event.Type = EventModuleStarted
+	case CmdStageAfterBuild:
+		event.Type = EventModuleCompleted
+		event.Duration = time.Since(t.starts[mod.Name()])
+		t.record(mod, ModuleStatusCompleted, event.Duration, nil)
+	case CmdStageSkipBuild:
+		event.Type = EventModuleSkipped
+		t.record(mod, ModuleStatusSkipped, 0, nil)
+	case CmdStageCachedBuild:
+		event.Type = EventModuleCached
+		t.record(mod, ModuleStatusCached, 0, nil)
+	case CmdStageFailedBuild:
+		event.Type = EventModuleFailed
+		event.Duration = time.Since(t.starts[mod.Name()])
+		event.ExitCode = exitCode(err)
+		t.record(mod, ModuleStatusFailed, event.Duration, err)
+	default:
+		return
+	}
+
+	t.emit(event)
+}
+
+func (t *stageTracker) skipped(mod *Module, reason SkipReason) {
+	t.notify(mod, CmdStageSkipBuild, nil)
+	t.results[mod.Name()].SkipReason = reason
+}
+
+func (t *stageTracker) cancelled(mod *Module) {
+	t.record(mod, ModuleStatusCancelled, 0, nil)
+	t.emit(&Event{Type: EventModuleCancelled, Module: mod})
+}
+
+func (t *stageTracker) end(err error) {
+	t.emit(&Event{Type: EventBuildFinished, Duration: time.Since(t.start), Err: err})
+}
+
+// moduleResults returns the recorded results in manifest order.
+func (t *stageTracker) moduleResults() []*ModuleResult {
+	results := make([]*ModuleResult, 0, len(t.results))
+	for _, a := range t.manifest.Modules {
+		if r, ok := t.results[a.Name()]; ok {
+			results = append(results, r)
+		}
+	}
+
+	return results
+}
+
+func (t *stageTracker) record(mod *Module, status ModuleStatus, duration time.Duration, err error) {
+	r := &ModuleResult{Module: mod, Status: status, Duration: duration, Err: err}
+	if o, ok := t.outputs[mod.Name()]; ok {
+		r.Stdout = o[0].String()
+		r.Stderr = o[1].String()
+	}
+
+	t.results[mod.Name()] = r
+}
+
+func (t *stageTracker) emit(event *Event) {
+	if t.options.Events == nil {
+		return
+	}
+
+	event.Time = time.Now()
+	event.Command = t.command
+	event.Sha = t.manifest.Sha
+
+	err := t.options.Events.Emit(event)
+	if err != nil {
+		t.log.Warnf(msgFailedEmitEvent, event.Type, err)
+	}
+}
@@ -16,8 +16,10 @@ limitations under the License.
 package lib
 
 import (
+	"context"
 	"io"
 	"os"
+	"time"
 )
 
 // This file defines the interfaces and types that make up MBT system.
@@ -34,6 +36,8 @@ type Blob interface {
 	Name() string
 	// Path (relative) to the blob.
 	Path() string
+	// Mode of the blob in git tree (e.g. 0100755 for executable files).
+	Mode() uint32
 	//String returns a printable id.
 	String() string
 }
@@ -70,6 +74,11 @@ type Reference interface {
 type Repo interface {
 	// GetCommit returns the commit object for the specified SHA.
 	GetCommit(sha string) (Commit, error)
+	// ResolveRevision returns the commit identified by a revision expression.
+	// Supported expressions include full and abbreviated shas, branches,
+	// tags, remote tracking branches and relative forms such as HEAD~3
+	// or master@{upstream}.
+	ResolveRevision(rev string) (Commit, error)
 	// Path of the repository.
 	Path() string
 	// Diff gets the diff between two commits.
@@ -94,6 +103,7 @@ type Repo interface {
 	BlobContentsFromTree(commit Commit, path string) ([]byte, error)
 	// EntryID of a git object in path.
 	// ID is resolved from the commit tree of the specified commit.
+	// Empty path refers to the root of the commit tree.
 	EntryID(commit Commit, path string) (string, error)
 	// BranchCommit returns the last commit for the specified branch.
 	BranchCommit(name string) (Commit, error)
@@ -105,6 +115,18 @@ type Repo interface {
 	IsEmpty() (bool, error)
 	// FindAllFilesInWorkspace returns all files in repository matching given pathSpec, including untracked files.
 	FindAllFilesInWorkspace(pathSpec []string) ([]string, error)
+	// WorkspaceFileContents returns the contents of a file in current workspace.
+	WorkspaceFileContents(path string) ([]byte, error)
+	// WorkspaceEntryIDs returns the ids of files and directories in current
+	// workspace indexed by path. IDs are computed the same way as EntryID
+	// from the content on disk (excluding ignored files), therefore they
+	// are equal to the committed ids when the entries are not modified.
+	// Paths that do not exist in the workspace are not included.
+	WorkspaceEntryIDs(paths []string) (map[string]string, error)
+	// WorkspaceBlobs returns the blobs of all files in current workspace
+	// (excluding ignored files). IDs and modes are computed the same way
+	// as WorkspaceEntryIDs.
+	WorkspaceBlobs() ([]Blob, error)
 	// EnsureSafeWorkspace returns an error workspace is in a safe state
 	// for operations requiring a checkout.
 	// For example, in git repositories we consider uncommitted changes or
@@ -115,6 +137,9 @@ type Repo interface {
 	Checkout(commit Commit) (Reference, error)
 	// CheckoutReference checks out the specified reference into workspace.
 	CheckoutReference(Reference) error
+	// Export writes the files in the commit tree into dir.
+	// Unlike Checkout, workspace and the current head are not modified.
+	Export(commit Commit, dir string) error
 	// MergeBase returns the merge base of two commits.
 	MergeBase(a, b Commit) (Commit, error)
 }
@@ -125,23 +150,33 @@ type Repo interface {
 type Cmd struct {
 	Cmd  string
 	Args []string `yaml:",flow"`
+	// Timeout is the maximum duration of a single attempt (e.g. 10m).
+	// Commands run without a timeout when this is zero.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Retries is the number of times a failed command is repeated.
+	Retries int `yaml:"retries,omitempty"`
 }
 
 // UserCmd represents the structure of a user defined command in .mbt.yml
 type UserCmd struct {
-	Cmd  string
-	Args []string `yaml:",flow"`
-	OS   []string `yaml:"os"`
+	Cmd     string
+	Args    []string      `yaml:",flow"`
+	OS      []string      `yaml:"os"`
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	Retries int           `yaml:"retries,omitempty"`
 }
 
 // Spec represents the structure of .mbt.yml contents.
 type Spec struct {
 	Name             string                 `yaml:"name"`
+	Kind             string                 `yaml:"kind"`
 	Build            map[string]*Cmd        `yaml:"build"`
 	Commands         map[string]*UserCmd    `yaml:"commands"`
 	Properties       map[string]interface{} `yaml:"properties"`
 	Dependencies     []string               `yaml:"dependencies"`
 	FileDependencies []string               `yaml:"fileDependencies"`
+	Artifacts        []string               `yaml:"artifacts"`
+	Ignore           []string               `yaml:"ignore"`
 }
 
 // Module represents a single module in the repository.
@@ -150,11 +185,56 @@ type Module struct {
 	version    string
 	requires   Modules
 	requiredBy Modules
+	reason     *Reason
+}
+
+// ReasonKind is the kind of change that includes a module in a manifest.
+type ReasonKind string
+
+const (
+	// ReasonContent indicates that files under the module path are changed.
+	ReasonContent ReasonKind = "content"
+	// ReasonFileDependency indicates that file dependencies of the module are changed.
+	ReasonFileDependency ReasonKind = "fileDependency"
+	// ReasonDefaults indicates that the repository defaults inherited by the module are changed.
+	ReasonDefaults ReasonKind = "defaults"
+	// ReasonDependency indicates that a module in the dependency chain is changed.
+	ReasonDependency ReasonKind = "dependency"
+)
+
+// Reason describes why a module is included in a manifest.
+type Reason struct {
+	Kind ReasonKind
+	// Files changed under the module path or matching its
+	// file dependencies.
+	Files []string `json:",omitempty"`
+	// Chain of module names from this module to the changed
+	// module it depends on.
+	Chain []string `json:",omitempty"`
 }
 
 // Modules is an array of Module.
 type Modules []*Module
 
+// KindGroup is a set of modules of the same kind.
+type KindGroup struct {
+	// Kind of the modules. Empty for the modules without a kind.
+	Kind    string
+	Modules Modules
+}
+
+// LintProblem is a problem found in a spec file.
+type LintProblem struct {
+	// File is the path of the spec file relative to the repository.
+	File string
+	// Module is the name of the module (empty if it's not known).
+	Module string
+	// Line and Column of the problem in the spec file.
+	// Zero if the location is not known.
+	Line, Column int
+	Message      string
+}
+
 // Discover module metadata for various conditions
 type Discover interface {
 	// ModulesInCommit walks the git tree at a specific commit looking for
@@ -170,11 +250,50 @@ type Reducer interface {
 	Reduce(modules Modules, deltas []*DiffDelta) (Modules, error)
 }
 
+// WorkspaceSha is the Sha of a manifest created for the workspace
+// instead of a commit.
+const WorkspaceSha = "local"
+
 // Manifest represents a collection modules in the repository.
 type Manifest struct {
 	Dir     string
 	Sha     string
 	Modules Modules
+	// Deleted modules are present in the base commit of a diff
+	// but absent in the target commit.
+	Deleted Modules
+}
+
+// ModuleChange is a difference of a module between two manifests.
+type ModuleChange string
+
+const (
+	// ModuleAdded is when module is only present in the second manifest.
+	ModuleAdded ModuleChange = "added"
+	// ModuleRemoved is when module is only present in the first manifest.
+	ModuleRemoved ModuleChange = "removed"
+	// ModulePathChanged is when module is moved to a different path.
+	ModulePathChanged ModuleChange = "pathChanged"
+	// ModuleVersionChanged is when module has a different version.
+	ModuleVersionChanged ModuleChange = "versionChanged"
+)
+
+// ModuleComparison describes how a module differs between two manifests.
+type ModuleComparison struct {
+	Name string
+	// From is nil for added modules.
+	From *Module
+	// To is nil for removed modules.
+	To      *Module
+	Changes []ModuleChange
+}
+
+// Comparison contains the modules that are different between
+// two manifests. Unchanged modules are not included.
+type Comparison struct {
+	From    *Manifest
+	To      *Manifest
+	Modules []*ModuleComparison
 }
 
 // ManifestBuilder builds Manifest for various conditions
@@ -208,6 +327,15 @@ type WorkspaceManager interface {
 	CheckoutAndRun(commit string, fn func() (interface{}, error)) (interface{}, error)
 }
 
+// IsolatedWorkspaceManager runs functions against a commit without
+// touching the workspace.
+type IsolatedWorkspaceManager interface {
+	// ExportAndRun exports the given commit to a temporary directory and
+	// executes the specified function with the path of that directory.
+	// Returns the output from fn.
+	ExportAndRun(commit string, fn func(dir string) (interface{}, error)) (interface{}, error)
+}
+
 /** Process Manager **/
 
 // ProcessManager manages the execution of build and user defined commands.
@@ -216,7 +344,89 @@ type ProcessManager interface {
 	// Following actions are performed prior to executing the command:
 	// - Current working directory of the target process is set to module path
 	// - Initialises important information in the target process environment
-	Exec(manifest *Manifest, module *Module, options *CmdOptions, command string, args ...string) error
+	// - Places the target process in a new process group
+	// - Wraps the output streams as specified in options (e.g. PrefixOutput)
+	// When ctx is done, the process group is signalled and the context
+	// error is returned.
+	Exec(ctx context.Context, manifest *Manifest, module *Module, options *CmdOptions, command string, args ...string) error
+}
+
+/** Build Cache **/
+
+// Cache records successful module builds.
+// Entries are keyed by the module name and version. Since the version
+// of a module is derived from its content and dependencies, a build
+// recorded in the cache does not need to be repeated.
+// Versions are qualified with the operating system (e.g. <version>-linux)
+// because build commands are operating system specific.
+// Each entry contains an archive of the build artifacts (gzipped tar),
+// which is restored into the module directory on a cache hit.
+type Cache interface {
+	// Has returns true if a successful build of the specified
+	// module version is recorded in the cache.
+	Has(name, version string) (bool, error)
+	// Get returns the artifacts archive recorded for the specified
+	// module version.
+	Get(name, version string) (io.ReadCloser, error)
+	// Put records a successful build of the specified module version
+	// along with its artifacts archive.
+	Put(name, version string, artifacts io.Reader) error
+}
+
+/** Events **/
+
+// EventType identifies the kind of an Event.
+type EventType string
+
+const (
+	// EventBuildStarted is emitted before processing the modules in a manifest.
+	EventBuildStarted EventType = "build_started"
+	// EventModuleStarted is emitted before running the command of a module.
+	EventModuleStarted EventType = "module_started"
+	// EventModuleCompleted is emitted when the command of a module succeeds.
+	EventModuleCompleted EventType = "module_completed"
+	// EventModuleSkipped is emitted when a module does not have a command
+	// for current platform.
+	EventModuleSkipped EventType = "module_skipped"
+	// EventModuleCached is emitted when a module build is found in the build cache.
+	EventModuleCached EventType = "module_cached"
+	// EventModuleFailed is emitted when the command of a module fails.
+	EventModuleFailed EventType = "module_failed"
+	// EventModuleCancelled is emitted when a module is not processed
+	// because a dependency failed or the build is cancelled.
+	EventModuleCancelled EventType = "module_cancelled"
+	// EventBuildFinished is emitted after processing all modules in a manifest.
+	EventBuildFinished EventType = "build_finished"
+)
+
+// Event describes the progress of a build or a user defined command
+// (run-in).
+type Event struct {
+	Type EventType
+	Time time.Time
+	// Command is the name of the user defined command or "build".
+	Command string
+	// Sha of the manifest being processed.
+	Sha string
+	// Module is nil for EventBuildStarted and EventBuildFinished.
+	Module *Module
+	// Duration is populated for EventModuleCompleted, EventModuleFailed
+	// and EventBuildFinished.
+	Duration time.Duration
+	// ExitCode of the module command. Populated for EventModuleCompleted
+	// and EventModuleFailed. It's -1 if the command did not exit normally
+	// (e.g. command is not found or timed out).
+	ExitCode int
+	// Err is the reason for a failure.
+	Err error
+}
+
+// EventSink receives the events emitted while processing a manifest.
+// Events are emitted sequentially, even for parallel builds.
+type EventSink interface {
+	// Emit is invoked for each event. Errors returned by this method
+	// are logged and do not interrupt the build.
+	Emit(event *Event) error
 }
 
 /** Build **/
@@ -224,7 +434,7 @@ type ProcessManager interface {
 // CmdStage is an enum to indicate various stages of a command.
 type CmdStage = int
 
-// BuildSummary is a summary of a successful build.
+// BuildSummary is a summary of a build.
 type BuildSummary struct {
 	// Manifest used to trigger the build
 	Manifest *Manifest
@@ -236,6 +446,21 @@ type BuildSummary struct {
 	// Skipped modules due to the unavailability of a build command for
 	// the host platform
 	Skipped []*Module
+	// Cached modules were not built because a successful build of
+	// the same version is recorded in the build cache.
+	Cached []*Module
+	// Failures occurred while building the modules.
+	// Serial builds stop at the first failure.
+	Failures []*CmdFailure
+	// Cancelled modules were never started because the build stopped
+	// at a failure (serial builds), one or more modules they depend on
+	// failed to build (parallel builds) or the build was cancelled
+	// via CmdOptions.Context.
+	Cancelled []*Module
+	// Results contains the outcome of each module in manifest order.
+	Results []*ModuleResult
+	// Plan is only populated in dry runs (see CmdOptions.DryRun).
+	Plan *Plan
 }
 
 // BuildResult is summary for a single module build
@@ -256,6 +481,10 @@ const (
 
 	// CmdStageFailedBuild is when module command is failed
 	CmdStageFailedBuild
+
+	// CmdStageCachedBuild is when module building is skipped because
+	// the same version is already built according to the build cache
+	CmdStageCachedBuild
 )
 
 // CmdStageCallback is the callback function used to notify various build stages
@@ -265,9 +494,19 @@ type CmdStageCallback func(mod *Module, s CmdStage, err error)
 
 // FilterOptions describe how to filter the modules in a manifest
 type FilterOptions struct {
-	Name       string
-	Fuzzy      bool
+	Name  string
+	Fuzzy bool
+	// Kind restricts the modules to the specified kinds.
+	// Multiple kinds can be specified as a comma separated string.
+	Kind string
+	// Expression is a filter expression evaluated against the name,
+	// path, kind, commands and properties of each module
+	// (e.g. path=services/** and properties.team=payments).
+	Expression string
 	Dependents bool
+	// Dependencies includes the modules required by the
+	// filtered modules (ordered so that dependencies appear first).
+	Dependencies bool
 }
 
 // CmdOptions defines various options required by methods executing
@@ -277,6 +516,44 @@ type CmdOptions struct {
 	Stdout, Stderr io.Writer
 	Callback       CmdStageCallback
 	FailFast       bool
+	// Concurrency is the maximum number of modules built at the
+	// same time. Values less than 2 result in a serial build.
+	Concurrency int
+	// Cache used to skip the modules that are already built.
+	// Build cache is not used if this is nil.
+	Cache Cache
+	// Context used to cancel the running commands.
+	// context.Background() is used if this is nil.
+	Context context.Context
+	// Events receives the progress events.
+	// Events are not emitted if this is nil.
+	Events EventSink
+	// OutputTail is the maximum number of bytes retained from
+	// stdout and stderr of each module command in ModuleResult.
+	// Output is not retained if this is zero.
+	OutputTail int
+	// PrefixOutput prefixes each line of the module command output
+	// with the module name.
+	PrefixOutput bool
+	// ColorOutput colours the prefixes added by PrefixOutput.
+	ColorOutput bool
+	// LogDir is the directory to write the output of each
+	// module command (<LogDir>/<module>.log).
+	// Output is not logged if this is empty.
+	LogDir string
+	// Isolated runs the commands in a temporary directory containing
+	// the files of the target commit, instead of checking out the
+	// commit in the workspace. This allows building other commits
+	// while having uncommitted changes in the workspace.
+	Isolated bool
+	// DryRun returns the execution plan in BuildSummary.Plan or
+	// RunResult.Plan without checking out the workspace or executing
+	// any commands.
+	DryRun bool
+
+	// stdoutTail and stderrTail receive the output of the module
+	// command before it is prefixed (see stageTracker.capture).
+	stdoutTail, stderrTail io.Writer
 }
 
 // CmdFailure contains the failures occurred while running a user defined command.
@@ -291,6 +568,98 @@ type RunResult struct {
 	Completed []*Module
 	Skipped   []*Module
 	Failures  []*CmdFailure
+	// Results contains the outcome of each module in manifest order.
+	Results []*ModuleResult
+	// Plan is only populated in dry runs (see CmdOptions.DryRun).
+	Plan *Plan
+}
+
+// ModuleStatus is the outcome of processing a module.
+type ModuleStatus string
+
+const (
+	// ModuleStatusCompleted is when module command succeeded.
+	ModuleStatusCompleted ModuleStatus = "completed"
+	// ModuleStatusFailed is when module command failed.
+	ModuleStatusFailed ModuleStatus = "failed"
+	// ModuleStatusSkipped is when module command was not executed.
+	// See SkipReason for the details.
+	ModuleStatusSkipped ModuleStatus = "skipped"
+	// ModuleStatusCached is when module build was found in the build cache.
+	ModuleStatusCached ModuleStatus = "cached"
+	// ModuleStatusCancelled is when module was never started due to
+	// a failure or cancellation.
+	ModuleStatusCancelled ModuleStatus = "cancelled"
+)
+
+// SkipReason describes why a module command was not executed.
+type SkipReason string
+
+const (
+	// SkipReasonNoCommand is when module does not define the command.
+	SkipReasonNoCommand SkipReason = "no_command"
+	// SkipReasonUnsupportedOS is when module does not define the command
+	// for current operating system.
+	SkipReasonUnsupportedOS SkipReason = "unsupported_os"
+	// SkipReasonFailFast is when a previous command failed and
+	// CmdOptions.FailFast is set.
+	SkipReasonFailFast SkipReason = "fail_fast"
+	// SkipReasonCancelled is when CmdOptions.Context is done.
+	SkipReasonCancelled SkipReason = "cancelled"
+)
+
+// ModuleResult is the outcome of processing a single module.
+type ModuleResult struct {
+	Module *Module
+	Status ModuleStatus
+	// SkipReason is only populated for skipped modules.
+	SkipReason SkipReason
+	// Duration of the module command.
+	Duration time.Duration
+	// Stdout and Stderr contain the tail of the module command output.
+	// Only populated when CmdOptions.OutputTail is set.
+	Stdout, Stderr string
+	// Err is the reason for a failure.
+	Err error
+}
+
+// PlanAction is the action planned for a module in a dry run.
+type PlanAction string
+
+const (
+	// PlanActionRun is when module command would be executed.
+	PlanActionRun PlanAction = "run"
+	// PlanActionSkip is when module command would not be executed.
+	// See SkipReason for the details.
+	PlanActionSkip PlanAction = "skip"
+	// PlanActionCached is when module build would be restored from
+	// the build cache.
+	PlanActionCached PlanAction = "cached"
+)
+
+// PlanStep describes how a command would be executed in a module.
+type PlanStep struct {
+	Module *Module
+	Action PlanAction
+	// SkipReason is only populated for skipped modules.
+	SkipReason SkipReason
+	// Cmd and Args are the resolved command for the host platform.
+	Cmd  string
+	Args []string
+	// Dir is the working directory of the command.
+	Dir string
+	// Env contains the environment variables set by mbt.
+	Env     []string
+	Timeout time.Duration
+	Retries int
+}
+
+// Plan is the ordered list of steps a command (e.g. build) would
+// execute for the modules in a manifest.
+type Plan struct {
+	Command  string
+	Manifest *Manifest
+	Steps    []*PlanStep
 }
 
 // System is the interface used by users to invoke the core functionality
@@ -318,10 +687,14 @@ type System interface {
 	BuildBranch(name string, filterOptions *FilterOptions, options *CmdOptions) (*BuildSummary, error)
 
 	// BuildPr builds changes in 'src' branch since it diverged from 'dst' branch.
-	BuildPr(src, dst string, options *CmdOptions) (*BuildSummary, error)
+	// This function accepts FilterOptions to specify which of the changed
+	// modules to be built.
+	BuildPr(src, dst string, filterOptions *FilterOptions, options *CmdOptions) (*BuildSummary, error)
 
-	// Build builds changes between two commits
-	BuildDiff(from, to string, options *CmdOptions) (*BuildSummary, error)
+	// BuildDiff builds changes between two commits (see ManifestByDiff).
+	// This function accepts FilterOptions to specify which of the changed
+	// modules to be built.
+	BuildDiff(from, to string, filterOptions *FilterOptions, options *CmdOptions) (*BuildSummary, error)
 
 	// BuildCurrentBranch builds the current branch.
 	// This function accepts FilterOptions to specify which modules to be built
@@ -334,7 +707,9 @@ type System interface {
 	BuildCommit(commit string, filterOptions *FilterOptions, options *CmdOptions) (*BuildSummary, error)
 
 	// BuildCommitChanges builds the changes in specified commit
-	BuildCommitContent(commit string, options *CmdOptions) (*BuildSummary, error)
+	// This function accepts FilterOptions to specify which of the changed
+	// modules to be built.
+	BuildCommitContent(commit string, filterOptions *FilterOptions, options *CmdOptions) (*BuildSummary, error)
 
 	// BuildWorkspace builds the current workspace.
 	// This function accepts FilterOptions to specify which modules to be built
@@ -342,7 +717,13 @@ type System interface {
 	BuildWorkspace(filterOptions *FilterOptions, options *CmdOptions) (*BuildSummary, error)
 
 	// BuildWorkspace builds changes in current workspace.
-	BuildWorkspaceChanges(options *CmdOptions) (*BuildSummary, error)
+	// This function accepts FilterOptions to specify which of the changed
+	// modules to be built.
+	BuildWorkspaceChanges(filterOptions *FilterOptions, options *CmdOptions) (*BuildSummary, error)
+
+	// BuildManifestFile builds the modules in a manifest written by
+	// WriteManifest (see ManifestByFile).
+	BuildManifestFile(path string, options *CmdOptions) (*BuildSummary, error)
 
 	// IntersectionByCommit returns the manifest of intersection of modules modified
 	// between two commits.
@@ -358,10 +739,26 @@ type System interface {
 	// between M and first and M and second.
 	IntersectionByBranch(first, second string) (Modules, error)
 
-	// ManifestByDiff creates the manifest for diff between two commits
+	// CompareCommits compares the manifests of two commits.
+	// Unlike ManifestByDiff, modules are compared by their version
+	// regardless of the history of the commits (e.g. cherry picks).
+	// from and to are revision expressions (see Repo.ResolveRevision).
+	CompareCommits(from, to string) (*Comparison, error)
+
+	// LintCommit checks the specs in a commit for problems.
+	// Unlike discovery, all problems are reported at once.
+	LintCommit(commit string) ([]*LintProblem, error)
+
+	// LintWorkspace checks the specs in current workspace for problems.
+	LintWorkspace() ([]*LintProblem, error)
+
+	// ManifestByDiff creates the manifest for diff between two commits.
+	// from and to are revision expressions (see Repo.ResolveRevision).
+	// When to is empty, from can be a revision range (A..B or A...B).
 	ManifestByDiff(from, to string) (*Manifest, error)
 
-	// ManifestByPr creates the manifest for diff between two branches
+	// ManifestByPr creates the manifest for diff between two branches.
+	// src and dst can be any revision expression (see Repo.ResolveRevision).
 	ManifestByPr(src, dst string) (*Manifest, error)
 
 	// ManifestByCommit creates the manifest for the specified commit
@@ -382,17 +779,24 @@ type System interface {
 	// ByWorkspaceChanges creates the manifest for the changes in workspace
 	ManifestByWorkspaceChanges() (*Manifest, error)
 
+	// ManifestByFile reads a manifest written by WriteManifest.
+	ManifestByFile(path string) (*Manifest, error)
+
 	// RunInBranch runs a command in a branch.
 	// This function accepts FilterOptions to specify a subset of modules.
 	RunInBranch(command, name string, filterOptions *FilterOptions, options *CmdOptions) (*RunResult, error)
 
 	// RunInPr runs a command in modules that have been changed in
 	// 'src' branch since it diverged from 'dst' branch.
-	RunInPr(command, src, dst string, options *CmdOptions) (*RunResult, error)
+	// This function accepts FilterOptions to filter the modules included in this
+	// operation.
+	RunInPr(command, src, dst string, filterOptions *FilterOptions, options *CmdOptions) (*RunResult, error)
 
 	// RunInDiff runs a command in modules that have been changed in 'from'
-	// commit since it diverged from 'to' commit.
-	RunInDiff(command, from, to string, options *CmdOptions) (*RunResult, error)
+	// commit since it diverged from 'to' commit (see ManifestByDiff).
+	// This function accepts FilterOptions to filter the modules included in this
+	// operation.
+	RunInDiff(command, from, to string, filterOptions *FilterOptions, options *CmdOptions) (*RunResult, error)
 
 	// RunInCurrentBranch runs a command in modules in the current branch.
 	// This function accepts FilterOptions to filter the modules included in this
@@ -405,7 +809,9 @@ type System interface {
 	RunInCommit(command, commit string, filterOptions *FilterOptions, options *CmdOptions) (*RunResult, error)
 
 	// RunInCommitContent runs a command in modules modified in a commit.
-	RunInCommitContent(command, commit string, options *CmdOptions) (*RunResult, error)
+	// This function accepts FilterOptions to filter the modules included in this
+	// operation.
+	RunInCommitContent(command, commit string, filterOptions *FilterOptions, options *CmdOptions) (*RunResult, error)
 
 	// RunInWorkspace runs a command in all modules in workspace.
 	// This function accepts FilterOptions to filter the modules included in this
@@ -413,32 +819,109 @@ type System interface {
 	RunInWorkspace(command string, filterOptions *FilterOptions, options *CmdOptions) (*RunResult, error)
 
 	// RunInWorkspaceChanges runs a command in modules modified in workspace.
-	RunInWorkspaceChanges(command string, options *CmdOptions) (*RunResult, error)
+	// This function accepts FilterOptions to filter the modules included in this
+	// operation.
+	RunInWorkspaceChanges(command string, filterOptions *FilterOptions, options *CmdOptions) (*RunResult, error)
+
+	// RunInManifestFile runs a command in the modules in a manifest written
+	// by WriteManifest (see ManifestByFile).
+	RunInManifestFile(command, path string, options *CmdOptions) (*RunResult, error)
 }
 
 type stdSystem struct {
-	Repo             Repo
-	Log              Log
-	MB               ManifestBuilder
-	Discover         Discover
-	Reducer          Reducer
-	WorkspaceManager WorkspaceManager
-	ProcessManager   ProcessManager
+	Repo                     Repo
+	Log                      Log
+	MB                       ManifestBuilder
+	Discover                 Discover
+	Reducer                  Reducer
+	WorkspaceManager         WorkspaceManager
+	ProcessManager           ProcessManager
+	IsolatedWorkspaceManager IsolatedWorkspaceManager
 }
 
 // NewSystem creates a new instance of core mbt system
 func NewSystem(path string, logLevel int) (System, error) {
 	log := NewStdLog(logLevel)
-	repo, err := NewLibgitRepo(path, log)
+	repo, err := NewRepo(path, log)
 	if err != nil {
 		return nil, err
 	}
-	discover := NewDiscover(repo, log)
-	reducer := NewReducer(log)
-	mb := NewManifestBuilder(repo, reducer, discover, log)
-	wm := NewWorkspaceManager(log, repo)
-	pm := NewProcessManager(log)
-	return initSystem(log, repo, mb, discover, reducer, wm, pm), nil
+	return NewSystemWith(repo, WithLog(log)), nil
+}
+
+// SystemOption customises the components of a System created
+// with NewSystemWith.
+type SystemOption func(*stdSystem)
+
+// WithLog sets the Log used by the System and its default components.
+func WithLog(log Log) SystemOption {
+	return func(s *stdSystem) { s.Log = log }
+}
+
+// WithDiscover sets the Discover component of the System.
+func WithDiscover(discover Discover) SystemOption {
+	return func(s *stdSystem) { s.Discover = discover }
+}
+
+// WithReducer sets the Reducer component of the System.
+func WithReducer(reducer Reducer) SystemOption {
+	return func(s *stdSystem) { s.Reducer = reducer }
+}
+
+// WithManifestBuilder sets the ManifestBuilder component of the System.
+func WithManifestBuilder(mb ManifestBuilder) SystemOption {
+	return func(s *stdSystem) { s.MB = mb }
+}
+
+// WithWorkspaceManager sets the WorkspaceManager component of the System.
+func WithWorkspaceManager(wm WorkspaceManager) SystemOption {
+	return func(s *stdSystem) { s.WorkspaceManager = wm }
+}
+
+// WithProcessManager sets the ProcessManager component of the System.
+func WithProcessManager(pm ProcessManager) SystemOption {
+	return func(s *stdSystem) { s.ProcessManager = pm }
+}
+
+// WithIsolatedWorkspaceManager sets the IsolatedWorkspaceManager
+// component of the System.
+func WithIsolatedWorkspaceManager(iwm IsolatedWorkspaceManager) SystemOption {
+	return func(s *stdSystem) { s.IsolatedWorkspaceManager = iwm }
+}
+
+// NewSystemWith creates a new instance of core mbt system
+// backed by the specified Repo (e.g. a MemoryRepo).
+// Components not specified in options are created with their
+// default implementations.
+func NewSystemWith(repo Repo, options ...SystemOption) System {
+	s := &stdSystem{Repo: repo}
+	for _, o := range options {
+		o(s)
+	}
+
+	if s.Log == nil {
+		s.Log = NewStdLog(LogLevelNormal)
+	}
+	if s.Discover == nil {
+		s.Discover = NewDiscover(repo, s.Log)
+	}
+	if s.Reducer == nil {
+		s.Reducer = NewReducer(s.Log)
+	}
+	if s.MB == nil {
+		s.MB = NewManifestBuilder(repo, s.Reducer, s.Discover, s.Log)
+	}
+	if s.WorkspaceManager == nil {
+		s.WorkspaceManager = NewWorkspaceManager(s.Log, repo)
+	}
+	if s.ProcessManager == nil {
+		s.ProcessManager = NewProcessManager(s.Log)
+	}
+	if s.IsolatedWorkspaceManager == nil {
+		s.IsolatedWorkspaceManager = NewIsolatedWorkspaceManager(s.Log, repo)
+	}
+
+	return s
 }
 
 // NoFilter is built-in filter that represents no filtering
@@ -464,22 +947,42 @@ func ExactMatchDependentsFilter(name string) *FilterOptions {
 	return &FilterOptions{Name: name, Dependents: true}
 }
 
-func initSystem(log Log, repo Repo, mb ManifestBuilder, discover Discover, reducer Reducer, workspaceManager WorkspaceManager, processManager ProcessManager) System {
-	return &stdSystem{
-		Log:              log,
-		Repo:             repo,
-		MB:               mb,
-		Discover:         discover,
-		Reducer:          reducer,
-		WorkspaceManager: workspaceManager,
-		ProcessManager:   processManager,
-	}
+// FuzzyDependenciesFilter is a helper to create a fuzzy match FilterOptions
+// including the dependencies of matching modules
+func FuzzyDependenciesFilter(name string) *FilterOptions {
+	return &FilterOptions{Name: name, Fuzzy: true, Dependencies: true}
+}
+
+// ExactMatchDependenciesFilter is a helper to create an exact match FilterOptions
+// including the dependencies of matching modules
+func ExactMatchDependenciesFilter(name string) *FilterOptions {
+	return &FilterOptions{Name: name, Dependencies: true}
 }
 
 func (s *stdSystem) ManifestBuilder() ManifestBuilder {
 	return s.MB
 }
 
+// checkoutAndRun checks out the commit of a manifest and invokes fn with
+// a manifest pointing to the directory containing the checked out files.
+// Commit is exported to a temporary directory if options.Isolated is set.
+// The temporary directory is removed once fn returns, therefore, the
+// manifest is pointed back to the repository afterwards.
+func (s *stdSystem) checkoutAndRun(m *Manifest, options *CmdOptions, fn func(*Manifest) (interface{}, error)) (interface{}, error) {
+	if options.Isolated {
+		return s.IsolatedWorkspaceManager.ExportAndRun(m.Sha, func(dir string) (interface{}, error) {
+			mm := *m
+			mm.Dir = dir
+			defer func() { mm.Dir = m.Dir }()
+			return fn(&mm)
+		})
+	}
+
+	return s.WorkspaceManager.CheckoutAndRun(m.Sha, func() (interface{}, error) {
+		return fn(m)
+	})
+}
+
 // CmdOptionsWithStdIO creates an instance of CmdOptions with
 // its streams pointing to std io streams.
 func CmdOptionsWithStdIO(callback CmdStageCallback) *CmdOptions {
@@ -490,3 +993,12 @@ func CmdOptionsWithStdIO(callback CmdStageCallback) *CmdOptions {
 		Stderr:   os.Stderr,
 	}
 }
+
+// context returns the context used to cancel the commands.
+func (o *CmdOptions) context() context.Context {
+	if o.Context == nil {
+		return context.Background()
+	}
+
+	return o.Context
+}
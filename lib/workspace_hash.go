@@ -0,0 +1,301 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/mbtproject/mbt/e"
+)
+
+// Modes of the entries in git tree objects.
+const (
+	gitModeFile       uint32 = 0100644
+	gitModeExecutable uint32 = 0100755
+	gitModeSymlink    uint32 = 0120000
+	gitModeTree       uint32 = 040000
+)
+
+type workspaceEntry struct {
+	mode uint32
+	id   string
+}
+
+// workspaceBlob is a file in the workspace.
+type workspaceBlob struct {
+	path string
+	name string
+	*workspaceEntry
+}
+
+func (b *workspaceBlob) ID() string {
+	return b.id
+}
+
+func (b *workspaceBlob) Name() string {
+	return b.name
+}
+
+func (b *workspaceBlob) Path() string {
+	return b.path
+}
+
+func (b *workspaceBlob) Mode() uint32 {
+	return b.mode
+}
+
+func (b *workspaceBlob) String() string {
+	return b.path + b.name
+}
+
+// workspaceHasher computes the ids git would assign to the files and
+// directories in a workspace if they were committed as they are on disk.
+type workspaceHasher struct {
+	root  string
+	files map[string]bool
+	// children contains the names of the entries in each directory
+	// indexed by the path of the directory ("" for the root).
+	children map[string]map[string]bool
+	// indexModes contains the modes of the files in git index.
+	// They are used on platforms without an executable bit.
+	indexModes map[string]uint32
+	entries    map[string]*workspaceEntry
+}
+
+// newWorkspaceHasher creates a hasher for the workspace at root.
+// files contains the paths (relative to root) of the files that are
+// part of the workspace (i.e. tracked or untracked but not ignored).
+func newWorkspaceHasher(root string, files []string, indexModes map[string]uint32) *workspaceHasher {
+	h := &workspaceHasher{
+		root:       root,
+		files:      make(map[string]bool),
+		children:   make(map[string]map[string]bool),
+		indexModes: indexModes,
+		entries:    make(map[string]*workspaceEntry),
+	}
+
+	for _, f := range files {
+		f = filepath.ToSlash(f)
+		h.files[f] = true
+		h.addChild(f)
+	}
+
+	return h
+}
+
+// addChild records p and its parent directories in the
+// entries of their parents.
+func (h *workspaceHasher) addChild(p string) {
+	for p != "" {
+		dir, name := "", p
+		if i := strings.LastIndex(p, "/"); i >= 0 {
+			dir, name = p[:i], p[i+1:]
+		}
+
+		children, ok := h.children[dir]
+		if !ok {
+			children = make(map[string]bool)
+			h.children[dir] = children
+		}
+
+		if children[name] {
+			// Parents are already recorded
+			return
+		}
+
+		children[name] = true
+		p = dir
+	}
+}
+
+// entryIDs returns the ids of the specified paths indexed by path.
+// Paths that do not exist in the workspace are not included.
+func (h *workspaceHasher) entryIDs(paths []string) (map[string]string, error) {
+	ids := make(map[string]string)
+	for _, p := range paths {
+		entry, err := h.entry(strings.Trim(p, "/"))
+		if err != nil {
+			return nil, err
+		}
+
+		if entry != nil {
+			ids[p] = entry.id
+		}
+	}
+
+	return ids, nil
+}
+
+// blobs returns the blobs of all files in the workspace in path order.
+// Files deleted from the workspace are not included.
+func (h *workspaceHasher) blobs() ([]Blob, error) {
+	paths := make([]string, 0, len(h.files))
+	for p := range h.files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	blobs := make([]Blob, 0, len(paths))
+	for _, p := range paths {
+		entry, err := h.entry(p)
+		if err != nil {
+			return nil, err
+		}
+
+		if entry == nil || entry.mode == gitModeTree {
+			continue
+		}
+
+		dir, name := "", p
+		if i := strings.LastIndex(p, "/"); i >= 0 {
+			dir, name = p[:i+1], p[i+1:]
+		}
+
+		blobs = append(blobs, &workspaceBlob{path: dir, name: name, workspaceEntry: entry})
+	}
+
+	return blobs, nil
+}
+
+func (h *workspaceHasher) entry(p string) (*workspaceEntry, error) {
+	if entry, ok := h.entries[p]; ok {
+		return entry, nil
+	}
+
+	var (
+		entry *workspaceEntry
+		err   error
+	)
+
+	if h.files[p] {
+		entry, err = h.blob(p)
+	} else {
+		entry, err = h.tree(p)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	h.entries[p] = entry
+	return entry, nil
+}
+
+func (h *workspaceHasher) blob(p string) (*workspaceEntry, error) {
+	fullPath := filepath.Join(h.root, filepath.FromSlash(p))
+	info, err := os.Lstat(fullPath)
+	if os.IsNotExist(err) {
+		// Deleted from workspace but not from the index
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, e.Wrapf(ErrClassInternal, err, msgFailedReadFile, fullPath)
+	}
+
+	var contents []byte
+	mode := gitModeFile
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(fullPath)
+		if err != nil {
+			return nil, e.Wrapf(ErrClassInternal, err, msgFailedReadFile, fullPath)
+		}
+		contents = []byte(filepath.ToSlash(target))
+		mode = gitModeSymlink
+	case info.IsDir():
+		// Submodules are not supported
+		return nil, nil
+	default:
+		contents, err = ioutil.ReadFile(fullPath)
+		if err != nil {
+			return nil, e.Wrapf(ErrClassInternal, err, msgFailedReadFile, fullPath)
+		}
+
+		if info.Mode()&0111 != 0 {
+			mode = gitModeExecutable
+		}
+	}
+
+	if runtime.GOOS == "windows" {
+		if m, ok := h.indexModes[p]; ok {
+			mode = m
+		}
+	}
+
+	return &workspaceEntry{mode: mode, id: blobID(contents)}, nil
+}
+
+func (h *workspaceHasher) tree(dir string) (*workspaceEntry, error) {
+	children := h.children[dir]
+
+	type treeEntry struct {
+		name string
+		*workspaceEntry
+	}
+
+	entries := make([]*treeEntry, 0, len(children))
+	for name := range children {
+		entry, err := h.entry(path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		if entry != nil {
+			entries = append(entries, &treeEntry{name, entry})
+		}
+	}
+
+	if len(entries) == 0 {
+		// git does not store empty directories
+		return nil, nil
+	}
+
+	// Entries are sorted by name, directory names are compared
+	// as if they end with a /.
+	sortName := func(e *treeEntry) string {
+		if e.mode == gitModeTree {
+			return e.name + "/"
+		}
+		return e.name
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return sortName(entries[i]) < sortName(entries[j])
+	})
+
+	buff := new(bytes.Buffer)
+	for _, entry := range entries {
+		id, err := hex.DecodeString(entry.id)
+		if err != nil {
+			return nil, e.Wrap(ErrClassInternal, err)
+		}
+		fmt.Fprintf(buff, "%o %s\x00", entry.mode, entry.name)
+		buff.Write(id)
+	}
+
+	sum := sha1.Sum(append([]byte(fmt.Sprintf("tree %v\x00", buff.Len())), buff.Bytes()...))
+	return &workspaceEntry{mode: gitModeTree, id: hex.EncodeToString(sum[:])}, nil
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2018 MBT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeWorkspaceFiles(t *testing.T, root string, files map[string]string) []string {
+	paths := make([]string, 0, len(files))
+	for p, contents := range files {
+		fullPath := filepath.Join(root, filepath.FromSlash(p))
+		check(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+		check(t, ioutil.WriteFile(fullPath, []byte(contents), 0644))
+		paths = append(paths, p)
+	}
+
+	return paths
+}
+
+func TestWorkspaceEntryIDsMatchGit(t *testing.T) {
+	clean()
+	root := ".tmp/ws"
+	files := writeWorkspaceFiles(t, root, map[string]string{
+		"a.txt":     "hello\n",
+		"dir.txt":   "y",
+		"dir/b.txt": "world\n",
+		"dir/sub/c": "x",
+	})
+
+	// Expected ids are obtained by committing the same files with git
+	ids, err := newWorkspaceHasher(root, files, nil).entryIDs([]string{"", "dir", "dir/sub/", "a.txt", "dir.txt", "missing"})
+	check(t, err)
+
+	assert.Equal(t, map[string]string{
+		"":         "419f3ae1bd450afa8f8caeb8807178ab97e9f6f0",
+		"dir":      "8cd5790eb59be2e52ed66aa1eeaf8c87e9ed1e94",
+		"dir/sub/": "eb419bb6d84a1cb33305c7398c075ebc821e7c41",
+		"a.txt":    "ce013625030ba8dba906f756967f9e9ca394464a",
+		"dir.txt":  "e25f1814e51579d5f55c0f1fe0135ddb28a47f4a",
+	}, ids)
+}
+
+func TestWorkspaceEntryIDsIgnoreFilesNotInWorkspace(t *testing.T) {
+	clean()
+	root := ".tmp/ws"
+	files := writeWorkspaceFiles(t, root, map[string]string{
+		"dir/b.txt": "world\n",
+		"dir/sub/c": "x",
+	})
+	// Files not reported as part of the workspace (e.g. ignored files)
+	// must not change the ids.
+	writeWorkspaceFiles(t, root, map[string]string{"dir/ignored.log": "log"})
+
+	ids, err := newWorkspaceHasher(root, files, nil).entryIDs([]string{"dir"})
+	check(t, err)
+
+	assert.Equal(t, "8cd5790eb59be2e52ed66aa1eeaf8c87e9ed1e94", ids["dir"])
+}
+
+func TestWorkspaceBlobs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("executable bit is not available on windows")
+	}
+
+	clean()
+	root := ".tmp/ws"
+	files := writeWorkspaceFiles(t, root, map[string]string{
+		"a.txt":     "hello\n",
+		"dir/b.txt": "world\n",
+		"dir/run":   "x",
+	})
+	files = append(files, "dir/deleted.txt")
+	check(t, os.Chmod(filepath.Join(root, "dir", "run"), 0755))
+
+	blobs, err := newWorkspaceHasher(root, files, nil).blobs()
+	check(t, err)
+
+	assert.Len(t, blobs, 3)
+	assert.Equal(t, "a.txt", blobs[0].String())
+	assert.Equal(t, "", blobs[0].Path())
+	assert.Equal(t, "ce013625030ba8dba906f756967f9e9ca394464a", blobs[0].ID())
+	assert.Equal(t, gitModeFile, blobs[0].Mode())
+	assert.Equal(t, "dir/", blobs[1].Path())
+	assert.Equal(t, "b.txt", blobs[1].Name())
+	assert.Equal(t, "dir/run", blobs[2].String())
+	assert.Equal(t, gitModeExecutable, blobs[2].Mode())
+}